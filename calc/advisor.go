@@ -0,0 +1,193 @@
+package calc
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultDistributionSamples is how many random seeds DefaultDistribution is built from
+	DefaultDistributionSamples = 1000
+
+	// queue time is estimated as queueTimeScale / player count, the fewer players the longer it takes to fill a lobby
+	queueTimeScale   = 6000 * time.Second
+	minQueueTime     = 10 * time.Second
+	maxQueueTime     = 3 * time.Minute
+	unknownQueueTime = 30 * time.Second
+
+	// how many seconds of run time a second spent in queue is worth, 20s of queueing ~ 1s off the run
+	queueSecondCost float64 = 0.05
+)
+
+// SeedDistribution holds the optimal times of a sample of random seeds
+type SeedDistribution struct {
+	times []float64
+}
+
+// SampleDistribution calcs samples random seeds and keeps their optimal times
+func SampleDistribution(samples int, r *rand.Rand) (*SeedDistribution, error) {
+	if samples <= 0 {
+		err := fmt.Errorf("sample size has to be positive, got %d", samples)
+		log.Warn(err)
+		return nil, err
+	}
+
+	times := make([]float64, 0, samples)
+	for n := 0; n < samples; n++ {
+		results, err := CalcSeed(RandomSeed(r))
+		if err != nil {
+			log.Warn(err)
+			return nil, err
+		}
+
+		times = append(times, results[0].BoostTime)
+	}
+	slices.Sort(times)
+
+	return &SeedDistribution{times: times}, nil
+}
+
+var (
+	defaultDistribution     *SeedDistribution
+	defaultDistributionErr  error
+	defaultDistributionOnce sync.Once
+)
+
+// DefaultDistribution is sampled from RoomMap once, on the first call
+func DefaultDistribution() (*SeedDistribution, error) {
+	defaultDistributionOnce.Do(func() {
+		start := time.Now()
+		defaultDistribution, defaultDistributionErr = SampleDistribution(DefaultDistributionSamples, rand.New(rand.NewSource(time.Now().UnixNano())))
+		log.Infof("Sampled the seed distribution in %v", time.Since(start))
+	})
+
+	return defaultDistribution, defaultDistributionErr
+}
+
+// FasterThan returns the fraction of seeds that are slower than seedTime
+func (d *SeedDistribution) FasterThan(seedTime float64) float64 {
+	slower := len(d.times) - sortedCountAtMost(d.times, seedTime)
+	return float64(slower) / float64(len(d.times))
+}
+
+// ExpectedImprovement is how much faster than seedTime a fresh random seed is on average, counting only the seeds that are faster
+func (d *SeedDistribution) ExpectedImprovement(seedTime float64) float64 {
+	total := 0.0
+	for _, t := range d.times {
+		if t >= seedTime {
+			break
+		}
+		total += seedTime - t
+	}
+
+	return total / float64(len(d.times))
+}
+
+func sortedCountAtMost(sorted []float64, value float64) int {
+	n, _ := slices.BinarySearchFunc(sorted, value, func(t, v float64) int {
+		if t <= v {
+			return -1
+		}
+		return 1
+	})
+	return n
+}
+
+// EstimateQueueTime guesses how long it takes to get into a new game. playerCount <= 0 means it's unknown
+func EstimateQueueTime(playerCount int) time.Duration {
+	if playerCount <= 0 {
+		return unknownQueueTime
+	}
+
+	return min(max(queueTimeScale/time.Duration(playerCount), minQueueTime), maxQueueTime)
+}
+
+// ParseTimeLeft understands the time left formats ChatTriggers sends: "1:23", "83", "83s" or "1m23s"
+func ParseTimeLeft(timeLeft string) (time.Duration, error) {
+	timeLeft = strings.TrimSpace(timeLeft)
+
+	if minutes, seconds, found := strings.Cut(timeLeft, ":"); found {
+		m, err := strconv.Atoi(minutes)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time left \"%s\": %w", timeLeft, err)
+		}
+
+		s, err := strconv.Atoi(seconds)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time left \"%s\": %w", timeLeft, err)
+		}
+
+		return time.Duration(m)*time.Minute + time.Duration(s)*time.Second, nil
+	}
+
+	if seconds, err := strconv.ParseFloat(timeLeft, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	d, err := time.ParseDuration(timeLeft)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time left \"%s\": %w", timeLeft, err)
+	}
+
+	return d, nil
+}
+
+type Recommendation string
+
+const (
+	PlayItOut Recommendation = "play it out"
+	Requeue   Recommendation = "requeue"
+)
+
+type Advice struct {
+	Recommendation Recommendation
+	Justification  string
+	// FasterThan is the fraction of random seeds that are slower than this one
+	FasterThan float64
+	// ExpectedImprovement is how much faster the next seed is expected to be, see SeedDistribution.ExpectedImprovement
+	ExpectedImprovement float64
+	QueueTime           time.Duration
+}
+
+// Advise decides whether a seed is worth playing. Requeueing is worth it when the time a fresh seed is expected
+// to save is more than what the queue costs, which is also the optimal stopping rule when requeueing over and over.
+// timeLeft and playerCount can be 0 when they're unknown
+func Advise(seedTime float64, timeLeft time.Duration, playerCount int, dist *SeedDistribution) Advice {
+	advice := Advice{
+		FasterThan:          dist.FasterThan(seedTime),
+		ExpectedImprovement: dist.ExpectedImprovement(seedTime),
+		QueueTime:           EstimateQueueTime(playerCount),
+	}
+
+	if timeLeft > 0 && timeLeft.Seconds() < seedTime {
+		advice.Recommendation = Requeue
+		advice.Justification = fmt.Sprintf("only %s left, the seed needs at least %s", FormatTime(timeLeft.Seconds()), FormatTime(seedTime))
+		return advice
+	}
+
+	queueCost := advice.QueueTime.Seconds() * queueSecondCost
+
+	players := "player count unknown"
+	if playerCount > 0 {
+		players = fmt.Sprintf("%d players", playerCount)
+	}
+
+	if advice.ExpectedImprovement > queueCost {
+		advice.Recommendation = Requeue
+		advice.Justification = fmt.Sprintf("faster than %.0f%% of seeds, a requeue (~%.0fs queue, %s) is expected to save %.1fs",
+			advice.FasterThan*100, advice.QueueTime.Seconds(), players, advice.ExpectedImprovement)
+	} else {
+		advice.Recommendation = PlayItOut
+		advice.Justification = fmt.Sprintf("faster than %.0f%% of seeds, a requeue (~%.0fs queue, %s) would only save %.1fs",
+			advice.FasterThan*100, advice.QueueTime.Seconds(), players, advice.ExpectedImprovement)
+	}
+
+	return advice
+}
@@ -0,0 +1,71 @@
+package calc_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+)
+
+func TestParseTimeLeft(t *testing.T) {
+	tests := map[string]time.Duration{
+		"1:23":  83 * time.Second,
+		"0:05":  5 * time.Second,
+		"83":    83 * time.Second,
+		"83s":   83 * time.Second,
+		"1m23s": 83 * time.Second,
+	}
+
+	for in, want := range tests {
+		got, err := calc.ParseTimeLeft(in)
+		if err != nil {
+			t.Errorf("ParseTimeLeft(%q): %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseTimeLeft(%q) = %v, want %v", in, got, want)
+		}
+	}
+
+	if _, err := calc.ParseTimeLeft("soon"); err == nil {
+		t.Error("expected an error for an invalid time left")
+	}
+}
+
+func TestAdvise(t *testing.T) {
+	dist, err := calc.SampleDistribution(300, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fast := calc.Advise(100, 0, 300, dist)
+	if fast.Recommendation != calc.PlayItOut {
+		t.Errorf("a 1:40 seed should be played out, got %s (%s)", fast.Recommendation, fast.Justification)
+	}
+	if fast.FasterThan < 0.99 {
+		t.Errorf("a 1:40 seed should be faster than nearly every seed, got %.2f", fast.FasterThan)
+	}
+
+	slow := calc.Advise(200, 0, 300, dist)
+	if slow.Recommendation != calc.Requeue {
+		t.Errorf("a 3:20 seed should be requeued, got %s (%s)", slow.Recommendation, slow.Justification)
+	}
+	if slow.ExpectedImprovement <= fast.ExpectedImprovement {
+		t.Errorf("a slower seed should leave more to improve: %.2f <= %.2f", slow.ExpectedImprovement, fast.ExpectedImprovement)
+	}
+
+	outOfTime := calc.Advise(100, 90*time.Second, 300, dist)
+	if outOfTime.Recommendation != calc.Requeue {
+		t.Errorf("a seed that can't be finished in time should be requeued, got %s", outOfTime.Recommendation)
+	}
+}
+
+func TestEstimateQueueTime(t *testing.T) {
+	if calc.EstimateQueueTime(50) <= calc.EstimateQueueTime(500) {
+		t.Error("fewer players should mean a longer queue")
+	}
+	if calc.EstimateQueueTime(0) <= 0 {
+		t.Error("an unknown player count should still give a queue time")
+	}
+}
@@ -0,0 +1,216 @@
+package calc
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pkd-bot/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultCacheSize = 1024
+	DefaultCacheTTL  = time.Hour
+)
+
+// Results caches the seeds calced through the api and the bot, the same seed gets submitted by every player in its lobby
+var Results = NewResultCache(DefaultCacheSize, DefaultCacheTTL)
+
+// CacheStats counts what a ResultCache did since it was created
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Size is how many seeds are cached right now
+	Size int
+}
+
+type cacheEntry struct {
+	key     string
+	results []CalcSeedResult
+	expires time.Time
+}
+
+// pendingCalc lets concurrent requests for the same seed wait for one calc instead of all doing it
+type pendingCalc struct {
+	done    chan struct{}
+	results []CalcSeedResult
+	err     error
+}
+
+// ResultCache is an LRU cache of calc results that also forgets results after a ttl
+type ResultCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+	calc func(roomList []string, splits map[string]Room) ([]CalcSeedResult, error)
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	pending map[string]*pendingCalc
+	stats   CacheStats
+}
+
+func NewResultCache(size int, ttl time.Duration) *ResultCache {
+	return &ResultCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		calc:    calcSeedInternal,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		pending: make(map[string]*pendingCalc),
+	}
+}
+
+// CalcSeed is CalcSeed through the cache
+func (c *ResultCache) CalcSeed(roomList []string) ([]CalcSeedResult, error) {
+	return c.CalcSeedCustom(roomList, RoomMap)
+}
+
+// CalcSeedCustom is CalcSeedCustom through the cache. The results are shared between callers, so they must not be modified
+func (c *ResultCache) CalcSeedCustom(roomList []string, splits map[string]Room) (results []CalcSeedResult, err error) {
+	// a copy, so the finish room doesn't end up in the caller's array
+	roomList = slices.Clone(roomList)
+	if roomList[len(roomList)-1] != "finish room" {
+		roomList = append(roomList, "finish room")
+	}
+	key := cacheKey(roomList, splits)
+
+	c.mu.Lock()
+	if elem, exists := c.entries[key]; exists {
+		entry := elem.Value.(*cacheEntry)
+		if c.now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			c.stats.Hits++
+			metrics.CalcCacheRequests.WithLabelValues("hit").Inc()
+			c.mu.Unlock()
+			return entry.results, nil
+		}
+
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+
+	if p, exists := c.pending[key]; exists {
+		c.stats.Hits++
+		metrics.CalcCacheRequests.WithLabelValues("hit").Inc()
+		c.mu.Unlock()
+		<-p.done
+		return p.results, p.err
+	}
+
+	c.stats.Misses++
+	metrics.CalcCacheRequests.WithLabelValues("miss").Inc()
+	p := &pendingCalc{done: make(chan struct{})}
+	c.pending[key] = p
+	c.mu.Unlock()
+
+	// the callers waiting for the calc are let go even if it panics, the panic becomes its error
+	defer func() {
+		if r := recover(); r != nil {
+			p.results, p.err = nil, fmt.Errorf("calcing %s panicked: %v", strings.Join(roomList, ", "), r)
+			log.Error(p.err)
+		}
+		results, err = p.results, p.err
+		close(p.done)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		delete(c.pending, key)
+		// errors aren't cached, they come from broken splits which get fixed
+		if p.err == nil {
+			c.add(key, p.results)
+		}
+	}()
+
+	p.results, p.err = c.calc(roomList, splits)
+	return p.results, p.err
+}
+
+// add expects c.mu to be held
+func (c *ResultCache) add(key string, results []CalcSeedResult) {
+	if elem, exists := c.entries[key]; exists {
+		c.lru.Remove(elem)
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, results: results, expires: c.now().Add(c.ttl)})
+
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+		metrics.CalcCacheEvictions.Inc()
+	}
+}
+
+func (c *ResultCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
+
+// cacheKey is the room list and a hash of the parts of the splits the calc looks at, which are only the seed's rooms.
+// Hashing those instead of all the splits keeps the key cheap, and custom splits that only differ in other rooms share results
+func cacheKey(roomList []string, splits map[string]Room) string {
+	h := sha256.New()
+	for _, key := range roomList {
+		writeHashRoom(h, splits[key])
+	}
+
+	return strings.Join(roomList, "|") + "#" + hex.EncodeToString(h.Sum(nil))
+}
+
+// SplitsHash tells splits apart, seeds calced with splits of the same hash have the same results.
+// It's short enough to show, 12 hex digits
+func SplitsHash(splits map[string]Room) string {
+	keys := make([]string, 0, len(splits))
+	for key := range splits {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		writeHashString(h, key)
+		writeHashRoom(h, splits[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+func writeHashRoom(h hash.Hash, room Room) {
+	writeHashString(h, room.Name)
+	writeHashFloat(h, room.BoostlessTime)
+	for _, strat := range room.BoostStrats {
+		writeHashString(h, strat.Name)
+		writeHashFloat(h, strat.Time)
+		writeHashFloat(h, strat.BoostTime)
+	}
+	// separates the rooms, so strats can't be shifted from one room into the next
+	h.Write([]byte{0})
+}
+
+func writeHashString(h hash.Hash, s string) {
+	binary.Write(h, binary.LittleEndian, uint32(len(s)))
+	h.Write([]byte(s))
+}
+
+func writeHashFloat(h hash.Hash, f float64) {
+	binary.Write(h, binary.LittleEndian, math.Float64bits(f))
+}
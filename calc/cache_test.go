@@ -0,0 +1,157 @@
+package calc_test
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+)
+
+var cacheRooms = []string{"around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"}
+
+func TestResultCacheHits(t *testing.T) {
+	cache := calc.NewResultCache(10, time.Hour)
+
+	first, err := cache.CalcSeed(append([]string{}, cacheRooms...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cache.CalcSeed(append(append([]string{}, cacheRooms...), "finish room"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if &first[0] != &second[0] {
+		t.Error("the second calc wasn't served from the cache")
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Size != 1 {
+		t.Errorf("got %+v, want 1 hit, 1 miss and 1 cached seed", stats)
+	}
+
+	uncached, err := calc.CalcSeed(append([]string{}, cacheRooms...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uncached[0].BoostTime != first[0].BoostTime || len(uncached) != len(first) {
+		t.Error("cached results differ from calcing directly")
+	}
+}
+
+func TestResultCacheCustomSplits(t *testing.T) {
+	cache := calc.NewResultCache(10, time.Hour)
+
+	fences := calc.RoomMap["fences"]
+	fences.BoostlessTime += 5
+	custom := calc.MergeSplits(map[string]calc.Room{"fences": fences})
+
+	// splits only differing in rooms the seed doesn't have calc the same
+	unrelated := calc.MergeSplits(map[string]calc.Room{"rng skip": {Name: "rng skip", BoostlessTime: 1}})
+
+	defaults, _ := cache.CalcSeed(append([]string{}, cacheRooms...))
+	slower, _ := cache.CalcSeedCustom(append([]string{}, cacheRooms...), custom)
+	same, _ := cache.CalcSeedCustom(append([]string{}, cacheRooms...), unrelated)
+
+	if slower[0].BoostlessTime != defaults[0].BoostlessTime+5 {
+		t.Errorf("custom splits got the default results, boostless %f vs %f", slower[0].BoostlessTime, defaults[0].BoostlessTime)
+	}
+	if &same[0] != &defaults[0] {
+		t.Error("splits that don't touch the seed's rooms weren't served from the cache")
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("got %+v, want 1 hit and 2 misses", stats)
+	}
+}
+
+func TestResultCacheEviction(t *testing.T) {
+	now := time.Now()
+	cache := calc.NewResultCache(2, time.Minute)
+	cache.SetClock(func() time.Time { return now })
+
+	r := rand.New(rand.NewSource(1))
+	seeds := [][]string{calc.RandomSeed(r), calc.RandomSeed(r), calc.RandomSeed(r)}
+	for _, seed := range seeds {
+		if _, err := cache.CalcSeed(append([]string{}, seed...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Size != 2 {
+		t.Fatalf("got %+v, want 1 eviction and 2 cached seeds", stats)
+	}
+
+	// the first seed was the least recently used
+	cache.CalcSeed(append([]string{}, seeds[0]...))
+	if stats := cache.Stats(); stats.Misses != 4 {
+		t.Errorf("the evicted seed was a hit: %+v", stats)
+	}
+
+	now = now.Add(2 * time.Minute)
+	cache.CalcSeed(append([]string{}, seeds[0]...))
+	if stats := cache.Stats(); stats.Misses != 5 {
+		t.Errorf("an expired seed was a hit: %+v", stats)
+	}
+}
+
+func TestResultCacheConcurrent(t *testing.T) {
+	cache := calc.NewResultCache(10, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.CalcSeed(append([]string{}, cacheRooms...)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stats := cache.Stats(); stats.Misses != 1 || stats.Hits != 19 {
+		t.Errorf("got %+v, want the seed calced once", stats)
+	}
+}
+
+func TestResultCachePanic(t *testing.T) {
+	cache := calc.NewResultCache(10, time.Hour)
+	cache.SetCalc(func([]string, map[string]calc.Room) ([]calc.CalcSeedResult, error) { panic("broken splits") })
+
+	for i := range 2 {
+		if _, err := cache.CalcSeed(append([]string{}, cacheRooms...)); err == nil {
+			t.Fatalf("calc %d: want the panic as the error", i)
+		}
+	}
+
+	cache.SetCalc(calc.CalcSeedCustom)
+	if _, err := cache.CalcSeed(append([]string{}, cacheRooms...)); err != nil {
+		t.Errorf("got %v, want the seed calced once the panic is over", err)
+	}
+}
+
+func TestResultCacheLeavesRoomsAlone(t *testing.T) {
+	cache := calc.NewResultCache(10, time.Hour)
+
+	// room for the finish room in the caller's array
+	rooms := append(make([]string, 0, len(cacheRooms)+1), cacheRooms...)
+	if _, err := cache.CalcSeed(rooms); err != nil {
+		t.Fatal(err)
+	}
+	if rooms[:cap(rooms)][len(rooms)] != "" {
+		t.Errorf("got %q after the rooms, want the caller's array left alone", rooms[:cap(rooms)][len(rooms)])
+	}
+}
+
+func TestSplitsHash(t *testing.T) {
+	hash := calc.SplitsHash(calc.RoomMap)
+	if len(hash) != 12 || calc.SplitsHash(calc.MergeSplits(nil)) != hash {
+		t.Fatalf("got %q, want 12 hex digits that are the same for the same splits", hash)
+	}
+
+	fences := calc.RoomMap["fences"]
+	fences.BoostlessTime += 0.1
+	if calc.SplitsHash(calc.MergeSplits(map[string]calc.Room{"fences": fences})) == hash {
+		t.Error("changed splits have the same hash")
+	}
+}
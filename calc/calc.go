@@ -6,6 +6,9 @@ import (
 	_ "image/png"
 	"slices"
 	"strings"
+	"time"
+
+	"pkd-bot/metrics"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -28,489 +31,543 @@ type BoostRoom struct {
 	Name      string
 	Time      float64
 	BoostTime float64
-	Quality   MoveQuality
+	// Quality is derived by ApplyMoveQualities unless QualityOverride is set
+	Quality         MoveQuality
+	QualityOverride bool
+}
+
+// Segment is the part of a room between two checkpoints
+type Segment struct {
+	Name string
+	// Time is how long the segment takes without a boost
+	Time float64
+	// BoostedTime is how long the segment takes when boosting in it. 0 means the segment isn't boosted
+	BoostedTime float64
+	// BoostAt is when the boost is used relative to the start of the segment.
+	// It can be negative if the boost is used before reaching the checkpoint
+	BoostAt float64
+	// Variants are other ways of boosting in this segment, e.g. salami
+	Variants []SegmentVariant
+
+	Quality         MoveQuality
+	QualityOverride bool
+}
+
+type SegmentVariant struct {
+	Name        string
+	BoostedTime float64
+	BoostAt     float64
+
+	Quality         MoveQuality
+	QualityOverride bool
 }
 
 type Room struct {
-	Name          string
+	Name     string
+	Segments []Segment
+	// BoostlessTime and BoostStrats are derived from Segments by WithDerivedStrats.
+	// Splits without segments (like the ones pkdutils sends) set them directly
 	BoostlessTime float64
 	BoostStrats   []BoostRoom
 }
 
+// WithDerivedStrats returns the room with BoostlessTime and BoostStrats calculated from its segments,
+// with a boost strat for every boosted segment and every variant. Rooms without segments are returned as is
+func (r Room) WithDerivedStrats() Room {
+	if len(r.Segments) == 0 {
+		return r
+	}
+
+	r.BoostlessTime = 0
+	for _, seg := range r.Segments {
+		r.BoostlessTime += seg.Time
+	}
+
+	r.BoostStrats = make([]BoostRoom, 0, len(r.Segments))
+	segmentStart := 0.0
+	for _, seg := range r.Segments {
+		if seg.BoostedTime > 0 {
+			r.BoostStrats = append(r.BoostStrats, BoostRoom{
+				Name:            seg.Name,
+				Time:            r.BoostlessTime - seg.Time + seg.BoostedTime,
+				BoostTime:       segmentStart + seg.BoostAt,
+				Quality:         seg.Quality,
+				QualityOverride: seg.QualityOverride,
+			})
+		}
+
+		for _, variant := range seg.Variants {
+			r.BoostStrats = append(r.BoostStrats, BoostRoom{
+				Name:            fmt.Sprintf("%s + %s", seg.Name, variant.Name),
+				Time:            r.BoostlessTime - seg.Time + variant.BoostedTime,
+				BoostTime:       segmentStart + variant.BoostAt,
+				Quality:         variant.Quality,
+				QualityOverride: variant.QualityOverride,
+			})
+		}
+
+		segmentStart += seg.Time
+	}
+
+	return r
+}
+
 var RoomMap = map[string]Room{
 	"around pillars": {
-		Name:          "Around Pillars",
-		BoostlessTime: 16.9,
-		BoostStrats: []BoostRoom{
+		Name: "Around Pillars",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      10.5,
-				BoostTime: 1.0,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        10.0,
+				BoostedTime: 3.6,
+				BoostAt:     1.0,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      13.0,
-				BoostTime: 10.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        6.9,
+				BoostedTime: 3.0,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"blocks": {
-		Name:          "Blocks",
-		BoostlessTime: 21.3,
-		BoostStrats: []BoostRoom{
+		Name: "Blocks",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      12.0,
-				BoostTime: 3.0,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        16.1,
+				BoostedTime: 6.8,
+				BoostAt:     3.0,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      16.9,
-				BoostTime: 16.1,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        5.2,
+				BoostedTime: 0.8,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"castle wall": {
-		Name:          "Castle Wall",
-		BoostlessTime: 15.7,
-		BoostStrats: []BoostRoom{
+		// cp 1-2 isn't timed on its own, it's part of cp 0-1
+		Name: "Castle Wall",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      9.5,
-				BoostTime: 3.0,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        15.7,
+				BoostedTime: 9.5,
+				BoostAt:     3.0,
 			},
 		},
 	},
 	"tightrope": {
-		Name:          "Tightrope",
-		BoostlessTime: 27.7,
-		BoostStrats: []BoostRoom{
-			{
-				Name:      "cp 0-1",
-				Time:      19.5,
-				BoostTime: 2.0,
-				Quality:   BestMove,
-			},
-			{
-				Name:      "cp 1-2",
-				Time:      17.4,
-				BoostTime: 15.5,
-				Quality:   BestMove,
-			},
-			{
-				Name:      "cp 1-2 + salami",
-				Time:      16.5,
-				BoostTime: 14.5,
-				Quality:   BestMove,
+		Name: "Tightrope",
+		Segments: []Segment{
+			{
+				Name:        "cp 0-1",
+				Time:        15.5,
+				BoostedTime: 7.3,
+				BoostAt:     2.0,
+			},
+			{
+				Name:        "cp 1-2",
+				Time:        12.2,
+				BoostedTime: 1.9,
+				BoostAt:     0.0,
+				Variants: []SegmentVariant{
+					{
+						Name:        "salami",
+						BoostedTime: 1.0,
+						BoostAt:     -1.0,
+					},
+				},
 			},
 		},
 	},
 	"early 3+1": {
-		Name:          "Early 3+1",
-		BoostlessTime: 24.8,
-		BoostStrats: []BoostRoom{
+		Name: "Early 3+1",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      20.5,
-				BoostTime: 1.0,
-				Quality:   BrilliantMove,
+				Name:        "cp 0-1",
+				Time:        11.75,
+				BoostedTime: 7.45,
+				BoostAt:     1.0,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      13.4,
-				BoostTime: 11.75,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        13.05,
+				BoostedTime: 1.65,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"fence squeeze": {
-		Name:          "Fence Squeeze",
-		BoostlessTime: 19.8,
-		BoostStrats: []BoostRoom{
+		Name: "Fence Squeeze",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      11.5,
-				BoostTime: 2.5,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        13.0,
+				BoostedTime: 4.7,
+				BoostAt:     2.5,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      14.3,
-				BoostTime: 13.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        6.8,
+				BoostedTime: 1.3,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"fences": {
-		Name:          "Fences",
-		BoostlessTime: 13.0,
-		BoostStrats: []BoostRoom{
+		Name: "Fences",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      9.5,
-				BoostTime: 2.0,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        8.5,
+				BoostedTime: 5.0,
+				BoostAt:     2.0,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      10.5,
-				BoostTime: 8.5,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        4.5,
+				BoostedTime: 2.0,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"fortress": {
-		Name:          "Fortress",
-		BoostlessTime: 14.6,
-		BoostStrats: []BoostRoom{
+		Name: "Fortress",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      10.5,
-				BoostTime: 3.0,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        7.4,
+				BoostedTime: 3.3,
+				BoostAt:     3.0,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      10.4,
-				BoostTime: 7.4,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        7.2,
+				BoostedTime: 3.0,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"four towers": {
-		Name:          "Four Towers",
-		BoostlessTime: 22.3,
-		BoostStrats: []BoostRoom{
+		Name: "Four Towers",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      13.3,
-				BoostTime: 1.5,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        12.5,
+				BoostedTime: 3.5,
+				BoostAt:     1.5,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      21.5,
-				BoostTime: 12.5,
-				Quality:   BrilliantMove,
+				Name:        "cp 1-2",
+				Time:        3.0,
+				BoostedTime: 2.2,
+				BoostAt:     0.0,
 			},
 			{
-				Name:      "cp 2-3",
-				Time:      18.0,
-				BoostTime: 15.5,
-				Quality:   GreatMove,
+				Name:        "cp 2-3",
+				Time:        6.8,
+				BoostedTime: 2.5,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"ice": {
-		Name:          "Ice",
-		BoostlessTime: 16.7,
-		BoostStrats: []BoostRoom{
+		Name: "Ice",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      14.5,
-				BoostTime: 0.5,
-				Quality:   BrilliantMove,
+				Name:        "cp 0-1",
+				Time:        4.0,
+				BoostedTime: 1.8,
+				BoostAt:     0.5,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      10.1,
-				BoostTime: 4.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        9.0,
+				BoostedTime: 2.4,
+				BoostAt:     0.0,
 			},
 			{
-				Name:      "cp 2-3",
-				Time:      15.0,
-				BoostTime: 13.0,
-				Quality:   GreatMove,
+				Name:        "cp 2-3",
+				Time:        3.7,
+				BoostedTime: 2.0,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"ladder slide": {
-		Name:          "Ladder Slide",
-		BoostlessTime: 22.3,
-		BoostStrats: []BoostRoom{
+		Name: "Ladder Slide",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      15.5,
-				BoostTime: 4.0,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        11.0,
+				BoostedTime: 4.2,
+				BoostAt:     4.0,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      13.0,
-				BoostTime: 11.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        11.3,
+				BoostedTime: 2.0,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"ladder tower": {
-		Name:          "Ladder Tower",
-		BoostlessTime: 24.0,
-		BoostStrats: []BoostRoom{
+		Name: "Ladder Tower",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      12.1,
-				BoostTime: 1.0,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        18.5,
+				BoostedTime: 6.6,
+				BoostAt:     1.0,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      21.0,
-				BoostTime: 18.5,
-				Quality:   BrilliantMove,
+				Name:        "cp 1-2",
+				Time:        5.5,
+				BoostedTime: 2.5,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"overhead 4b": {
-		Name:          "Overhead 4b",
-		BoostlessTime: 23.2,
-		BoostStrats: []BoostRoom{
+		Name: "Overhead 4b",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      18.0,
-				BoostTime: 2.0,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        7.0,
+				BoostedTime: 1.8,
+				BoostAt:     2.0,
 			},
-
 			{
-				Name:      "cp 1-2",
-				Time:      16.0,
-				BoostTime: 7.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        7.3,
+				BoostedTime: 0.1,
+				BoostAt:     0.0,
 			},
 			{
-				Name:      "cp 2-3",
-				Time:      19.0,
-				BoostTime: 14.3,
-				Quality:   BrilliantMove,
+				Name:        "cp 2-3",
+				Time:        8.9,
+				BoostedTime: 4.7,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"quartz climb": {
-		Name:          "Quartz Climb",
-		BoostlessTime: 19.0,
-		BoostStrats: []BoostRoom{
+		Name: "Quartz Climb",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				BoostTime: 1.5,
-				Time:      13.5,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        11.0,
+				BoostedTime: 5.5,
+				BoostAt:     1.5,
 			},
 			{
-				Name:      "cp 1-2",
-				BoostTime: 11.0,
-				Time:      13.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        8.0,
+				BoostedTime: 2.0,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"quartz temple": {
-		Name:          "Quartz Temple",
-		BoostlessTime: 16.00,
-		BoostStrats: []BoostRoom{
+		Name: "Quartz Temple",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      8.0,
-				BoostTime: 1,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        10.0,
+				BoostedTime: 2.0,
+				BoostAt:     1.0,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      14.0,
-				BoostTime: 10.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        6.0,
+				BoostedTime: 4.0,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"rng skip": {
-		Name:          "Rng Skip",
-		BoostlessTime: 11.7,
-		BoostStrats: []BoostRoom{
+		Name: "Rng Skip",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      7.5,
-				BoostTime: 2.0,
-				Quality:   GreatMove,
+				Name:        "cp 0-1",
+				Time:        6.0,
+				BoostedTime: 1.8,
+				BoostAt:     2.0,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      8.1,
-				BoostTime: 6,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        5.7,
+				BoostedTime: 2.1,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"sandpit": {
 		// 13.5 15.5
-		Name:          "Sandpit",
-		BoostlessTime: 33.8,
-		BoostStrats: []BoostRoom{
+		Name: "Sandpit",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      23.8,
-				BoostTime: 1.5,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        13.5,
+				BoostedTime: 3.5,
+				BoostAt:     1.5,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      22.8,
-				BoostTime: 13.5,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        15.5,
+				BoostedTime: 4.5,
+				BoostAt:     0.0,
 			},
 			{
-				Name:      "cp 2-3",
-				Time:      31.0,
-				BoostTime: 29.0,
-				Quality:   BrilliantMove,
+				Name:        "cp 2-3",
+				Time:        4.8,
+				BoostedTime: 2.0,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"scatter": {
-		Name:          "Scatter",
-		BoostlessTime: 18.2,
-		BoostStrats: []BoostRoom{
+		Name: "Scatter",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      13.0,
-				BoostTime: 3.5,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        10.0,
+				BoostedTime: 4.8,
+				BoostAt:     3.5,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      12.5,
-				BoostTime: 10.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        8.2,
+				BoostedTime: 2.5,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"slime scatter": {
-		Name:          "Slime Scatter",
-		BoostlessTime: 19.9,
-		BoostStrats: []BoostRoom{
+		// cp 1-2 isn't timed on its own, it's part of cp 0-1
+		Name: "Slime Scatter",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      14.8,
-				BoostTime: 1.5,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        13.5,
+				BoostedTime: 8.4,
+				BoostAt:     1.5,
 			},
 			{
-				Name:      "cp 2-3",
-				Time:      15.6,
-				BoostTime: 13.5,
-				Quality:   BrilliantMove,
+				Name:        "cp 2-3",
+				Time:        6.4,
+				BoostedTime: 2.1,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"slime skip": {
-		Name:          "Slime Skip",
-		BoostlessTime: 15.5,
-		BoostStrats: []BoostRoom{
+		Name: "Slime Skip",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      7.0,
-				BoostTime: 2.9,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        10.0,
+				BoostedTime: 1.5,
+				BoostAt:     2.9,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      12.5,
-				BoostTime: 10.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        5.5,
+				BoostedTime: 2.5,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"tower tightrope": {
-		Name:          "Tower Tightrope",
-		BoostlessTime: 22.20,
-		BoostStrats: []BoostRoom{
+		Name: "Tower Tightrope",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      10.0,
-				BoostTime: 1.5,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        17.5,
+				BoostedTime: 5.3,
+				BoostAt:     1.5,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      20.0,
-				BoostTime: 17.5,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        4.7,
+				BoostedTime: 2.5,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"triple platform": {
-		Name:          "Triple Platform",
-		BoostlessTime: 18.3,
-		BoostStrats: []BoostRoom{
+		Name: "Triple Platform",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      9.0,
-				BoostTime: 2.0,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        14.0,
+				BoostedTime: 4.7,
+				BoostAt:     2.0,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      16.5,
-				BoostTime: 14.0,
-				Quality:   BrilliantMove,
+				Name:        "cp 1-2",
+				Time:        4.3,
+				BoostedTime: 2.5,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"triple trapdoors": {
-		Name:          "Triple Trapdoors",
-		BoostlessTime: 17.7,
-		BoostStrats: []BoostRoom{
+		Name: "Triple Trapdoors",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      12.5,
-				BoostTime: 3.0,
-				Quality:   BestMove,
+				Name:        "cp 0-1",
+				Time:        10.0,
+				BoostedTime: 4.8,
+				BoostAt:     3.0,
 			},
-
 			{
-				Name:      "cp 1-2",
-				Time:      11.5,
-				BoostTime: 10.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        7.7,
+				BoostedTime: 1.5,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"underbridge": {
-		Name:          "Underbridge",
-		BoostlessTime: 23.4,
-		BoostStrats: []BoostRoom{
+		Name: "Underbridge",
+		Segments: []Segment{
 			{
-				Name:      "cp 0-1",
-				Time:      19.5,
-				BoostTime: 2.5,
-				Quality:   BrilliantMove,
+				Name:        "cp 0-1",
+				Time:        8.0,
+				BoostedTime: 4.1,
+				BoostAt:     2.5,
 			},
 			{
-				Name:      "cp 1-2",
-				Time:      9.8,
-				BoostTime: 8.0,
-				Quality:   BestMove,
+				Name:        "cp 1-2",
+				Time:        15.4,
+				BoostedTime: 1.8,
+				BoostAt:     0.0,
 			},
 		},
 	},
 	"finish room": {
-		Name:          "Finish Room",
-		BoostlessTime: 4.4,
-		BoostStrats: []BoostRoom{
+		Name: "Finish Room",
+		Segments: []Segment{
 			{
-				Name:      "lol",
-				Time:      2.9,
-				BoostTime: 0.5,
-				Quality:   BestMove,
+				Name:        "lol",
+				Time:        4.4,
+				BoostedTime: 2.9,
+				BoostAt:     0.5,
 			},
 		},
 	},
 }
 
+func init() {
+	for key, room := range RoomMap {
+		RoomMap[key] = room.WithDerivedStrats()
+	}
+}
+
 func GetRooms() []string {
 	res := make([]string, len(RoomMap)-1)
 	i := 0
@@ -526,6 +583,59 @@ func GetRooms() []string {
 	return res
 }
 
+// CheckSplits returns an error if splits can't be calced with, e.g. when a room is missing its times
+func CheckSplits(splits map[string]Room) error {
+	if _, exists := splits["finish room"]; !exists {
+		return fmt.Errorf("the finish room is missing")
+	}
+	if len(splits) < 9 {
+		return fmt.Errorf("there are only %d rooms, a seed needs 8 and the finish room", len(splits))
+	}
+
+	for key, room := range splits {
+		if room.BoostlessTime <= 0 {
+			return fmt.Errorf("%s doesn't have a boostless time", key)
+		}
+		for _, strat := range room.BoostStrats {
+			if strat.Time <= 0 {
+				return fmt.Errorf("%s's %s strat doesn't have a time", key, strat.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RoomAliases maps other names rooms go by, like the ChatTriggers module's, to RoomMap keys
+var RoomAliases = map[string]string{
+	"early 3-1": "early 3+1",
+	"glass neo": "rng skip",
+}
+
+// ResolveRoom finds the RoomMap key for a room name or alias, ignoring case
+func ResolveRoom(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if key, exists := RoomAliases[name]; exists {
+		name = key
+	}
+
+	_, exists := RoomMap[name]
+	return name, exists
+}
+
+// AliasesOf lists the aliases of a room key, sorted
+func AliasesOf(key string) []string {
+	aliases := make([]string, 0)
+	for alias, k := range RoomAliases {
+		if k == key {
+			aliases = append(aliases, alias)
+		}
+	}
+	slices.Sort(aliases)
+
+	return aliases
+}
+
 func calcBoostless(roomList []string, splits map[string]Room) float64 {
 	time := 0.0
 	for _, room := range roomList {
@@ -548,53 +658,79 @@ type calcResult struct {
 	boostRooms []CalcResultBoost
 }
 
-const (
-	roomOneTimesave float64 = 0.3
-	early31Timesave float64 = 0.5
-	ibTimesave      float64 = 0.1
-	ubTimesave      float64 = 0.2
-	ftTimesave      float64 = 0.2
-)
+// TimesaveRule takes Timesave off the room right after the After room.
+// Rules with Boosted set only apply when After is boosted with its StratInd-th strat
+type TimesaveRule struct {
+	Name string
+	// After is a room key, an empty After means the rule applies to the first room
+	After    string
+	Boosted  bool
+	StratInd int
+	Timesave float64
+}
+
+var TimesaveRules = []TimesaveRule{
+	{Name: "accounting for r1", Timesave: 0.3},
+	{Name: "early 3+1 boost timesave", After: "early 3+1", Boosted: true, StratInd: 1, Timesave: 0.5},
+	{Name: "four towers timesave", After: "four towers", Timesave: 0.2},
+	{Name: "ib hh", After: "sandpit", Timesave: 0.1},
+	{Name: "ib hh", After: "castle wall", Timesave: 0.1},
+	{Name: "underbridge boost timesave", After: "underbridge", Boosted: true, StratInd: 1, Timesave: 0.2},
+}
 
 func calcTimesave(roomList []string, boostStrat []CalcResultBoost, splits map[string]Room) float64 {
 	totalTimesave := 0.0
 
-	totalTimesave += roomOneTimesave
+	for i := range roomList {
+		totalTimesave += roomTimesave(roomList, i, boostStrat, splits)
+	}
 
-	for i := 1; i < len(roomList); i++ {
-		prevRoomName := splits[roomList[i-1]].Name
-		currentTimesave := 0.0
+	return totalTimesave
+}
 
-		if strings.ToLower(prevRoomName) == "early 3+1" {
-			for _, boost := range boostStrat {
-				if boost.Ind == i-1 && boost.StratInd == 1 {
-					currentTimesave += early31Timesave
-					break
-				}
-			}
+// roomTimesave is the time saved in the i-th room, which mostly depends on the room before it
+func roomTimesave(roomList []string, i int, boostStrat []CalcResultBoost, splits map[string]Room) float64 {
+	currentTimesave := 0.0
+	for _, rule := range TimesaveRules {
+		if rule.applies(roomList, i, boostStrat, splits) {
+			currentTimesave += rule.Timesave
 		}
+	}
 
-		if strings.ToLower(prevRoomName) == "four towers" {
-			currentTimesave += ftTimesave
-		}
+	return currentTimesave
+}
 
-		if strings.ToLower(prevRoomName) == "sandpit" || strings.ToLower(prevRoomName) == "castle wall" {
-			currentTimesave += ibTimesave
+// AppliedTimesaves lists the TimesaveRules that apply to the i-th room
+func AppliedTimesaves(roomList []string, i int, boostStrat []CalcResultBoost, splits map[string]Room) []TimesaveRule {
+	var applied []TimesaveRule
+	for _, rule := range TimesaveRules {
+		if rule.applies(roomList, i, boostStrat, splits) {
+			applied = append(applied, rule)
 		}
+	}
 
-		if strings.ToLower(prevRoomName) == "underbridge" {
-			for _, boost := range boostStrat {
-				if boost.Ind == i-1 && boost.StratInd == 1 {
-					currentTimesave += ubTimesave
-					break
-				}
-			}
-		}
+	return applied
+}
 
-		totalTimesave += currentTimesave
+func (rule TimesaveRule) applies(roomList []string, i int, boostStrat []CalcResultBoost, splits map[string]Room) bool {
+	if rule.After == "" || i == 0 {
+		return rule.After == "" && i == 0
 	}
 
-	return totalTimesave
+	if strings.ToLower(splits[roomList[i-1]].Name) != rule.After {
+		return false
+	}
+
+	if !rule.Boosted {
+		return true
+	}
+
+	for _, boost := range boostStrat {
+		if boost.Ind == i-1 && boost.StratInd == rule.StratInd {
+			return true
+		}
+	}
+	return false
 }
 
 func calcTwoBoost(roomList []string, splits map[string]Room) ([]calcResult, error) {
@@ -759,6 +895,8 @@ func mergeSortedResults(a, b []calcResult) []calcResult {
 }
 
 func calcSeedInternal(roomList []string, splits map[string]Room) ([]CalcSeedResult, error) {
+	defer metrics.ObserveCalc(time.Now())
+
 	boostlessTime := calcBoostless(roomList, splits)
 	boostlessTime -= calcTimesave(roomList, nil, splits)
 
@@ -817,3 +955,29 @@ func CalcSeedCustom(roomList []string, splits map[string]Room) ([]CalcSeedResult
 
 	return calcSeedInternal(roomList, splits)
 }
+
+// FilterByBoosts keeps the results that boost exactly boosts times, 0 keeps all of them
+func FilterByBoosts(results []CalcSeedResult, boosts int) []CalcSeedResult {
+	if boosts == 0 {
+		return results
+	}
+
+	filtered := make([]CalcSeedResult, 0)
+	for _, result := range results {
+		if len(result.BoostRooms) == boosts {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// FormatTime formats seconds as m:ss.s, or just s.s under a minute
+func FormatTime(seconds float64) string {
+	minutes := int(seconds) / 60
+	remainingSeconds := seconds - float64(minutes*60)
+
+	if minutes > 0 {
+		return fmt.Sprintf("%d:%04.1f", minutes, remainingSeconds)
+	}
+	return fmt.Sprintf("%.1f", remainingSeconds)
+}
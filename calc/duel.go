@@ -0,0 +1,120 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PlanSplits returns the time after each room of roomList when playing result with splits.
+// The last element is the same as result.BoostTime
+func PlanSplits(roomList []string, result CalcSeedResult, splits map[string]Room) []float64 {
+	if roomList[len(roomList)-1] != "finish room" {
+		roomList = append(roomList, "finish room")
+	}
+
+	boosts := make(map[int]CalcResultBoost, len(result.BoostRooms))
+	for _, boost := range result.BoostRooms {
+		boosts[boost.Ind] = boost
+	}
+
+	cumulative := make([]float64, len(roomList))
+	total := 0.0
+	for i, room := range roomList {
+		if boost, isBoost := boosts[i]; isBoost {
+			total += splits[room].BoostStrats[boost.StratInd].Time + boost.Pacelock
+		} else {
+			total += splits[room].BoostlessTime
+		}
+
+		total -= roomTimesave(roomList, i, result.BoostRooms, splits)
+		cumulative[i] = total
+	}
+
+	return cumulative
+}
+
+type DuelPlayer struct {
+	Result CalcSeedResult
+	// Splits is the time after each room, see PlanSplits
+	Splits []float64
+}
+
+type DuelResult struct {
+	Rooms   []string
+	Players [2]DuelPlayer
+	// Winner is the index of the faster player, or -1 if they tie
+	Winner int
+	Margin float64
+	// LeadChanges are the indices of the rooms after which a different player is ahead
+	LeadChanges []int
+}
+
+// Duel plays the best plan of both players on the same seed against each other.
+// Rooms missing from a player's splits fall back to RoomMap
+func Duel(roomList []string, first, second map[string]Room) (DuelResult, error) {
+	if roomList[len(roomList)-1] != "finish room" {
+		roomList = append(roomList, "finish room")
+	}
+
+	res := DuelResult{
+		Rooms:  roomList,
+		Winner: -1,
+	}
+
+	for p, splits := range []map[string]Room{first, second} {
+		merged := make(map[string]Room, len(roomList))
+		for _, room := range roomList {
+			if custom, exists := splits[room]; exists {
+				merged[room] = custom.WithDerivedStrats()
+			} else {
+				merged[room] = RoomMap[room]
+			}
+		}
+
+		results, err := CalcSeedCustom(roomList, merged)
+		if err != nil {
+			err = fmt.Errorf("failed to calc the seed for player %d: %w", p+1, err)
+			log.Warn(err)
+			return DuelResult{}, err
+		}
+
+		res.Players[p] = DuelPlayer{
+			Result: results[0],
+			Splits: PlanSplits(roomList, results[0], merged),
+		}
+	}
+
+	leader := -1
+	for i := range roomList {
+		current := duelLeader(res.Players[0].Splits[i], res.Players[1].Splits[i])
+		if current == -1 {
+			continue
+		}
+
+		if leader != -1 && current != leader {
+			res.LeadChanges = append(res.LeadChanges, i)
+		}
+		leader = current
+	}
+
+	firstTime := res.Players[0].Result.BoostTime
+	secondTime := res.Players[1].Result.BoostTime
+	res.Winner = duelLeader(firstTime, secondTime)
+	res.Margin = math.Abs(firstTime - secondTime)
+
+	return res, nil
+}
+
+// duelLeader is the index of the lower time, -1 when they're (practically) equal
+func duelLeader(first, second float64) int {
+	if math.Abs(first-second) < 1e-6 {
+		return -1
+	}
+
+	if first < second {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,65 @@
+package calc_test
+
+import (
+	"math"
+	"testing"
+
+	"pkd-bot/calc"
+)
+
+func TestPlanSplitsAddUpToBoostTime(t *testing.T) {
+	rooms := []string{"around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"}
+	results, err := calc.CalcSeed(append([]string{}, rooms...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, res := range results[:20] {
+		splits := calc.PlanSplits(append([]string{}, rooms...), res, calc.RoomMap)
+		if math.Abs(splits[len(splits)-1]-res.BoostTime) > 1e-6 {
+			t.Errorf("splits end at %f, expected %f for %+v", splits[len(splits)-1], res.BoostTime, res.BoostRooms)
+		}
+	}
+}
+
+func TestDuel(t *testing.T) {
+	rooms := []string{"around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "ladder tower", "sandpit"}
+
+	// the second player is slower everywhere but much faster in sandpit, the last room
+	slow := make(map[string]calc.Room)
+	for _, room := range rooms {
+		r := calc.RoomMap[room]
+		r.Segments = nil
+		r.BoostlessTime += 0.5
+		r.BoostStrats = append([]calc.BoostRoom{}, r.BoostStrats...)
+		for i := range r.BoostStrats {
+			r.BoostStrats[i].Time += 0.5
+		}
+
+		if room == "sandpit" {
+			r.BoostlessTime -= 10
+			for i := range r.BoostStrats {
+				r.BoostStrats[i].Time -= 10
+			}
+		}
+		slow[room] = r
+	}
+
+	duel, err := calc.Duel(append([]string{}, rooms...), calc.RoomMap, slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if duel.Winner != 1 {
+		t.Errorf("expected the second player to win, got %d", duel.Winner)
+	}
+
+	expectedMargin := duel.Players[0].Result.BoostTime - duel.Players[1].Result.BoostTime
+	if math.Abs(duel.Margin-expectedMargin) > 1e-9 {
+		t.Errorf("expected margin %f, got %f", expectedMargin, duel.Margin)
+	}
+
+	if len(duel.LeadChanges) != 1 || duel.Rooms[duel.LeadChanges[0]] != "sandpit" {
+		t.Errorf("expected the lead to change in sandpit, got %v", duel.LeadChanges)
+	}
+}
@@ -0,0 +1,97 @@
+package calc
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RoomExplanation is how a single room adds up to a plan's time
+type RoomExplanation struct {
+	Index int
+	Room  string
+	Name  string
+
+	BoostlessTime float64
+	Boosted       bool
+	Strat         string
+	// BeforeBoost and AfterBoost split the strat's time at the boost, they're only set for boosted rooms
+	BeforeBoost float64
+	AfterBoost  float64
+	Pacelock    float64
+
+	// Timesave is subtracted from the room in the plan, BoostlessTimesave in the boostless run
+	Timesave          float64
+	BoostlessTimesave float64
+
+	// Time is what the room takes in the plan, BoostlessRunTime what it takes without boosting anywhere
+	Time             float64
+	BoostlessRunTime float64
+}
+
+type Explanation struct {
+	Rooms         []RoomExplanation
+	BoostTime     float64
+	BoostlessTime float64
+}
+
+// Explain breaks result down room by room. roomList has to be the one result was calced for
+func Explain(roomList []string, result CalcSeedResult, splits map[string]Room) (Explanation, error) {
+	if roomList[len(roomList)-1] != "finish room" {
+		roomList = append(roomList, "finish room")
+	}
+
+	boosts := make(map[int]CalcResultBoost, len(result.BoostRooms))
+	for _, br := range result.BoostRooms {
+		if br.Ind < 0 || br.Ind >= len(roomList) {
+			err := fmt.Errorf("boost room index %d is out of range", br.Ind)
+			log.Warn(err)
+			return Explanation{}, err
+		}
+		boosts[br.Ind] = br
+	}
+
+	exp := Explanation{Rooms: make([]RoomExplanation, 0, len(roomList))}
+	for i, key := range roomList {
+		room, exists := splits[key]
+		if !exists {
+			err := fmt.Errorf("unknown room \"%s\"", key)
+			log.Warn(err)
+			return Explanation{}, err
+		}
+
+		re := RoomExplanation{
+			Index:             i,
+			Room:              key,
+			Name:              room.Name,
+			BoostlessTime:     room.BoostlessTime,
+			Timesave:          roomTimesave(roomList, i, result.BoostRooms, splits),
+			BoostlessTimesave: roomTimesave(roomList, i, nil, splits),
+		}
+
+		re.Time = room.BoostlessTime
+		if br, isBoost := boosts[i]; isBoost {
+			if br.StratInd < 0 || br.StratInd >= len(room.BoostStrats) {
+				err := fmt.Errorf("%s doesn't have a boost strat %d", room.Name, br.StratInd)
+				log.Warn(err)
+				return Explanation{}, err
+			}
+
+			strat := room.BoostStrats[br.StratInd]
+			re.Boosted = true
+			re.Strat = strat.Name
+			re.BeforeBoost = strat.BoostTime
+			re.AfterBoost = strat.Time - strat.BoostTime
+			re.Pacelock = br.Pacelock
+			re.Time = strat.Time + br.Pacelock
+		}
+		re.Time -= re.Timesave
+		re.BoostlessRunTime = re.BoostlessTime - re.BoostlessTimesave
+
+		exp.BoostTime += re.Time
+		exp.BoostlessTime += re.BoostlessRunTime
+		exp.Rooms = append(exp.Rooms, re)
+	}
+
+	return exp, nil
+}
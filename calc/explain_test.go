@@ -0,0 +1,39 @@
+package calc_test
+
+import (
+	"math"
+	"testing"
+
+	"pkd-bot/calc"
+)
+
+func TestExplainAddsUp(t *testing.T) {
+	seeds := [][]string{
+		{"around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"},
+		{"four towers", "castle wall", "early 3+1", "ladder tower", "underbridge", "ice", "blocks", "fences"},
+	}
+
+	for _, rooms := range seeds {
+		results, err := calc.CalcSeed(append([]string{}, rooms...))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, res := range results[:min(len(results), 10)] {
+			exp, err := calc.Explain(append([]string{}, rooms...), res, calc.RoomMap)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(exp.Rooms) != len(rooms)+1 {
+				t.Errorf("expected %d rooms, got %d", len(rooms)+1, len(exp.Rooms))
+			}
+			if math.Abs(exp.BoostTime-res.BoostTime) > 1e-6 {
+				t.Errorf("%v: explained boost time %.3f, calc says %.3f", rooms, exp.BoostTime, res.BoostTime)
+			}
+			if math.Abs(exp.BoostlessTime-res.BoostlessTime) > 1e-6 {
+				t.Errorf("%v: explained boostless time %.3f, calc says %.3f", rooms, exp.BoostlessTime, res.BoostlessTime)
+			}
+		}
+	}
+}
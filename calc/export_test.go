@@ -1,6 +1,16 @@
 package calc
 
+import "time"
+
 var (
 	CalcTwoBoost   = calcTwoBoost
 	CalcThreeBoost = calcThreeBoost
 )
+
+func (c *ResultCache) SetClock(now func() time.Time) {
+	c.now = now
+}
+
+func (c *ResultCache) SetCalc(calc func(roomList []string, splits map[string]Room) ([]CalcSeedResult, error)) {
+	c.calc = calc
+}
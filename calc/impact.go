@@ -0,0 +1,322 @@
+package calc
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultAnnouncementThreshold is the boost time (in seconds) under which a seed is good enough to be announced,
+// unless the config says otherwise
+const DefaultAnnouncementThreshold float64 = 130
+
+const impactBucketWidth float64 = 0.5
+
+// how many random seeds SplitImpact checks, unless asked for another number up to MaxImpactSamples
+const (
+	DefaultImpactSamples = 2000
+	MaxImpactSamples     = 10000
+)
+
+// RandomSeed rolls 8 distinct rooms the same way a PKD game does. Finish room is not included
+func RandomSeed(r *rand.Rand) []string {
+	rooms := GetRooms()
+	slices.Sort(rooms)
+	r.Shuffle(len(rooms), func(i, j int) {
+		rooms[i], rooms[j] = rooms[j], rooms[i]
+	})
+
+	return slices.Clip(rooms[:8])
+}
+
+// LoadSplits decodes splits in the RoomMap shape and checks them laid over RoomMap. Room keys are lowercased so they
+// match RoomMap keys
+func LoadSplits(r io.Reader) (map[string]Room, error) {
+	var raw map[string]Room
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		err = fmt.Errorf("failed to decode splits: %w", err)
+		log.Warn(err)
+		return nil, err
+	}
+
+	if len(raw) == 0 {
+		err := fmt.Errorf("splits file doesn't contain any rooms")
+		log.Warn(err)
+		return nil, err
+	}
+
+	splits := make(map[string]Room, len(raw))
+	for key, room := range raw {
+		key = strings.ToLower(key)
+		if _, exists := RoomMap[key]; !exists {
+			err := fmt.Errorf("unknown room \"%s\" in splits", key)
+			log.Warn(err)
+			return nil, err
+		}
+
+		if room.Name == "" {
+			room.Name = RoomMap[key].Name
+		}
+		splits[key] = room.WithDerivedStrats()
+	}
+
+	if err := CheckSplits(MergeSplits(splits)); err != nil {
+		err = fmt.Errorf("invalid splits: %w", err)
+		log.Warn(err)
+		return nil, err
+	}
+
+	return splits, nil
+}
+
+// MergeSplits lays custom splits over RoomMap, so every room the custom splits don't have keeps its RoomMap splits
+func MergeSplits(custom map[string]Room) map[string]Room {
+	merged := make(map[string]Room, len(RoomMap))
+	for key, room := range RoomMap {
+		merged[key] = room
+	}
+	for key, room := range custom {
+		merged[key] = room
+	}
+
+	return merged
+}
+
+type ImpactSeed struct {
+	Rooms            []string
+	CurrentTime      float64
+	CandidateTime    float64
+	CurrentBoosts    []CalcResultBoost
+	CandidateBoosts  []CalcResultBoost
+	PlacementFlipped bool
+}
+
+func (s ImpactSeed) Delta() float64 {
+	return s.CandidateTime - s.CurrentTime
+}
+
+type ImpactBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+type ImpactReport struct {
+	Samples   int     `json:"samples"`
+	Threshold float64 `json:"threshold"`
+
+	MeanDelta   float64        `json:"mean_delta"`
+	MedianDelta float64        `json:"median_delta"`
+	MinDelta    float64        `json:"min_delta"`
+	MaxDelta    float64        `json:"max_delta"`
+	Histogram   []ImpactBucket `json:"histogram"`
+
+	Flipped int `json:"flipped"`
+
+	CurrentUnderThreshold   int `json:"current_under_threshold"`
+	CandidateUnderThreshold int `json:"candidate_under_threshold"`
+	// Gained are seeds that only get announced with the candidate splits, Lost are the other way around
+	Gained int `json:"gained"`
+	Lost   int `json:"lost"`
+
+	Seeds []ImpactSeed `json:"-"`
+	// splits are kept around to name the boost strats in the CSV
+	candidate map[string]Room
+}
+
+// SplitImpact calculates a sample of random seeds with both RoomMap and the candidate splits.
+// Rooms missing from candidate fall back to RoomMap, so a partial splits file is fine. It stops when ctx is done
+func SplitImpact(ctx context.Context, candidate map[string]Room, samples int, threshold float64, r *rand.Rand) (ImpactReport, error) {
+	if samples <= 0 {
+		err := fmt.Errorf("sample size has to be positive, got %d", samples)
+		log.Warn(err)
+		return ImpactReport{}, err
+	}
+
+	merged := MergeSplits(candidate)
+
+	report := ImpactReport{
+		Samples:   samples,
+		Threshold: threshold,
+		Seeds:     make([]ImpactSeed, 0, samples),
+		candidate: merged,
+	}
+
+	for n := 0; n < samples; n++ {
+		if err := ctx.Err(); err != nil {
+			return ImpactReport{}, fmt.Errorf("split impact stopped after %d of %d samples: %w", n, samples, err)
+		}
+
+		rooms := RandomSeed(r)
+
+		current, err := CalcSeed(rooms)
+		if err != nil {
+			log.Warn(err)
+			return ImpactReport{}, err
+		}
+
+		proposed, err := CalcSeedCustom(rooms, merged)
+		if err != nil {
+			log.Warn(err)
+			return ImpactReport{}, err
+		}
+
+		seed := ImpactSeed{
+			Rooms:           rooms,
+			CurrentTime:     current[0].BoostTime,
+			CandidateTime:   proposed[0].BoostTime,
+			CurrentBoosts:   current[0].BoostRooms,
+			CandidateBoosts: proposed[0].BoostRooms,
+		}
+		seed.PlacementFlipped = !samePlacement(rooms, seed.CurrentBoosts, RoomMap, seed.CandidateBoosts, merged)
+
+		if seed.PlacementFlipped {
+			report.Flipped++
+		}
+
+		currentAnnounced := seed.CurrentTime < threshold
+		candidateAnnounced := seed.CandidateTime < threshold
+		if currentAnnounced {
+			report.CurrentUnderThreshold++
+		}
+		if candidateAnnounced {
+			report.CandidateUnderThreshold++
+		}
+		if candidateAnnounced && !currentAnnounced {
+			report.Gained++
+		}
+		if currentAnnounced && !candidateAnnounced {
+			report.Lost++
+		}
+
+		report.Seeds = append(report.Seeds, seed)
+	}
+
+	deltas := make([]float64, len(report.Seeds))
+	sum := 0.0
+	for i, seed := range report.Seeds {
+		deltas[i] = seed.Delta()
+		sum += deltas[i]
+	}
+	slices.Sort(deltas)
+
+	report.MeanDelta = sum / float64(len(deltas))
+	report.MinDelta = deltas[0]
+	report.MaxDelta = deltas[len(deltas)-1]
+	if len(deltas)%2 == 0 {
+		report.MedianDelta = (deltas[len(deltas)/2-1] + deltas[len(deltas)/2]) / 2
+	} else {
+		report.MedianDelta = deltas[len(deltas)/2]
+	}
+	report.Histogram = buildHistogram(deltas)
+
+	return report, nil
+}
+
+// samePlacement compares boost placements by room and strat name, since the candidate splits can reorder strats
+func samePlacement(rooms []string, a []CalcResultBoost, aSplits map[string]Room, b []CalcResultBoost, bSplits map[string]Room) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Ind != b[i].Ind {
+			return false
+		}
+
+		if stratName(rooms, a[i], aSplits) != stratName(rooms, b[i], bSplits) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func stratName(rooms []string, boost CalcResultBoost, splits map[string]Room) string {
+	room := "finish room"
+	if boost.Ind < len(rooms) {
+		room = rooms[boost.Ind]
+	}
+
+	strats := splits[room].BoostStrats
+	if boost.StratInd >= len(strats) {
+		return ""
+	}
+
+	return strats[boost.StratInd].Name
+}
+
+// FormatBoosts describes a boost placement as "Room (strat), Room (strat)"
+func FormatBoosts(rooms []string, boosts []CalcResultBoost, splits map[string]Room) string {
+	parts := make([]string, 0, len(boosts))
+	for _, boost := range boosts {
+		room := "finish room"
+		if boost.Ind < len(rooms) {
+			room = rooms[boost.Ind]
+		}
+
+		parts = append(parts, fmt.Sprintf("%s (%s)", splits[room].Name, stratName(rooms, boost, splits)))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func buildHistogram(sortedDeltas []float64) []ImpactBucket {
+	from := math.Floor(sortedDeltas[0]/impactBucketWidth) * impactBucketWidth
+	to := math.Floor(sortedDeltas[len(sortedDeltas)-1]/impactBucketWidth)*impactBucketWidth + impactBucketWidth
+
+	buckets := make([]ImpactBucket, 0, int((to-from)/impactBucketWidth)+1)
+	for start := from; start < to-1e-9; start += impactBucketWidth {
+		buckets = append(buckets, ImpactBucket{From: start, To: start + impactBucketWidth})
+	}
+
+	for _, delta := range sortedDeltas {
+		ind := int(math.Floor((delta - from) / impactBucketWidth))
+		ind = min(max(ind, 0), len(buckets)-1)
+		buckets[ind].Count++
+	}
+
+	return buckets
+}
+
+// WriteCSV writes one row per sampled seed
+func (r ImpactReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"rooms", "current_time", "candidate_time", "delta", "current_boosts", "candidate_boosts", "placement_flipped", "current_announced", "candidate_announced"}
+	if err := writer.Write(header); err != nil {
+		log.Warn(err)
+		return err
+	}
+
+	for _, seed := range r.Seeds {
+		row := []string{
+			strings.Join(seed.Rooms, "|"),
+			strconv.FormatFloat(seed.CurrentTime, 'f', 2, 64),
+			strconv.FormatFloat(seed.CandidateTime, 'f', 2, 64),
+			strconv.FormatFloat(seed.Delta(), 'f', 2, 64),
+			FormatBoosts(seed.Rooms, seed.CurrentBoosts, RoomMap),
+			FormatBoosts(seed.Rooms, seed.CandidateBoosts, r.candidate),
+			strconv.FormatBool(seed.PlacementFlipped),
+			strconv.FormatBool(seed.CurrentTime < r.Threshold),
+			strconv.FormatBool(seed.CandidateTime < r.Threshold),
+		}
+
+		if err := writer.Write(row); err != nil {
+			log.Warn(err)
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,77 @@
+package calc_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"pkd-bot/calc"
+)
+
+func TestSplitImpactUnchangedSplits(t *testing.T) {
+	report, err := calc.SplitImpact(context.Background(), calc.RoomMap, 200, calc.DefaultAnnouncementThreshold, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Flipped != 0 || report.Gained != 0 || report.Lost != 0 {
+		t.Errorf("expected no changes with identical splits, got %+v", report)
+	}
+
+	if math.Abs(report.MinDelta) > 1e-9 || math.Abs(report.MaxDelta) > 1e-9 {
+		t.Errorf("expected zero deltas, got min %f max %f", report.MinDelta, report.MaxDelta)
+	}
+}
+
+func TestSplitImpactSlowerRoom(t *testing.T) {
+	fences := calc.RoomMap["fences"]
+	fences.BoostlessTime += 5
+
+	candidate := map[string]calc.Room{"fences": fences}
+	report, err := calc.SplitImpact(context.Background(), candidate, 200, calc.DefaultAnnouncementThreshold, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.MinDelta < -1e-9 {
+		t.Errorf("a slower room can't make a seed faster, got min delta %f", report.MinDelta)
+	}
+
+	total := 0
+	for _, bucket := range report.Histogram {
+		total += bucket.Count
+	}
+	if total != report.Samples {
+		t.Errorf("histogram has %d seeds, expected %d", total, report.Samples)
+	}
+
+	if report.Lost < report.Gained {
+		t.Errorf("a slower room shouldn't announce more seeds, gained %d lost %d", report.Gained, report.Lost)
+	}
+}
+
+func TestLoadSplitsChecksThem(t *testing.T) {
+	if _, err := calc.LoadSplits(strings.NewReader(`{"Fences": {"boostless_time": 0}}`)); err == nil {
+		t.Error("want an error for a room without a boostless time")
+	}
+
+	splits, err := calc.LoadSplits(strings.NewReader(`{"Fences": {"BoostlessTime": 20}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if splits["fences"].BoostlessTime != 20 {
+		t.Errorf("got %+v, want the fences splits", splits)
+	}
+}
+
+func TestSplitImpactCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := calc.SplitImpact(ctx, calc.RoomMap, 200, calc.DefaultAnnouncementThreshold, rand.New(rand.NewSource(1))); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want the cancellation", err)
+	}
+}
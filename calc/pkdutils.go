@@ -0,0 +1,38 @@
+package calc
+
+import "strings"
+
+// PkdutilsBoostStrat and PkdutilsSplit are the splits format the pkdutils mod sends. Times are in milliseconds
+type PkdutilsBoostStrat struct {
+	Name      string  `json:"name"`
+	Time      float64 `json:"time"`
+	BoostTime float64 `json:"boost_time"`
+}
+
+type PkdutilsSplit struct {
+	BoostlessTime float64              `json:"boostless_time"`
+	BoostStrats   []PkdutilsBoostStrat `json:"boost_strats"`
+}
+
+// FromPkdutils converts pkdutils splits into calc splits
+func FromPkdutils(pkdutilsSplits map[string]PkdutilsSplit) map[string]Room {
+	splits := make(map[string]Room, len(pkdutilsSplits))
+	for key, room := range pkdutilsSplits {
+		boostStrats := make([]BoostRoom, len(room.BoostStrats))
+		for i, strat := range room.BoostStrats {
+			boostStrats[i] = BoostRoom{
+				Name:      strat.Name,
+				Time:      strat.Time / 1000,
+				BoostTime: strat.BoostTime / 1000,
+			}
+		}
+
+		splits[strings.ToLower(key)] = Room{
+			Name:          key,
+			BoostlessTime: room.BoostlessTime / 1000,
+			BoostStrats:   boostStrats,
+		}
+	}
+
+	return splits
+}
@@ -0,0 +1,205 @@
+package calc
+
+import (
+	"fmt"
+	"math/rand"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultQualitySamples is how many random seeds ApplyMoveQualities looks at by default
+	DefaultQualitySamples = 1000
+	// QualitySeed seeds the sample of ApplyMoveQualities, a fixed one keeps strats near a cutoff from changing
+	// quality between restarts
+	QualitySeed int64 = 1
+
+	// plans within this many seconds of the best one count as near-optimal
+	nearOptimalMargin float64 = 0.5
+
+	brilliantMaxOptimalRate float64 = 0.02
+	brilliantMinGain        float64 = 1.0
+	greatMaxOptimalRate     float64 = 0.1
+	// a great move is near-optimal noticeably more often than it's optimal
+	greatMinNearRatio float64 = 1.5
+	// and near-optimal in enough seeds that it's worth knowing, even if it's never optimal
+	greatMinNearRate float64 = 0.05
+)
+
+func (q MoveQuality) String() string {
+	switch q {
+	case BrilliantMove:
+		return "brilliant"
+	case GreatMove:
+		return "great"
+	default:
+		return "best"
+	}
+}
+
+// StratStats describes how a boost strat performed over a sample of random seeds
+type StratStats struct {
+	Room  string
+	Strat string
+	// Seeds is the number of sampled seeds that contain the room
+	Seeds int
+	// Optimal is the number of seeds where the strat is part of the best plan
+	Optimal int
+	// NearOptimal is the number of seeds where the strat is part of a plan within nearOptimalMargin of the best
+	NearOptimal int
+	// TotalGain sums, over the seeds where the strat is optimal, how much slower the best plan without it is
+	TotalGain float64
+}
+
+func (s StratStats) OptimalRate() float64 {
+	if s.Seeds == 0 {
+		return 0
+	}
+	return float64(s.Optimal) / float64(s.Seeds)
+}
+
+func (s StratStats) NearOptimalRate() float64 {
+	if s.Seeds == 0 {
+		return 0
+	}
+	return float64(s.NearOptimal) / float64(s.Seeds)
+}
+
+func (s StratStats) MeanGain() float64 {
+	if s.Optimal == 0 {
+		return 0
+	}
+	return s.TotalGain / float64(s.Optimal)
+}
+
+// CollectStratStats calcs a sample of random seeds and gathers StratStats for every boost strat, indexed the same way as BoostStrats
+func CollectStratStats(splits map[string]Room, samples int, r *rand.Rand) (map[string][]StratStats, error) {
+	if samples <= 0 {
+		err := fmt.Errorf("sample size has to be positive, got %d", samples)
+		log.Warn(err)
+		return nil, err
+	}
+
+	stats := make(map[string][]StratStats, len(splits))
+	for key, room := range splits {
+		stats[key] = make([]StratStats, len(room.BoostStrats))
+		for i, strat := range room.BoostStrats {
+			stats[key][i] = StratStats{Room: room.Name, Strat: strat.Name}
+		}
+	}
+
+	type stratKey struct {
+		room  string
+		strat int
+	}
+
+	for n := 0; n < samples; n++ {
+		rooms := append(RandomSeed(r), "finish room")
+
+		results, err := CalcSeedCustom(rooms, splits)
+		if err != nil {
+			log.Warn(err)
+			return nil, err
+		}
+
+		for _, room := range rooms {
+			for i := range stats[room] {
+				stats[room][i].Seeds++
+			}
+		}
+
+		best := results[0]
+		near := make(map[stratKey]bool)
+		for _, res := range results {
+			if res.BoostTime > best.BoostTime+nearOptimalMargin {
+				break
+			}
+
+			for _, boost := range res.BoostRooms {
+				near[stratKey{rooms[boost.Ind], boost.StratInd}] = true
+			}
+		}
+		for key := range near {
+			stats[key.room][key.strat].NearOptimal++
+		}
+
+		for _, boost := range best.BoostRooms {
+			key := stratKey{rooms[boost.Ind], boost.StratInd}
+			stats[key.room][key.strat].Optimal++
+
+			// results are sorted, so the first plan without this strat is the best one without it
+			for _, res := range results[1:] {
+				if !usesStrat(res, boost) {
+					stats[key.room][key.strat].TotalGain += res.BoostTime - best.BoostTime
+					break
+				}
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+func usesStrat(res CalcSeedResult, strat CalcResultBoost) bool {
+	for _, boost := range res.BoostRooms {
+		if boost.Ind == strat.Ind && boost.StratInd == strat.StratInd {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifyStrats derives a MoveQuality for every strat of a room.
+// A strat is brilliant when it's optimal only in rare seeds but saves a lot when it is,
+// and great when it's not optimal that often but keeps being near-optimal. Everything else is a best move
+func ClassifyStrats(roomStats []StratStats) []MoveQuality {
+	qualities := make([]MoveQuality, len(roomStats))
+
+	for i, st := range roomStats {
+		optimalRate := st.OptimalRate()
+
+		switch {
+		case st.Optimal > 0 && optimalRate < brilliantMaxOptimalRate && st.MeanGain() >= brilliantMinGain:
+			qualities[i] = BrilliantMove
+		case optimalRate < greatMaxOptimalRate && st.NearOptimalRate() >= max(optimalRate*greatMinNearRatio, greatMinNearRate):
+			qualities[i] = GreatMove
+		default:
+			qualities[i] = BestMove
+		}
+	}
+
+	return qualities
+}
+
+// ApplyMoveQualities classifies every strat in splits over a sample of random seeds and stores the result in its Quality.
+// Strats with QualityOverride keep their hand-assigned Quality
+func ApplyMoveQualities(splits map[string]Room, samples int, r *rand.Rand) error {
+	stats, err := CollectStratStats(splits, samples, r)
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+
+	for key, room := range splits {
+		qualities := ClassifyStrats(stats[key])
+
+		strats := make([]BoostRoom, len(room.BoostStrats))
+		copy(strats, room.BoostStrats)
+		for i := range strats {
+			if strats[i].QualityOverride {
+				continue
+			}
+
+			if strats[i].Quality != qualities[i] {
+				log.Debugf("%s (%s) is a %s move now (optimal in %.1f%% of seeds, near-optimal in %.1f%%, saves %.2fs)",
+					room.Name, strats[i].Name, qualities[i], stats[key][i].OptimalRate()*100, stats[key][i].NearOptimalRate()*100, stats[key][i].MeanGain())
+			}
+			strats[i].Quality = qualities[i]
+		}
+
+		room.BoostStrats = strats
+		splits[key] = room
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package calc_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"pkd-bot/calc"
+)
+
+func TestClassifyStrats(t *testing.T) {
+	stats := []calc.StratStats{
+		// optimal all the time
+		{Seeds: 100, Optimal: 60, NearOptimal: 65, TotalGain: 150},
+		// optimal once, but saves a lot when it is
+		{Seeds: 100, Optimal: 1, NearOptimal: 1, TotalGain: 2},
+		// rarely optimal, often near-optimal
+		{Seeds: 100, Optimal: 5, NearOptimal: 20, TotalGain: 2},
+		// never optimal, but near-optimal often enough
+		{Seeds: 100, NearOptimal: 10},
+		// never optimal and hardly ever close
+		{Seeds: 100, NearOptimal: 1},
+		// never even close
+		{Seeds: 100},
+	}
+
+	expected := []calc.MoveQuality{calc.BestMove, calc.BrilliantMove, calc.GreatMove, calc.GreatMove, calc.BestMove, calc.BestMove}
+	got := calc.ClassifyStrats(stats)
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("strat %d: expected %s, got %s", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestApplyMoveQualitiesKeepsOverrides(t *testing.T) {
+	splits := make(map[string]calc.Room, len(calc.RoomMap))
+	for key, room := range calc.RoomMap {
+		strats := make([]calc.BoostRoom, len(room.BoostStrats))
+		copy(strats, room.BoostStrats)
+		room.BoostStrats = strats
+		splits[key] = room
+	}
+
+	splits["fences"].BoostStrats[0].Quality = calc.BrilliantMove
+	splits["fences"].BoostStrats[0].QualityOverride = true
+
+	if err := calc.ApplyMoveQualities(splits, 50, rand.New(rand.NewSource(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	if splits["fences"].BoostStrats[0].Quality != calc.BrilliantMove {
+		t.Errorf("overridden quality was replaced with %s", splits["fences"].BoostStrats[0].Quality)
+	}
+}
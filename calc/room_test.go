@@ -0,0 +1,71 @@
+package calc_test
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"pkd-bot/calc"
+)
+
+func TestWithDerivedStrats(t *testing.T) {
+	room := calc.Room{
+		Name: "Test Room",
+		Segments: []calc.Segment{
+			{Name: "cp 0-1", Time: 10, BoostedTime: 4, BoostAt: 1},
+			{Name: "cp 1-2", Time: 5},
+			{
+				Name: "cp 2-3", Time: 8, BoostedTime: 3,
+				Variants: []calc.SegmentVariant{
+					{Name: "salami", BoostedTime: 2, BoostAt: -1},
+				},
+			},
+		},
+	}.WithDerivedStrats()
+
+	if math.Abs(room.BoostlessTime-23) > 1e-9 {
+		t.Errorf("expected boostless time 23, got %f", room.BoostlessTime)
+	}
+
+	expected := []calc.BoostRoom{
+		{Name: "cp 0-1", Time: 17, BoostTime: 1},
+		{Name: "cp 2-3", Time: 18, BoostTime: 15},
+		{Name: "cp 2-3 + salami", Time: 17, BoostTime: 14},
+	}
+
+	if len(room.BoostStrats) != len(expected) {
+		t.Fatalf("expected %d strats, got %+v", len(expected), room.BoostStrats)
+	}
+
+	for i, strat := range room.BoostStrats {
+		if strat.Name != expected[i].Name ||
+			math.Abs(strat.Time-expected[i].Time) > 1e-9 ||
+			math.Abs(strat.BoostTime-expected[i].BoostTime) > 1e-9 {
+			t.Errorf("strat %d: expected %+v, got %+v", i, expected[i], strat)
+		}
+	}
+}
+
+func TestSeedIDRoundTrip(t *testing.T) {
+	rooms := []string{"around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"}
+
+	id := calc.SeedID(rooms)
+	if id != "around-pillars.blocks.fences.fortress.ice.early-3-plus-1.underbridge.sandpit" {
+		t.Errorf("got seed id %q", id)
+	}
+
+	parsed, err := calc.ParseSeedID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(parsed, rooms) {
+		t.Errorf("got %v, want %v", parsed, rooms)
+	}
+
+	for _, bad := range []string{"blocks.fences", id + ".finish-room", strings.Replace(id, "blocks", "nope", 1)} {
+		if _, err := calc.ParseSeedID(bad); err == nil {
+			t.Errorf("%q parsed as a seed id", bad)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package calc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SeedIDSeparator joins the room slugs of a seed id
+const SeedIDSeparator = "."
+
+// room slugs are url and file name friendly room keys, e.g. "early-3-plus-1"
+var (
+	slugReplacer   = strings.NewReplacer(" ", "-", "+", "-plus-")
+	roomKeysBySlug = make(map[string]string)
+)
+
+func init() {
+	for key := range RoomMap {
+		roomKeysBySlug[RoomSlug(key)] = key
+	}
+}
+
+func RoomSlug(key string) string {
+	return slugReplacer.Replace(key)
+}
+
+// RoomBySlug finds the RoomMap key of a room slug
+func RoomBySlug(slug string) (string, bool) {
+	key, exists := roomKeysBySlug[strings.ToLower(strings.TrimSpace(slug))]
+	return key, exists
+}
+
+// SeedID is stateless, the seed's rooms can always be read back from it with ParseSeedID
+func SeedID(keys []string) string {
+	slugs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		slugs = append(slugs, RoomSlug(key))
+	}
+	return strings.Join(slugs, SeedIDSeparator)
+}
+
+// ParseSeedID returns the room keys of a seed id, without the finish room
+func ParseSeedID(id string) ([]string, error) {
+	slugs := strings.Split(id, SeedIDSeparator)
+	if len(slugs) != 8 {
+		return nil, fmt.Errorf("a seed has 8 rooms, got %d", len(slugs))
+	}
+
+	keys := make([]string, 0, len(slugs))
+	for _, slug := range slugs {
+		key, exists := RoomBySlug(slug)
+		if !exists || key == "finish room" {
+			return nil, fmt.Errorf("unknown room \"%s\"", slug)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
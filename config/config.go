@@ -0,0 +1,233 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+const DefaultFile = "config.json"
+
+// Config is everything the app can be configured with. Later sources override earlier ones:
+// the defaults, the config file, the environment (including .env) and the flags
+type Config struct {
+	// BotToken is required for the discord bot, the api runs without it
+	BotToken string `json:"bot_token"`
+	// GuildID is the guild the bot looks for its channels in, all of its guilds if it's empty
+	GuildID string `json:"guild_id"`
+	// AnnouncementChannel is the name of the channel good seeds are announced in
+	AnnouncementChannel string `json:"announcement_channel"`
+	// ModLogChannel is the name of the channel rejected ChatTriggers submissions are reported in
+	ModLogChannel string `json:"mod_log_channel"`
+	// AnnouncementThreshold is the boost time in seconds under which seeds are announced
+	AnnouncementThreshold float64 `json:"announcement_threshold"`
+
+	HTTPPort int `json:"http_port"`
+	// APIKeysFile has the keys ChatTriggers submissions are signed with
+	APIKeysFile string `json:"api_keys_file"`
+	// AdminToken enables the admin endpoints, they're disabled without it
+	AdminToken string `json:"admin_token"`
+
+	HypixelAPIKey string `json:"hypixel_api_key"`
+	// SplitsPath is a json file in the RoomMap shape laid over the calc's splits, rooms it doesn't have keep theirs
+	SplitsPath string `json:"splits_path"`
+	// DatabaseURL is a postgres:// url or sqlite: followed by a file
+	DatabaseURL string `json:"database_url"`
+
+	Debug bool `json:"debug"`
+}
+
+func Default() Config {
+	return Config{
+		AnnouncementChannel:   "bot-commands",
+		ModLogChannel:         "mod-log",
+		AnnouncementThreshold: 130,
+		HTTPPort:              8080,
+		APIKeysFile:           "api_keys.json",
+		DatabaseURL:           "sqlite:pkd-bot.db",
+	}
+}
+
+// envVars are the environment variables of the fields, by their json name
+var envVars = map[string]string{
+	"bot_token":              "BOT_TOKEN",
+	"guild_id":               "GUILD_ID",
+	"announcement_channel":   "ANNOUNCEMENT_CHANNEL",
+	"mod_log_channel":        "MOD_LOG_CHANNEL",
+	"announcement_threshold": "ANNOUNCEMENT_THRESHOLD",
+	"http_port":              "HTTP_PORT",
+	"api_keys_file":          "API_KEYS_FILE",
+	"admin_token":            "ADMIN_TOKEN",
+	"hypixel_api_key":        "HYPIXEL_API_KEY",
+	"splits_path":            "SPLITS_PATH",
+	"database_url":           "DATABASE_URL",
+	"debug":                  "DEBUG",
+}
+
+// Load reads the config from args (without the program name), the environment and the config file.
+// The file is the -config flag, then CONFIG_FILE, then config.json if it exists.
+// The secrets can't be flags, flags show up in the process list
+func Load(args []string) (Config, error) {
+	// the env can come from the environment too, e.g. in docker
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("failed to read .env: %w", err)
+	}
+
+	cfg := Default()
+
+	fs := flag.NewFlagSet("pkd-bot", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("config", "", "json config file")
+	guildID := fs.String("guild", "", "guild id")
+	announcementChannel := fs.String("announcement-channel", "", "name of the channel seeds are announced in")
+	modLogChannel := fs.String("mod-log-channel", "", "name of the channel rejected submissions are reported in")
+	threshold := fs.Float64("announcement-threshold", 0, "boost time in seconds under which seeds are announced")
+	port := fs.Int("http-port", 0, "port of the api")
+	apiKeysFile := fs.String("api-keys-file", "", "file with the ChatTriggers api keys")
+	splitsPath := fs.String("splits", "", "json splits laid over the calc's")
+	databaseURL := fs.String("database-url", "", "postgres:// url or sqlite:<file>")
+	debug := fs.Bool("debug", false, "log debug messages")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, fmt.Errorf("invalid flags: %w", err)
+	}
+
+	path, required := *file, true
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		path, required = DefaultFile, false
+	}
+	if err := cfg.loadFile(path, required); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.loadEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "guild":
+			cfg.GuildID = *guildID
+		case "announcement-channel":
+			cfg.AnnouncementChannel = *announcementChannel
+		case "mod-log-channel":
+			cfg.ModLogChannel = *modLogChannel
+		case "announcement-threshold":
+			cfg.AnnouncementThreshold = *threshold
+		case "http-port":
+			cfg.HTTPPort = *port
+		case "api-keys-file":
+			cfg.APIKeysFile = *apiKeysFile
+		case "splits":
+			cfg.SplitsPath = *splitsPath
+		case "database-url":
+			cfg.DatabaseURL = *databaseURL
+		case "debug":
+			cfg.Debug = *debug
+		}
+	})
+
+	return cfg, cfg.Validate()
+}
+
+func (cfg *Config) loadFile(path string, required bool) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open the config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) loadEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	set := func(field string, apply func(value string) error) {
+		value, ok := lookup(envVars[field])
+		if !ok || value == "" {
+			return
+		}
+		if err := apply(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", envVars[field], err))
+		}
+	}
+	str := func(dst *string) func(string) error {
+		return func(value string) error {
+			*dst = value
+			return nil
+		}
+	}
+
+	set("bot_token", str(&cfg.BotToken))
+	set("guild_id", str(&cfg.GuildID))
+	set("announcement_channel", str(&cfg.AnnouncementChannel))
+	set("mod_log_channel", str(&cfg.ModLogChannel))
+	set("announcement_threshold", func(value string) (err error) {
+		cfg.AnnouncementThreshold, err = strconv.ParseFloat(value, 64)
+		return err
+	})
+	set("http_port", func(value string) (err error) {
+		cfg.HTTPPort, err = strconv.Atoi(value)
+		return err
+	})
+	set("api_keys_file", str(&cfg.APIKeysFile))
+	set("admin_token", str(&cfg.AdminToken))
+	set("hypixel_api_key", str(&cfg.HypixelAPIKey))
+	set("splits_path", str(&cfg.SplitsPath))
+	set("database_url", str(&cfg.DatabaseURL))
+	set("debug", func(value string) (err error) {
+		cfg.Debug, err = strconv.ParseBool(value)
+		return err
+	})
+
+	return errors.Join(errs...)
+}
+
+// Validate returns every problem with the config at once
+func (cfg Config) Validate() error {
+	var errs []error
+	if cfg.HTTPPort < 0 || cfg.HTTPPort > 65535 {
+		errs = append(errs, fmt.Errorf("http_port %d isn't a port", cfg.HTTPPort))
+	}
+	if cfg.AnnouncementThreshold <= 0 {
+		errs = append(errs, fmt.Errorf("announcement_threshold has to be positive, got %v", cfg.AnnouncementThreshold))
+	}
+	if cfg.AnnouncementChannel == "" {
+		errs = append(errs, fmt.Errorf("announcement_channel can't be empty"))
+	}
+	if cfg.ModLogChannel == "" {
+		errs = append(errs, fmt.Errorf("mod_log_channel can't be empty"))
+	}
+	if cfg.APIKeysFile == "" {
+		errs = append(errs, fmt.Errorf("api_keys_file can't be empty"))
+	}
+	if !strings.HasPrefix(cfg.DatabaseURL, "postgres://") && !strings.HasPrefix(cfg.DatabaseURL, "postgresql://") &&
+		!strings.HasPrefix(cfg.DatabaseURL, "sqlite:") && cfg.DatabaseURL != "memory" {
+		// the url isn't in the error, it can have a password in it
+		errs = append(errs, fmt.Errorf("database_url should start with postgres://, postgresql:// or sqlite:"))
+	}
+	if cfg.SplitsPath != "" {
+		if _, err := os.Stat(cfg.SplitsPath); err != nil {
+			errs = append(errs, fmt.Errorf("splits_path: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
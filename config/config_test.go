@@ -0,0 +1,129 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pkd-bot/config"
+)
+
+// clearEnv keeps the environment the tests run in out of them
+func clearEnv(t *testing.T) {
+	for _, name := range []string{"BOT_TOKEN", "GUILD_ID", "ANNOUNCEMENT_CHANNEL", "MOD_LOG_CHANNEL", "ANNOUNCEMENT_THRESHOLD",
+		"HTTP_PORT", "API_KEYS_FILE", "ADMIN_TOKEN", "HYPIXEL_API_KEY", "SPLITS_PATH", "DATABASE_URL", "DEBUG", "CONFIG_FILE"} {
+		t.Setenv(name, "")
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != config.Default() {
+		t.Errorf("got %+v, want the defaults %+v", cfg, config.Default())
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	file := writeFile(t, "config.json", `{
+		"guild_id": "file guild",
+		"http_port": 9000,
+		"announcement_threshold": 125,
+		"mod_log_channel": "file-log",
+		"bot_token": "file token"
+	}`)
+	t.Setenv("HTTP_PORT", "9001")
+	t.Setenv("ANNOUNCEMENT_THRESHOLD", "128")
+	t.Setenv("BOT_TOKEN", "env token")
+	t.Setenv("DEBUG", "true")
+
+	cfg, err := config.Load([]string{"-config", file, "-http-port", "9002"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.GuildID != "file guild" || cfg.ModLogChannel != "file-log" {
+		t.Errorf("got %+v, want the file's guild and mod log channel", cfg)
+	}
+	if cfg.AnnouncementThreshold != 128 || cfg.BotToken != "env token" || !cfg.Debug {
+		t.Errorf("got %+v, want the env to override the file", cfg)
+	}
+	if cfg.HTTPPort != 9002 {
+		t.Errorf("got port %d, want the flag to override the env and the file", cfg.HTTPPort)
+	}
+	if cfg.AnnouncementChannel != "bot-commands" {
+		t.Errorf("got announcement channel %q, want the default", cfg.AnnouncementChannel)
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, "pkd.json", `{"guild_id": "env file guild"}`))
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GuildID != "env file guild" {
+		t.Errorf("got guild %q, want the one of CONFIG_FILE", cfg.GuildID)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+		want string
+	}{
+		{name: "missing config file", args: []string{"-config", "does-not-exist.json"}, want: "config file"},
+		{name: "unknown field", file: `{"bot_tokn": "x"}`, want: "bot_tokn"},
+		{name: "port", args: []string{"-http-port", "70000"}, want: "http_port"},
+		{name: "threshold", env: map[string]string{"ANNOUNCEMENT_THRESHOLD": "-1"}, want: "announcement_threshold"},
+		{name: "unparsable env", env: map[string]string{"HTTP_PORT": "eighty"}, want: "HTTP_PORT"},
+		{name: "database", env: map[string]string{"DATABASE_URL": "mysql://user:secret@db/pkd"}, want: "database_url"},
+		{name: "splits", args: []string{"-splits", "does-not-exist.json"}, want: "splits_path"},
+		{name: "secret flag", args: []string{"-bot-token", "x"}, want: "flag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeFile(t, "config.json", tt.file))
+			}
+
+			_, err := config.Load(args)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %q, want it to mention %q", err, tt.want)
+			}
+			if strings.Contains(err.Error(), "secret") {
+				t.Errorf("the error %q leaks the database password", err)
+			}
+		})
+	}
+}
@@ -2,99 +2,321 @@ package discord
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"os/signal"
 	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"pkd-bot/calc"
-	"pkd-bot/hypixel"
+	"pkd-bot/events"
+	"pkd-bot/metrics"
+	"pkd-bot/render"
+	"pkd-bot/state"
+	"pkd-bot/storage"
 	"pkd-bot/tournaments"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
 )
 
-func StartDiscordBot() error {
+// Config is what New needs, main fills it from the app's config
+type Config struct {
+	BotToken string
+	// GuildID is the guild the channels are looked for in, all of the bot's guilds if it's empty
+	GuildID string
+	// AnnouncementChannel and ModLogChannel are channel names, the ids are looked up when they're first needed.
+	// Guilds can announce in another channel with /config
+	AnnouncementChannel string
+	ModLogChannel       string
+	// AnnouncementThreshold is the boost time seeds are announced under, in the guilds that haven't set their own
+	AnnouncementThreshold float64
+	// PlayerCount is what /playercount shows
+	PlayerCount func() (int, error)
+}
+
+// Bot announces seeds and answers the commands, with the config and the store it was made with
+type Bot struct {
+	token                   string
+	guildID                 string
+	announcementChannelName string
+	modLogChannelName       string
+	threshold               float64
+	playerCount             func() (int, error)
+
+	// store is where announcements are recorded
+	store storage.Store
+	// states keeps what the buttons of seed messages need
+	states      state.Store
+	tournaments *tournaments.Tournaments
+
+	// gateway is the connection to discord, it's nil for bots made in tests
+	gateway *discordgo.Session
+	// s is the session the handlers and announcements go through, the gateway outside of tests
+	s Session
+	// userID is the bot's user, known once the gateway is open
+	userID          string
+	commandHandlers map[string]func(s Session, i *discordgo.InteractionCreate)
+
+	// guilds are the guilds the bot is in. The gateway sends a GuildCreate for each of them after connecting and
+	// whenever the bot joins one, so announcements don't have to ask discord for them
+	guildsMu sync.RWMutex
+	guilds   map[string]struct{}
+	// cachedSettings are the settings of the guilds by id, every submission reads them and only /config changes them
+	cachedSettings sync.Map
+	// announcementChannelIDs are the channels named announcementChannelName, by guild
+	announcementChannelIDs sync.Map
+
+	// modLogChannelID is looked up the first time it's needed, rejections are reported from many goroutines at once
+	modLogMu        sync.Mutex
+	modLogChannelID string
+
+	// cachedSubscriptions are loaded with the first announcement, only /subscribe changes them
+	subscriptionsMu     sync.Mutex
+	cachedSubscriptions []storage.Subscription
+	subscriptionsLoaded bool
+
+	unsubscribeSeeds      func()
+	unsubscribeRejections func()
+	stopJanitor           chan struct{}
+	janitorDone           chan struct{}
+
+	gatewayConnected      atomic.Bool
+	gatewayDisconnectedAt atomic.Value
+}
+
+// New creates the session of the bot, Start connects it
+func New(cfg Config, store storage.Store) (*Bot, error) {
+	session, err := discordgo.New("Bot " + cfg.BotToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bot token, couldn't initiate a session: %w", err)
+	}
+
+	bot := newBot(cfg, store, session)
+	bot.gateway = session
+	return bot, nil
+}
+
+// newBot makes a bot whose handlers and announcements go through s
+func newBot(cfg Config, store storage.Store, s Session) *Bot {
+	if cfg.AnnouncementThreshold == 0 {
+		cfg.AnnouncementThreshold = calc.DefaultAnnouncementThreshold
+	}
+	if cfg.PlayerCount == nil {
+		cfg.PlayerCount = func() (int, error) { return 0, fmt.Errorf("the player count isn't known") }
+	}
+
+	bot := &Bot{
+		token:                   cfg.BotToken,
+		guildID:                 cfg.GuildID,
+		announcementChannelName: cfg.AnnouncementChannel,
+		modLogChannelName:       cfg.ModLogChannel,
+		threshold:               cfg.AnnouncementThreshold,
+		playerCount:             cfg.PlayerCount,
+		store:                   store,
+		states:                  store.MessageStates(),
+		tournaments:             tournaments.New(store),
+		s:                       s,
+		guilds:                  make(map[string]struct{}),
+		unsubscribeSeeds:        func() {},
+		unsubscribeRejections:   func() {},
+		stopJanitor:             make(chan struct{}),
+		janitorDone:             make(chan struct{}),
+	}
+	bot.commandHandlers = map[string]func(s Session, i *discordgo.InteractionCreate){
+		"basic-command": func(s Session, i *discordgo.InteractionCreate) {
+			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: "Hey there! Congratulations, you just executed your first slash command",
+				},
+			})
+		},
+		"tournament":  bot.tournamentHandler,
+		"calc":        bot.calcSeedHandler,
+		"playercount": bot.playercountHandler,
+		"allsplits":   allSplitsHandler,
+		"roomsplits":  roomSplitsHandler,
+		"splitimpact": bot.splitImpactHandler,
+		"duel":        bot.duelHandler,
+		"config":      bot.configHandler,
+		"subscribe":   bot.subscribeHandler,
+		"lobbies":     bot.lobbiesHandler,
+		"seeds":       bot.seedsHandler,
+		"leaderboard": bot.leaderboardHandler,
+	}
+	bot.trackMessageStates()
+	return bot
+}
+
+// Start connects to discord and registers the commands, it doesn't block
+func (bot *Bot) Start() error {
+	if bot.token == "" {
+		return fmt.Errorf("BOT_TOKEN is not set")
+	}
+
 	slices.Sort(roomOptions)
 
 	log.SetReportCaller(true)
-	s.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
+	bot.gateway.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
 		log.Infof("Logged in as %v#%v", s.State.User.Username, s.State.User.Discriminator)
+		bot.setGatewayConnected(true)
+	})
+	bot.gateway.AddHandler(func(s *discordgo.Session, r *discordgo.Resumed) {
+		bot.setGatewayConnected(true)
 	})
+	bot.gateway.AddHandler(func(s *discordgo.Session, d *discordgo.Disconnect) {
+		log.Warn("Disconnected from the discord gateway")
+		bot.setGatewayConnected(false)
+		bot.gatewayDisconnectedAt.Store(time.Now())
+	})
+
+	bot.gateway.AddHandler(bot.guildCreated)
+	bot.gateway.AddHandler(bot.guildDeleted)
 
-	s.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	bot.gateway.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		switch i.Type {
 		case discordgo.InteractionApplicationCommand:
-			if h, ok := commandHandlers[i.ApplicationCommandData().Name]; ok {
+			if h, ok := bot.commandHandlers[i.ApplicationCommandData().Name]; ok {
+				metrics.DiscordInteractions.WithLabelValues("command", i.ApplicationCommandData().Name).Inc()
 				h(s, i)
 			}
 		case discordgo.InteractionApplicationCommandAutocomplete:
+			metrics.DiscordInteractions.WithLabelValues("autocomplete", i.ApplicationCommandData().Name).Inc()
 			autocompleteHandler(s, i)
 		case discordgo.InteractionMessageComponent:
-			buttonHandler(s, i)
+			// the buttons of /seeds carry their state after a colon, it'd make too many labels
+			button, _, stateless := strings.Cut(i.MessageComponentData().CustomID, ":")
+			metrics.DiscordInteractions.WithLabelValues("button", button).Inc()
+			if stateless {
+				bot.seedsButtonHandler(s, i)
+			} else {
+				bot.buttonHandler(s, i)
+			}
 		}
 	})
 
-	err := s.Open()
+	err := bot.gateway.Open()
 	if err != nil {
 		log.Errorf("Cannot open the session: %v", err)
 		return err
 	}
+	bot.userID = bot.gateway.State.User.ID
 
-	logBotPermissions()
+	bot.logBotPermissions()
 
 	log.Info("Adding commands...")
 	registeredCommands := make([]*discordgo.ApplicationCommand, len(commands))
 	for i, v := range commands {
-		cmd, err := s.ApplicationCommandCreate(s.State.User.ID, "", v)
+		cmd, err := bot.gateway.ApplicationCommandCreate(bot.userID, "", v)
 		if err != nil {
 			log.Errorf("Cannot create '%v' command: %v", v.Name, err)
+			// the lifecycle doesn't stop a component that failed to start
+			bot.gateway.Close()
 			return err
 		}
 		registeredCommands[i] = cmd
 	}
 
-	defer s.Close()
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
-	log.Info("Press Ctrl+C to exit")
-	<-stop
+	go bot.runStateJanitor()
 
-	log.Info("Shutting down...")
+	bot.unsubscribeSeeds = events.SeedSubmissions.Subscribe(bot.announceSeed)
+	bot.unsubscribeRejections = events.SubmissionRejections.Subscribe(bot.reportRejection)
 
 	return nil
 }
 
-var (
-	BotToken = ""
-	GuildID  = ""
-)
+func (bot *Bot) setGatewayConnected(connected bool) {
+	bot.gatewayConnected.Store(connected)
+	if connected {
+		metrics.DiscordGatewayConnected.Set(1)
+	} else {
+		metrics.DiscordGatewayConnected.Set(0)
+	}
+}
 
-var s *discordgo.Session
+// GatewayStatus returns an error while the bot isn't connected to the discord gateway
+func (bot *Bot) GatewayStatus() error {
+	if bot.gatewayConnected.Load() {
+		return nil
+	}
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("failed to open .env")
+	if at, ok := bot.gatewayDisconnectedAt.Load().(time.Time); ok {
+		return fmt.Errorf("disconnected from the gateway since %s", at.Format(time.RFC3339))
 	}
+	return fmt.Errorf("not connected to the gateway yet")
+}
 
-	BotToken = os.Getenv("BOT_TOKEN")
-	GuildID = os.Getenv("GUILD_ID")
+// Stop stops announcing and disconnects. Without a durable state store the buttons of messages that
+// still have them are removed, they'd only work again after a restart for the seeds whose state can be rebuilt
+func (bot *Bot) Stop(ctx context.Context) error {
+	bot.unsubscribeSeeds()
+	bot.unsubscribeRejections()
 
-	if os.Getenv("DEBUG") == "true" {
-		log.SetLevel(log.DebugLevel)
+	// announcements in flight still need the gateway, and the database that closes after the bot
+	if err := events.SeedSubmissions.Drain(ctx); err != nil {
+		log.Warn(err)
+	}
+	if err := events.SubmissionRejections.Drain(ctx); err != nil {
+		log.Warn(err)
 	}
 
-	var err error
-	s, err = discordgo.New("Bot " + BotToken)
+	close(bot.stopJanitor)
+	select {
+	case <-bot.janitorDone:
+	case <-ctx.Done():
+	}
+
+	if !bot.states.Durable() {
+		if err := bot.finalizeMessages(ctx); err != nil {
+			log.Warn(err)
+		}
+	}
+
+	bot.setGatewayConnected(false)
+	return bot.gateway.Close()
+}
+
+func (bot *Bot) finalizeMessages(ctx context.Context) error {
+	states, err := bot.states.All()
 	if err != nil {
-		log.Fatalf("Invalid bot token, couldn't initiate a session: %v", err)
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, state := range states {
+		wg.Add(1)
+		go func(messageID, channelID string) {
+			defer wg.Done()
+
+			_, err := bot.s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+				ID:         messageID,
+				Channel:    channelID,
+				Components: &[]discordgo.MessageComponent{},
+			}, discordgo.WithContext(ctx))
+			if err != nil {
+				log.Errorf("Failed to remove buttons on shutdown: %v", err)
+			}
+		}(state.MessageID, state.ChannelID)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("gave up removing buttons: %w", ctx.Err())
 	}
 }
 
@@ -125,9 +347,16 @@ var commands = []*discordgo.ApplicationCommand{
 			},
 		},
 	},
+	splitImpactCommand,
+	duelCommand,
+	configCommand,
+	subscribeCommand,
+	lobbiesCommand,
+	seedsCommand,
+	leaderboardCommand,
 }
 
-func tournamentHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) tournamentHandler(s Session, i *discordgo.InteractionCreate) {
 	if i.Type != discordgo.InteractionApplicationCommand {
 		err := fmt.Errorf("expected interaction type to be InteractionApplicationCommand, but found %v", i.Type)
 		log.Warn(err)
@@ -155,7 +384,7 @@ func tournamentHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 
 	switch options[0].Name {
 	case "register":
-		registerTournamentHandler(s, i)
+		bot.registerTournamentHandler(s, i)
 		return
 	default:
 		content = "There is no such command"
@@ -169,7 +398,7 @@ func tournamentHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	})
 }
 
-func registerTournamentHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) registerTournamentHandler(s Session, i *discordgo.InteractionCreate) {
 	// First, respond asking for the CSV file
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -183,7 +412,7 @@ func registerTournamentHandler(s *discordgo.Session, i *discordgo.InteractionCre
 	}
 
 	// Create a message handler to wait for the CSV file
-	s.AddHandlerOnce(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+	s.AddHandlerOnce(func(_ *discordgo.Session, m *discordgo.MessageCreate) {
 		log.Debugf("%+v", m.Embeds)
 		// Ensure it's from the same user and channel
 		if m.Author.ID != i.Member.User.ID || m.ChannelID != i.ChannelID {
@@ -217,7 +446,7 @@ func registerTournamentHandler(s *discordgo.Session, i *discordgo.InteractionCre
 			return
 		}
 
-		if err := tournaments.RegisterTournamentFromCsv(fileContent); err != nil {
+		if err := bot.tournaments.RegisterTournamentFromCsv(fileContent); err != nil {
 			log.Errorf("Failed to register tournament: %v", err)
 			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Failed to register tournament: %v", err))
 			return
@@ -227,7 +456,7 @@ func registerTournamentHandler(s *discordgo.Session, i *discordgo.InteractionCre
 	})
 }
 
-func playercountHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) playercountHandler(s Session, i *discordgo.InteractionCreate) {
 	logUserInteraction(i, "command", "playercount")
 
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -239,7 +468,7 @@ func playercountHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 
-	playerCount, err := hypixel.GetPlayerCount()
+	playerCount, err := bot.playerCount()
 	content := "Failed to fetch player count from Hypixel API. Please try again later."
 	if err != nil {
 		log.Errorf("Failed to get player count: %v", err)
@@ -275,23 +504,7 @@ func playercountHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	}
 }
 
-var commandHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
-	"basic-command": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Hey there! Congratulations, you just executed your first slash command",
-			},
-		})
-	},
-	"tournament":  tournamentHandler,
-	"calc":        calcSeedHandler,
-	"playercount": playercountHandler,
-	"allsplits":   allSplitsHandler,
-	"roomsplits":  roomSplitsHandler,
-}
-
-func roomSplitsHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func roomSplitsHandler(s Session, i *discordgo.InteractionCreate) {
 	logUserInteraction(i, "command", "roomsplits")
 
 	// Get room name from interaction
@@ -355,15 +568,36 @@ func createRoomDetailEmbed(roomName string, room calc.Room) *discordgo.MessageEm
 	description.WriteString("```\n")
 	description.WriteString(fmt.Sprintf("Boostless Time: %8.2f seconds\n", room.BoostlessTime))
 
+	if len(room.Segments) > 0 {
+		description.WriteString("\nSegments:\n")
+		description.WriteString(fmt.Sprintf("%-20s %12s %12s %10s\n",
+			"Segment", "Time", "Boosted", "Boost At"))
+		description.WriteString(strings.Repeat("-", 60) + "\n")
+
+		for _, seg := range room.Segments {
+			boosted := "---"
+			if seg.BoostedTime > 0 {
+				boosted = fmt.Sprintf("%.2f", seg.BoostedTime)
+			}
+			description.WriteString(fmt.Sprintf("%-20s %12.2f %12s %10.2f\n",
+				seg.Name, seg.Time, boosted, seg.BoostAt))
+
+			for _, variant := range seg.Variants {
+				description.WriteString(fmt.Sprintf("%-20s %12s %12.2f %10.2f\n",
+					"  + "+variant.Name, "", variant.BoostedTime, variant.BoostAt))
+			}
+		}
+	}
+
 	if len(room.BoostStrats) > 0 {
 		description.WriteString("\nBoost Strategies:\n")
-		description.WriteString(fmt.Sprintf("%-20s %12s %12s\n",
-			"Strat", "Total Time", "Boost At"))
-		description.WriteString(strings.Repeat("-", 50) + "\n")
+		description.WriteString(fmt.Sprintf("%-20s %12s %12s %10s\n",
+			"Strat", "Total Time", "Boost At", "Quality"))
+		description.WriteString(strings.Repeat("-", 60) + "\n")
 
 		for _, strat := range room.BoostStrats {
-			description.WriteString(fmt.Sprintf("%-20s %12.2f %12.2f\n",
-				strat.Name, strat.Time, strat.BoostTime))
+			description.WriteString(fmt.Sprintf("%-20s %12.2f %12.2f %10s\n",
+				strat.Name, strat.Time, strat.BoostTime, strat.Quality))
 		}
 	} else {
 		description.WriteString("\nNo boost strategies available for this room.")
@@ -473,108 +707,7 @@ func createNavigationButtons(currentIndex, totalResults int, currentFilter strin
 	}
 }
 
-type ResultState struct {
-	Rooms       []string
-	Results     []calc.CalcSeedResult
-	Index       int
-	Filter      string
-	CalcCommand string
-}
-
-var messageStates = make(map[string]*ResultState)
-
-var cleanupTimers = make(map[string]*time.Timer)
-
-var showCalcMessages = make(map[string]string)
-
-var (
-	showCalcTimers     = make(map[string]*time.Timer)
-	longButtonDuration = 5 * time.Minute
-)
-
-func cleanupMessageState(messageID string, s *discordgo.Session, channelID string, keepShowCalcButton bool) *time.Timer {
-	return time.AfterFunc(5*time.Minute, func() {
-		message, err := s.ChannelMessage(channelID, messageID)
-		if err != nil {
-			log.Errorf("Failed to get message for cleanup: %v", err)
-			return
-		}
-
-		if len(message.Attachments) == 0 {
-			log.Error("No attachments found in message")
-			return
-		}
-
-		resp, err := http.Get(message.Attachments[0].URL)
-		if err != nil {
-			log.Errorf("Failed to get attachment: %v", err)
-			return
-		}
-		defer resp.Body.Close()
-
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Errorf("Failed to read attachment data: %v", err)
-			return
-		}
-
-		var components []discordgo.MessageComponent
-		if keepShowCalcButton {
-			// Keep only the ShowCalc button
-			components = []discordgo.MessageComponent{
-				discordgo.ActionsRow{
-					Components: []discordgo.MessageComponent{
-						discordgo.Button{
-							CustomID: ButtonShowCalc,
-							Label:    "How did you get this?",
-							Style:    discordgo.SuccessButton,
-						},
-					},
-				},
-			}
-
-			// Create a timer to remove the ShowCalc button and state eventually
-			showCalcTimers[messageID] = time.AfterFunc(5*time.Minute, func() {
-				// Remove all buttons after the extended period
-				_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
-					ID:          messageID,
-					Channel:     channelID,
-					Files:       []*discordgo.File{{Name: "result.png", Reader: bytes.NewReader(data)}},
-					Components:  &[]discordgo.MessageComponent{},
-					Attachments: &[]*discordgo.MessageAttachment{},
-				})
-				if err != nil {
-					log.Errorf("Failed to remove ShowCalc button: %v", err)
-				}
-				delete(showCalcTimers, messageID)
-				delete(messageStates, messageID) // Only delete state when fully done
-			})
-		} else {
-			components = []discordgo.MessageComponent{}
-			// If not keeping the button, remove the state now
-			delete(messageStates, messageID)
-		}
-
-		// Keep the last image but remove/modify buttons
-		_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
-			ID:          messageID,
-			Channel:     channelID,
-			Files:       []*discordgo.File{{Name: "result.png", Reader: bytes.NewReader(data)}},
-			Components:  &components,
-			Attachments: &[]*discordgo.MessageAttachment{},
-		})
-		if err != nil {
-			log.Errorf("Failed to update buttons: %v", err)
-		}
-
-		delete(messageStates, messageID)
-		delete(showCalcMessages, messageID)
-		delete(cleanupTimers, messageID)
-		// NOTE: We don't delete messageStates here if keepShowCalcButton is true
-	})
-}
-
-func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) buttonHandler(s Session, i *discordgo.InteractionCreate) {
 	logUserInteraction(i, "button click", i.MessageComponentData().CustomID)
 
 	defer func() {
@@ -589,8 +722,14 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		}
 	}()
 
-	state, exists := messageStates[i.Message.ID]
-	if !exists {
+	unlock := lockMessage(i.Message.ID)
+	defer unlock()
+
+	loaded, err := bot.loadState(i.Message)
+	if err != nil {
+		if !errors.Is(err, state.ErrNotFound) {
+			log.Error(err)
+		}
 		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
@@ -600,9 +739,27 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		})
 		return
 	}
+	state := &loaded
+
+	// only the rooms are kept in the state, the results come from the cache
+	results, err := calc.Results.CalcSeed(slices.Clone(state.Rooms))
+	if err == nil && len(results) == 0 {
+		err = fmt.Errorf("no results for the seed of message %s", state.MessageID)
+	}
+	if err != nil {
+		log.Error(err)
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Go tell the developer he's an idiot 'cause something's broken idk",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
 
 	// Acknowledge the interaction first
-	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredMessageUpdate,
 	})
 	if err != nil {
@@ -610,33 +767,15 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 
-	// Reset the cleanup timer
-	if timer, exists := cleanupTimers[i.Message.ID]; exists {
-		timer.Reset(5 * time.Minute)
-	}
-
-	if timer, exists := showCalcTimers[i.Message.ID]; exists {
-		timer.Reset(longButtonDuration)
-	}
+	// Reset the cleanup
+	bot.saveState(*state)
 
 	if i.MessageComponentData().CustomID == ButtonCopyCalcCommand {
-		state, exists := messageStates[i.Message.ID]
-		if !exists {
-			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: "This interaction has expired. Please run the command again.",
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			})
-			return
-		}
-
 		// Send the calc command as an ephemeral message that the user can copy
 		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Content: fmt.Sprintf("```%s```\nCopy the command above to use with the PKD Bot!", state.CalcCommand),
+				Content: fmt.Sprintf("```%s```\nCopy the command above to use with the PKD Bot!", createCalcCommand(state.Rooms)),
 				Flags:   discordgo.MessageFlagsEphemeral,
 			},
 		})
@@ -645,7 +784,7 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 
 	if i.MessageComponentData().CustomID == ButtonShowCalc {
 		var result calc.CalcSeedResult
-		filteredResults := getFilteredResults(state)
+		filteredResults := getFilteredResults(results, state.Filter)
 		if len(filteredResults) > 0 {
 			if state.Index < len(filteredResults) {
 				result = filteredResults[state.Index]
@@ -653,23 +792,23 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				result = filteredResults[0] // Fallback to first result if index is out of bounds
 			}
 		} else {
-			result = state.Results[0] // Fallback to first result in original results
+			result = results[0] // Fallback to first result in original results
 		}
 
 		// Create detailed calculation message
 		detailedCalc := formatDetailedCalculation(state.Rooms, result)
 
 		// Check if we already have a calculation message for this interaction
-		if calcMsgID, exists := showCalcMessages[i.Message.ID]; exists {
+		if state.ShowCalcMessageID != "" {
 			// Edit the existing message instead of sending a new one
-			_, err = s.ChannelMessageEdit(i.ChannelID, calcMsgID, detailedCalc)
+			_, err = s.ChannelMessageEdit(i.ChannelID, state.ShowCalcMessageID, detailedCalc)
 			if err != nil {
 				log.Errorf("Failed to edit calculation message: %v", err)
-				// If edit fails (message might be deleted), remove from map and send a new one
-				delete(showCalcMessages, i.Message.ID)
+				// If edit fails (message might be deleted), forget it and send a new one
+				state.ShowCalcMessageID = ""
 				msg, err := s.ChannelMessageSend(i.ChannelID, detailedCalc)
 				if err == nil {
-					showCalcMessages[i.Message.ID] = msg.ID
+					state.ShowCalcMessageID = msg.ID
 				} else {
 					log.Errorf("Failed to send calculation details: %v", err)
 				}
@@ -681,9 +820,10 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				log.Errorf("Failed to send calculation details: %v", err)
 			} else {
 				// Store the message ID for future references
-				showCalcMessages[i.Message.ID] = msg.ID
+				state.ShowCalcMessageID = msg.ID
 			}
 		}
+		bot.saveState(*state)
 
 		// Edit the original interaction response to confirm
 		_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{})
@@ -700,12 +840,12 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			state.Index--
 		}
 	case ButtonNext:
-		if state.Index < len(getFilteredResults(state))-1 {
+		if state.Index < len(getFilteredResults(results, state.Filter))-1 {
 			state.Index++
 		}
 
 		// Check if the current result has a boost time >= boostless time
-		filteredResults := getFilteredResults(state)
+		filteredResults := getFilteredResults(results, state.Filter)
 		if len(filteredResults) > 0 && state.Index < len(filteredResults) {
 			result := filteredResults[state.Index]
 
@@ -737,16 +877,7 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				}
 
 				// Delete state since we're done with this interaction
-				delete(messageStates, i.Message.ID)
-				delete(showCalcMessages, i.Message.ID) // Clean up calculation message reference
-				if timer, exists := cleanupTimers[i.Message.ID]; exists {
-					timer.Stop()
-					delete(cleanupTimers, i.Message.ID)
-				}
-				if timer, exists := showCalcTimers[i.Message.ID]; exists {
-					timer.Stop()
-					delete(showCalcTimers, i.Message.ID)
-				}
+				bot.deleteState(i.Message.ID)
 
 				// Confirm interaction is complete
 				_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{})
@@ -763,7 +894,7 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	}
 
 	// Get filtered results
-	filteredResults := getFilteredResults(state)
+	filteredResults := getFilteredResults(results, state.Filter)
 
 	// Make sure we have results to display
 	if len(filteredResults) == 0 {
@@ -773,7 +904,7 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 
 	// Draw new image for the current index
 	currentResult := []calc.CalcSeedResult{filteredResults[state.Index]}
-	img, err := drawCalcResults(state.Rooms, currentResult)
+	img, err := render.CalcResults(state.Rooms, currentResult)
 	if err != nil {
 		log.Error(err)
 		return
@@ -785,7 +916,7 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
 		ID:          i.Message.ID,
 		Channel:     i.ChannelID,
-		Files:       []*discordgo.File{{Name: "result.png", Reader: bytes.NewReader(img.Bytes())}},
+		Files:       []*discordgo.File{{Name: seedFileName(state.Rooms), Reader: bytes.NewReader(img.Bytes())}},
 		Components:  &navButtons,
 		Attachments: &[]*discordgo.MessageAttachment{},
 	})
@@ -800,8 +931,8 @@ func buttonHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		log.Errorf("Failed to edit interaction response: %v", err)
 	}
 
-	// Update the state in our map
-	messageStates[i.Message.ID] = state
+	// Update the state in the store
+	bot.saveState(*state)
 }
 
 func formatDetailedCalculation(rooms []string, result calc.CalcSeedResult) string {
@@ -859,52 +990,15 @@ func formatDetailedCalculation(rooms []string, result calc.CalcSeedResult) strin
 
 		boostCalc.WriteString(boostLine.String())
 
-		if i == 0 {
-			boostlessCalc.WriteString(fmt.Sprintf(" - %5.2f (accounting for r1)", 0.3))
-			boostCalc.WriteString(fmt.Sprintf(" - %5.2f (accounting for r1)", 0.3))
-
-			boostlessTimeSum -= 0.3
-			boostTimeSum -= 0.3
-		} else {
-			prevRoom := rooms[i-1]
-
-			if prevRoom == "four towers" {
-				boostlessCalc.WriteString(fmt.Sprintf(" - %5.2f (four towers timesave)", 0.2))
-				boostCalc.WriteString(fmt.Sprintf(" - %5.2f (four towers timesave)", 0.2))
-
-				boostlessTimeSum -= 0.2
-				boostTimeSum -= 0.2
-			}
-
-			if prevRoom == "sandpit" || prevRoom == "castle wall" {
-				boostlessCalc.WriteString(fmt.Sprintf(" - %5.2f (ib hh)", 0.1))
-				boostCalc.WriteString(fmt.Sprintf(" - %5.2f (ib hh)", 0.1))
-
-				boostlessTimeSum -= 0.1
-				boostTimeSum -= 0.1
-			}
-
-			if prevRoom == "early 3+1" {
-				for _, boost := range boostRooms {
-					if boost.Ind == i-1 && boost.StratInd == 1 {
-						boostCalc.WriteString(fmt.Sprintf(" - %5.2f (early 3+1 boost timesave)", 0.5))
-
-						boostTimeSum -= 0.5
-						break
-					}
-				}
-			}
-
-			if prevRoom == "underbridge" {
-				for _, boost := range boostRooms {
-					if boost.Ind == i-1 && boost.StratInd == 1 {
-						boostCalc.WriteString(fmt.Sprintf(" - %5.2f (underbridge boost timesave)", 0.2))
+		for _, rule := range calc.AppliedTimesaves(rooms, i, result.BoostRooms, calc.RoomMap) {
+			boostCalc.WriteString(fmt.Sprintf(" - %5.2f (%s)", rule.Timesave, rule.Name))
+			boostTimeSum -= rule.Timesave
+		}
 
-						boostTimeSum -= 0.2
-						break
-					}
-				}
-			}
+		// boost dependent timesaves don't apply to the boostless run
+		for _, rule := range calc.AppliedTimesaves(rooms, i, nil, calc.RoomMap) {
+			boostlessCalc.WriteString(fmt.Sprintf(" - %5.2f (%s)", rule.Timesave, rule.Name))
+			boostlessTimeSum -= rule.Timesave
 		}
 
 		if i < len(rooms)-1 {
@@ -915,10 +1009,10 @@ func formatDetailedCalculation(rooms []string, result calc.CalcSeedResult) strin
 
 	separatorLine := strings.Repeat("-", maxRoomNameLength+20)
 
-	boostCalc.WriteString(fmt.Sprintf("\n%s\nTotal: %6.2f seconds = %s\n", separatorLine, boostTimeSum, FormatTime(boostTimeSum)))
+	boostCalc.WriteString(fmt.Sprintf("\n%s\nTotal: %6.2f seconds = %s\n", separatorLine, boostTimeSum, calc.FormatTime(boostTimeSum)))
 	boostCalc.WriteString("```\n")
 
-	boostlessCalc.WriteString(fmt.Sprintf("\n%s\nTotal: %6.2f seconds = %s\n", separatorLine, boostlessTimeSum, FormatTime(boostlessTimeSum)))
+	boostlessCalc.WriteString(fmt.Sprintf("\n%s\nTotal: %6.2f seconds = %s\n", separatorLine, boostlessTimeSum, calc.FormatTime(boostlessTimeSum)))
 	boostlessCalc.WriteString("```")
 
 	timeSaved := boostlessTimeSum - boostTimeSum
@@ -932,26 +1026,15 @@ func formatDetailedCalculation(rooms []string, result calc.CalcSeedResult) strin
 	return boostCalc.String() + "\n" + boostlessCalc.String() + "\n\n" + comparisonText
 }
 
-func getFilteredResults(state *ResultState) []calc.CalcSeedResult {
-	if state.Filter == ButtonAnyBoost {
-		return state.Results
-	}
-
-	filteredResults := make([]calc.CalcSeedResult, 0)
-	for _, result := range state.Results {
-		boostCount := len(result.BoostRooms)
-		switch state.Filter {
-		case ButtonTwoBoost:
-			if boostCount == 2 {
-				filteredResults = append(filteredResults, result)
-			}
-		case ButtonThreeBoost:
-			if boostCount == 3 {
-				filteredResults = append(filteredResults, result)
-			}
-		}
+func getFilteredResults(results []calc.CalcSeedResult, filter string) []calc.CalcSeedResult {
+	switch filter {
+	case ButtonTwoBoost:
+		return calc.FilterByBoosts(results, 2)
+	case ButtonThreeBoost:
+		return calc.FilterByBoosts(results, 3)
+	default:
+		return results
 	}
-	return filteredResults
 }
 
 func validateInput(input []string) (bool, error) {
@@ -1136,7 +1219,7 @@ func levenshteinDistance(a, b string) int {
 	return matrix[len(a)][len(b)]
 }
 
-func calcSeedHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (bot *Bot) calcSeedHandler(s Session, i *discordgo.InteractionCreate) {
 	logUserInteraction(i, "command", "calc")
 
 	defer func() {
@@ -1171,7 +1254,7 @@ func calcSeedHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 
-	res, err := calc.CalcSeed(selected)
+	res, err := calc.Results.CalcSeed(selected)
 	if err != nil {
 		log.Error(err)
 		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -1184,7 +1267,7 @@ func calcSeedHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	}
 
 	initialResult := []calc.CalcSeedResult{res[0]}
-	img, err := drawCalcResults(selected, initialResult)
+	img, err := render.CalcResults(selected, initialResult)
 	if err != nil {
 		log.Error(err)
 		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
@@ -1202,7 +1285,7 @@ func calcSeedHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		Data: &discordgo.InteractionResponseData{
 			Files: []*discordgo.File{
 				{
-					Name:   "result.png",
+					Name:   seedFileName(selected),
 					Reader: bytes.NewReader(img.Bytes()),
 				},
 			},
@@ -1222,18 +1305,17 @@ func calcSeedHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	}
 
 	// Store state with message ID
-	messageStates[message.ID] = &ResultState{
-		Rooms:   selected,
-		Results: res,
-		Index:   0,
-		Filter:  ButtonAnyBoost,
-	}
-
-	timer := cleanupMessageState(message.ID, s, message.ChannelID, true)
-	cleanupTimers[message.ID] = timer
+	bot.saveState(state.Message{
+		MessageID: message.ID,
+		ChannelID: message.ChannelID,
+		Rooms:     selected,
+		Index:     0,
+		Filter:    ButtonAnyBoost,
+		Stage:     state.StageNavigation,
+	})
 }
 
-func allSplitsHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func allSplitsHandler(s Session, i *discordgo.InteractionCreate) {
 	logUserInteraction(i, "command", "allsplits")
 
 	// First, respond to acknowledge the command
@@ -1318,7 +1400,7 @@ func createAllSplitsSummaryEmbed() *discordgo.MessageEmbed {
 	}
 }
 
-func autocompleteHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func autocompleteHandler(s Session, i *discordgo.InteractionCreate) {
 	log.Debug("Autocomplete handler triggered")
 
 	data := i.ApplicationCommandData()
@@ -1326,6 +1408,11 @@ func autocompleteHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
 
 	selectedOptions := make(map[string]bool)
 	for _, opt := range data.Options {
+		// other commands can have attachments and such in there
+		if opt.Type != discordgo.ApplicationCommandOptionString {
+			continue
+		}
+
 		if !opt.Focused {
 			selectedOptions[opt.StringValue()] = true
 		}
@@ -1408,15 +1495,15 @@ func logUserInteraction(i *discordgo.InteractionCreate, interactionType string,
 	}
 }
 
-func logBotPermissions() {
-	if s == nil || s.State == nil || s.State.User == nil {
+func (bot *Bot) logBotPermissions() {
+	if bot.gateway == nil || bot.gateway.State == nil || bot.gateway.State.User == nil {
 		log.Error("Discord session or user is not initialized, cannot check permissions")
 		return
 	}
 
 	log.Info("=== Checking Bot Permissions ===")
-	botID := s.State.User.ID
-	botUsername := s.State.User.Username
+	botID := bot.gateway.State.User.ID
+	botUsername := bot.gateway.State.User.Username
 
 	// Map to translate permission bits to readable names
 	permissionNames := map[int64]string{
@@ -1435,30 +1522,30 @@ func logBotPermissions() {
 	}
 
 	// Check if GUILD_ID is set
-	if GuildID == "" {
+	if bot.guildID == "" {
 		log.Error("GUILD_ID is not set in environment variables, can't check permissions")
 		return
 	}
 
 	// Get the specific guild
-	guild, err := s.Guild(GuildID)
+	guild, err := bot.gateway.Guild(bot.guildID)
 	if err != nil {
-		log.Errorf("Could not get details for guild ID %s: %v", GuildID, err)
+		log.Errorf("Could not get details for guild ID %s: %v", bot.guildID, err)
 		return
 	}
 
 	log.Infof("Bot %s#%s (ID: %s) checking permissions in server: %s",
-		botUsername, s.State.User.Discriminator, botID, guild.Name)
+		botUsername, bot.gateway.State.User.Discriminator, botID, guild.Name)
 
 	// Get bot's roles in this guild
-	botMember, err := s.GuildMember(GuildID, botID)
+	botMember, err := bot.gateway.GuildMember(bot.guildID, botID)
 	if err != nil {
 		log.Errorf("Could not get bot's member info in guild %s: %v", guild.Name, err)
 		return
 	}
 
 	// Get all roles to find bot's roles
-	roles, err := s.GuildRoles(GuildID)
+	roles, err := bot.gateway.GuildRoles(bot.guildID)
 	if err != nil {
 		log.Errorf("Could not get roles for guild %s: %v", guild.Name, err)
 		return
@@ -1485,7 +1572,7 @@ func logBotPermissions() {
 	}
 
 	// Check permissions in specific channels
-	channels, err := s.GuildChannels(GuildID)
+	channels, err := bot.gateway.GuildChannels(bot.guildID)
 	if err != nil {
 		log.Errorf("Could not get channels for guild %s: %v", guild.Name, err)
 		return
@@ -1501,39 +1588,39 @@ func logBotPermissions() {
 
 	log.Infof("Checking permissions in %d text channels", len(textChannels))
 
-	// Find #bot-commands channel specifically
+	// Find the announcement channel specifically
 	var botCommandsChannel *discordgo.Channel
 	for _, channel := range textChannels {
-		if channel.Name == "bot-commands" {
+		if channel.Name == bot.announcementChannelName {
 			botCommandsChannel = channel
 			break
 		}
 	}
 
-	// First check the bot-commands channel if found
+	// First check the announcement channel if found
 	if botCommandsChannel != nil {
-		perms, err := s.State.UserChannelPermissions(botID, botCommandsChannel.ID)
+		perms, err := bot.gateway.State.UserChannelPermissions(botID, botCommandsChannel.ID)
 		if err != nil {
-			log.Errorf("Error getting permissions for #bot-commands: %v", err)
+			log.Errorf("Error getting permissions for #%s: %v", bot.announcementChannelName, err)
 		} else {
-			log.Infof("=== #bot-commands Channel (ID: %s) ===", botCommandsChannel.ID)
+			log.Infof("=== #%s Channel (ID: %s) ===", bot.announcementChannelName, botCommandsChannel.ID)
 			logChannelPermissions(perms, permissionNames)
 
 			// Also store this ID for later use
-			BotCommandsChannelID = botCommandsChannel.ID
+			bot.announcementChannelIDs.Store(bot.guildID, botCommandsChannel.ID)
 		}
 	} else {
-		log.Warning("No #bot-commands channel found in this guild!")
+		log.Warningf("No #%s channel found in this guild!", bot.announcementChannelName)
 	}
 
 	// Log permissions for all text channels
 	for _, channel := range textChannels {
-		// Skip if this is the bot-commands channel we already checked
+		// Skip if this is the announcement channel we already checked
 		if botCommandsChannel != nil && channel.ID == botCommandsChannel.ID {
 			continue
 		}
 
-		perms, err := s.State.UserChannelPermissions(botID, channel.ID)
+		perms, err := bot.gateway.State.UserChannelPermissions(botID, channel.ID)
 		if err != nil {
 			log.Errorf("Error getting permissions for channel %s: %v", channel.Name, err)
 			continue
@@ -0,0 +1,464 @@
+package discord_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/discord"
+	"pkd-bot/discord/discordtest"
+	"pkd-bot/events"
+	"pkd-bot/state"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var testRooms = []string{"around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"}
+
+var member = &discordgo.Member{User: &discordgo.User{ID: "user", Username: "player"}}
+
+// roomOptions are the room options of /calc
+func roomOptions(rooms []string) []*discordgo.ApplicationCommandInteractionDataOption {
+	var options []*discordgo.ApplicationCommandInteractionDataOption
+	for _, room := range rooms {
+		options = append(options, option("room", discordgo.ApplicationCommandOptionString, room))
+	}
+	return options
+}
+
+func click(id string, message *discordgo.Message, button string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        id,
+		Type:      discordgo.InteractionMessageComponent,
+		ChannelID: message.ChannelID,
+		Message:   message,
+		Member:    member,
+		Data:      discordgo.MessageComponentInteractionData{CustomID: button, ComponentType: discordgo.ButtonComponent},
+	}}
+}
+
+// buttons are the custom ids of a message's buttons
+func buttons(message *discordgo.Message) []string {
+	var ids []string
+	for _, row := range message.Components {
+		for _, component := range row.(*discordgo.ActionsRow).Components {
+			ids = append(ids, component.(*discordgo.Button).CustomID)
+		}
+	}
+	return ids
+}
+
+// runCalc runs /calc with the test rooms and returns the message it responded with
+func runCalc(t *testing.T, fake *discordtest.Session) *discordgo.Message {
+	t.Helper()
+
+	discord.CalcSeedHandler(fake, commandInteraction("calc", "calc", member, roomOptions(testRooms)...))
+	messages := fake.Messages("commands")
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want the response to /calc", len(messages))
+	}
+	return messages[0]
+}
+
+func TestCalcSeedHandler(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+
+	message := runCalc(t, fake)
+	if len(message.Attachments) != 1 || message.Attachments[0].Filename != discord.SeedFileName(testRooms) {
+		t.Errorf("got attachments %+v, want the image named after the seed", message.Attachments)
+	}
+	if got := buttons(message); len(got) == 0 || got[0] != discord.ButtonPrevious {
+		t.Errorf("got buttons %v, want the navigation", got)
+	}
+
+	m, err := discord.States().Get(message.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ChannelID != "commands" || m.Index != 0 || m.Filter != discord.ButtonAnyBoost || m.Stage != state.StageNavigation {
+		t.Errorf("got state %+v, want the first result of any boost", m)
+	}
+	if !m.Expires.After(time.Now()) {
+		t.Errorf("the state expires at %v, which has passed", m.Expires)
+	}
+}
+
+func TestCalcSeedHandlerRejectsTooFewRooms(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+
+	discord.CalcSeedHandler(fake, commandInteraction("calc", "calc", member, roomOptions(testRooms[:7])...))
+
+	responses := fake.Responses()
+	if len(responses) != 1 || !strings.Contains(responses[0].Data.Content, "expecting 8 rooms") {
+		t.Fatalf("got %+v, want the rooms to be rejected", responses)
+	}
+	if n, _ := discord.States().Len(); n != 0 {
+		t.Errorf("got %d states, want none for a rejected command", n)
+	}
+}
+
+func TestButtonHandlerFiltersAndShowsCalc(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+	message := runCalc(t, fake)
+
+	discord.ButtonHandler(fake, click("filter", message, discord.ButtonTwoBoost))
+
+	m, err := discord.States().Get(message.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Filter != discord.ButtonTwoBoost || m.Index != 0 {
+		t.Errorf("got state %+v, want the first 2 boost result", m)
+	}
+	edits := fake.Edits()
+	if len(edits) != 1 || len(edits[0].Files) != 1 || edits[0].Files[0].Name != discord.SeedFileName(testRooms) {
+		t.Fatalf("got edits %+v, want the image to be redrawn", edits)
+	}
+
+	message = fake.Message(message.ID)
+	discord.ButtonHandler(fake, click("show", message, discord.ButtonShowCalc))
+	discord.ButtonHandler(fake, click("show again", message, discord.ButtonShowCalc))
+
+	messages := fake.Messages("commands")
+	if len(messages) != 2 || !strings.Contains(messages[1].Content, "Boost time calculation") {
+		t.Fatalf("got %d messages, want the calculation to be sent once and edited after", len(messages))
+	}
+	if m, _ := discord.States().Get(message.ID); m.ShowCalcMessageID != messages[1].ID {
+		t.Errorf("got show calc message %q, want %q", m.ShowCalcMessageID, messages[1].ID)
+	}
+}
+
+func TestButtonHandlerExpired(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+
+	// a message from before the images were named after the seed
+	message, _ := fake.ChannelMessageSendComplex("commands", &discordgo.MessageSend{
+		Files: []*discordgo.File{{Name: "seed_results.png", Reader: strings.NewReader("png")}},
+	})
+	discord.ButtonHandler(fake, click("click", message, discord.ButtonNext))
+
+	responses := fake.Responses()
+	if len(responses) != 1 || !strings.Contains(responses[0].Data.Content, "expired") ||
+		responses[0].Data.Flags&discordgo.MessageFlagsEphemeral == 0 {
+		t.Errorf("got %+v, want an ephemeral expiry notice", responses)
+	}
+}
+
+func TestButtonHandlerRebuildsLostState(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+	message := runCalc(t, fake)
+
+	// a restart with the memory store
+	discord.States().Delete(message.ID)
+	discord.ButtonHandler(fake, click("filter", message, discord.ButtonThreeBoost))
+
+	m, err := discord.States().Get(message.ID)
+	if err != nil {
+		t.Fatalf("got %v, want the state rebuilt from the image's name", err)
+	}
+	if m.Filter != discord.ButtonThreeBoost || len(m.Rooms) != 8 || m.Rooms[1] != "blocks" {
+		t.Errorf("got state %+v, want the seed with the clicked filter", m)
+	}
+	if len(fake.Edits()) != 1 {
+		t.Errorf("got %d edits, want the message redrawn", len(fake.Edits()))
+	}
+}
+
+func seedSubmitted(t *testing.T) events.SeedSubmitted {
+	t.Helper()
+
+	results, err := calc.Results.CalcSeed(append([]string(nil), testRooms...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := results[0]
+	result.BoostTime = calc.DefaultAnnouncementThreshold - 1
+
+	return events.SeedSubmitted{
+		Ign:      "Finder",
+		Lobby:    "m1A",
+		TimeLeft: "2:30",
+		Rooms:    testRooms,
+		Result:   result,
+		At:       time.Now(),
+	}
+}
+
+func TestAnnounceSeed(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("guild", "general", "general")
+	fake.AddChannel("guild", "announcements", discord.AnnouncementChannel)
+	discord.UseFakes(t, fake)
+	e := seedSubmitted(t)
+
+	discord.AnnounceSeed(e)
+	discord.AnnounceSeed(e)
+
+	messages := fake.Messages("announcements")
+	if len(messages) != 1 {
+		t.Fatalf("got %d announcements, want the seed announced once", len(messages))
+	}
+	if !strings.Contains(messages[0].Content, "Finder") || !strings.Contains(messages[0].Content, "m1A") {
+		t.Errorf("got %q, want the finder and the lobby", messages[0].Content)
+	}
+	if got := buttons(messages[0]); len(got) != 2 || got[0] != discord.ButtonShowCalc {
+		t.Errorf("got buttons %v, want show calc and copy command", got)
+	}
+
+	if _, err := discord.States().Get(messages[0].ID); err != nil {
+		t.Errorf("got %v, want the announcement's state", err)
+	}
+	announcements, err := discord.Storage().AnnouncementsSince(context.Background(), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(announcements) != 1 || announcements[0].MessageID != messages[0].ID {
+		t.Errorf("got %+v, want the announcement recorded", announcements)
+	}
+}
+
+func TestAnnounceSeedSkips(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int64
+		change      func(e *events.SeedSubmitted)
+	}{
+		{name: "debug", permissions: discordgo.PermissionAll, change: func(e *events.SeedSubmitted) { e.Debug = true }},
+		{name: "slow", permissions: discordgo.PermissionAll, change: func(e *events.SeedSubmitted) { e.Result.BoostTime = calc.DefaultAnnouncementThreshold }},
+		{name: "no permission", permissions: discordgo.PermissionViewChannel, change: func(e *events.SeedSubmitted) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := discordtest.NewSession(t)
+			fake.AddChannel("guild", "announcements", discord.AnnouncementChannel)
+			fake.Permissions = tt.permissions
+			discord.UseFakes(t, fake)
+
+			e := seedSubmitted(t)
+			tt.change(&e)
+			discord.AnnounceSeed(e)
+
+			if messages := fake.Messages("announcements"); len(messages) != 0 {
+				t.Errorf("got %d announcements, want none", len(messages))
+			}
+		})
+	}
+}
+
+func TestAnnounceSeedAfterFailedSend(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("guild", "announcements", discord.AnnouncementChannel)
+	discord.UseFakes(t, fake)
+	e := seedSubmitted(t)
+
+	fake.SendErr = errors.New("discord is down")
+	discord.AnnounceSeed(e)
+	if messages := fake.Messages("announcements"); len(messages) != 0 {
+		t.Fatalf("got %d announcements, want none", len(messages))
+	}
+
+	// the seed wasn't announced, so the next finder gets it announced
+	fake.SendErr = nil
+	discord.AnnounceSeed(e)
+	if messages := fake.Messages("announcements"); len(messages) != 1 {
+		t.Errorf("got %d announcements, want the seed announced once it could be sent", len(messages))
+	}
+}
+
+// expire makes the janitor's next look at the message find it expired
+func expire(t *testing.T, messageID string) {
+	t.Helper()
+
+	m, err := discord.States().Get(messageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Expires = time.Now().Add(-time.Second)
+	if err := discord.States().Put(m); err != nil {
+		t.Fatal(err)
+	}
+	discord.ExpireMessage(m)
+}
+
+func TestExpireMessage(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+	message := runCalc(t, fake)
+
+	expire(t, message.ID)
+
+	message = fake.Message(message.ID)
+	if got := buttons(message); len(got) != 1 || got[0] != discord.ButtonShowCalc {
+		t.Errorf("got buttons %v, want only show calc", got)
+	}
+	if len(message.Attachments) != 1 || message.Attachments[0].Filename != discord.SeedFileName(testRooms) {
+		t.Errorf("got attachments %+v, want the image kept under its name", message.Attachments)
+	}
+	if m, _ := discord.States().Get(message.ID); m.Stage != state.StageShowCalc || !m.Expires.After(time.Now()) {
+		t.Errorf("got state %+v, want the show calc stage", m)
+	}
+
+	expire(t, message.ID)
+
+	if got := buttons(fake.Message(message.ID)); len(got) != 0 {
+		t.Errorf("got buttons %v, want none", got)
+	}
+	if _, err := discord.States().Get(message.ID); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("got %v, want the state to be gone", err)
+	}
+}
+
+func TestExpireDeletedMessage(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+	message := runCalc(t, fake)
+
+	fake.DeleteMessage(message.ID)
+	expire(t, message.ID)
+
+	if _, err := discord.States().Get(message.ID); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("got %v, want the state of the deleted message to be gone", err)
+	}
+}
+
+func TestLockMessageAfterItsForgotten(t *testing.T) {
+	unlock := discord.LockMessage("message")
+
+	waiting := make(chan func())
+	go func() { waiting <- discord.LockMessage("message") }()
+	// let it wait on the lock that's about to be forgotten
+	time.Sleep(20 * time.Millisecond)
+
+	discord.ForgetMessageLock("message")
+	unlock()
+	unlockWaiting := <-waiting
+
+	next := make(chan func())
+	go func() { next <- discord.LockMessage("message") }()
+	select {
+	case <-next:
+		t.Fatal("locked the message while someone else held it")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlockWaiting()
+	(<-next)()
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/splits.json":
+			w.Write([]byte("{}"))
+		case "/big.json":
+			w.Write(make([]byte, discord.MaxAttachmentSize+1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	if content, err := discord.DownloadAttachment(srv.URL + "/splits.json"); err != nil || string(content) != "{}" {
+		t.Errorf("got %q, %v, want the file", content, err)
+	}
+	if _, err := discord.DownloadAttachment(srv.URL + "/gone.json"); err == nil {
+		t.Error("want an error for a missing file")
+	}
+	if _, err := discord.DownloadAttachment(srv.URL + "/big.json"); err == nil {
+		t.Error("want an error for a file that's too big")
+	}
+}
+
+func TestDownloadPkdutilsSplitsChecksThem(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good.json":
+			w.Write([]byte(`{"fences": {"boostless_time": 9000, "boost_strats": [{"name": "Pillar", "time": 7000, "boost_time": 2000}]}}`))
+		case "/bad.json":
+			w.Write([]byte(`{"fences": {"boostless_time": 0}}`))
+		}
+	}))
+	defer srv.Close()
+
+	splits, err := discord.DownloadPkdutilsSplits(srv.URL + "/good.json")
+	if err != nil || splits["fences"].BoostlessTime != 9 {
+		t.Errorf("got %+v, %v, want the splits in seconds", splits, err)
+	}
+	if _, err := discord.DownloadPkdutilsSplits(srv.URL + "/bad.json"); err == nil || !strings.Contains(err.Error(), "fences") {
+		t.Errorf("got %v, want the room without a boostless time named", err)
+	}
+}
+
+func TestReportRejectionOnce(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("guild", "mod-log", discord.ModLogChannel)
+	discord.UseFakes(t, fake)
+
+	// the bus hands every rejection to its own goroutine
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			discord.ReportRejection(events.SubmissionRejected{RemoteAddr: "192.0.2.1", Reason: "bad signature"})
+		}()
+	}
+	wg.Wait()
+
+	if messages := fake.Messages("mod-log"); len(messages) != 1 {
+		t.Errorf("got %d reports, want the rejection reported once", len(messages))
+	}
+}
+
+func TestDuelUsesUploadedSplits(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+
+	splits := map[string]calc.PkdutilsSplit{"fences": {BoostlessTime: 9000}}
+	if err := discord.Storage().PutSplits(context.Background(), "Alice", splits); err != nil {
+		t.Fatal(err)
+	}
+
+	duel := func(id string) *discordgo.Message {
+		t.Helper()
+
+		var options []*discordgo.ApplicationCommandInteractionDataOption
+		for n, room := range testRooms {
+			options = append(options, option(fmt.Sprintf("room_%d", n+1), discordgo.ApplicationCommandOptionString, room))
+		}
+		options = append(options,
+			option("player_1_name", discordgo.ApplicationCommandOptionString, "alice"),
+			option("player_2_name", discordgo.ApplicationCommandOptionString, "Bob"))
+		discord.DuelHandler(fake, commandInteraction("duel", id, member, options...))
+
+		messages := fake.Messages("commands")
+		if len(messages) == 0 {
+			t.Fatal("got no response")
+		}
+		return messages[len(messages)-1]
+	}
+
+	if got := duel("duel 1"); !strings.Contains(got.Content, "Bob") || len(got.Attachments) != 0 {
+		t.Errorf("got %q, want to be asked for the splits of the player that never uploaded any", got.Content)
+	}
+
+	if err := discord.Storage().PutSplits(context.Background(), "bob", splits); err != nil {
+		t.Fatal(err)
+	}
+	if got := duel("duel 2"); len(got.Attachments) != 1 || got.Attachments[0].Filename != "duel.png" {
+		t.Errorf("got %q, want the duel of the uploaded splits", got.Content)
+	}
+}
@@ -0,0 +1,36 @@
+package discord
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxAttachmentSize is more than any splits file needs, bigger attachments aren't read
+const maxAttachmentSize = 1 << 20
+
+// attachmentClient downloads the files users attach to commands, discord's cdn answers well within the timeout
+var attachmentClient = &http.Client{Timeout: 10 * time.Second}
+
+// downloadAttachment returns the content of the file at url, at most maxAttachmentSize of it
+func downloadAttachment(url string) ([]byte, error) {
+	resp, err := attachmentClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the attachment: got status %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxAttachmentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the attachment: %w", err)
+	}
+	if len(content) > maxAttachmentSize {
+		return nil, fmt.Errorf("the attachment is bigger than %d bytes", maxAttachmentSize)
+	}
+	return content, nil
+}
@@ -64,3 +64,16 @@ func (sc *SeedCache) MarkSeen(seedKey string) {
 
 	sc.cache[seedKey] = time.Now()
 }
+
+// MarkNew marks a seed as seen, it's false if it already was. Checking and marking at once keeps two callers
+// from both taking the seed as new
+func (sc *SeedCache) MarkNew(seedKey string) bool {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if _, exists := sc.cache[seedKey]; exists {
+		return false
+	}
+	sc.cache[seedKey] = time.Now()
+	return true
+}
@@ -2,289 +2,304 @@ package discord
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"pkd-bot/calc"
+	"pkd-bot/events"
+	"pkd-bot/metrics"
+	"pkd-bot/render"
+	"pkd-bot/state"
+	"pkd-bot/storage"
 
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
 )
 
-var BotCommandsChannelID = ""
-
-var ct2blrk = map[string]string{
-	"Early 3-1":   "Early 3+1",
-	"Glass Neo":   "Rng Skip",
-	"Overhead 4B": "Overhead 4b",
-}
-
-type BoostRoomsResponse struct {
-	Name     string  `json:"name"`
-	Pacelock float64 `json:"pacelock"`
-	Index    int     `json:"index"`
-}
-
 var seedCache = NewSeedCache(1 * time.Hour)
 
-func ChattriggersHandle(rooms []string, timeLeft, lobby, ign string, debug bool) (calc.CalcSeedResult, []BoostRoomsResponse, error) {
-	if s == nil {
-		return calc.CalcSeedResult{}, nil, fmt.Errorf("discord session is not initialized")
-	}
-
-	for i, r := range rooms {
-		blrkRoom, exists := ct2blrk[r]
-		if exists {
-			rooms[i] = blrkRoom
-		}
-
-		rooms[i] = strings.ToLower(rooms[i])
-	}
-	rooms = append(rooms, "finish room")
+// modLogChannel returns the id of the mod log channel, it's looked up again until it's found
+func (bot *Bot) modLogChannel() string {
+	bot.modLogMu.Lock()
+	defer bot.modLogMu.Unlock()
 
-	if BotCommandsChannelID == "" {
-		BotCommandsChannelID = GetChannelIDByName("bot-commands")
-		if BotCommandsChannelID == "" {
-			return calc.CalcSeedResult{}, nil, fmt.Errorf("could not find #bot-commands channel")
-		}
+	if bot.modLogChannelID == "" {
+		bot.modLogChannelID = bot.GetChannelIDByName(bot.modLogChannelName)
 	}
+	return bot.modLogChannelID
+}
 
-	if err := checkBotPermissions(BotCommandsChannelID); err != nil {
-		return calc.CalcSeedResult{}, nil, fmt.Errorf("permission error: %w", err)
-	}
+// the same rejection is only reported once in a while, so someone hammering the api doesn't flood the mod log
+var rejectionCache = NewSeedCache(10 * time.Minute)
 
-	results, err := calc.CalcSeed(rooms)
-	if err != nil {
-		return calc.CalcSeedResult{}, nil, fmt.Errorf("error calculating seed: %w", err)
+// announceSeed posts fast seeds submitted through ChatTriggers to the announcement channel of every guild,
+// if they're under the guild's threshold. Every guild gets a seed of a lobby only once, the others in the lobby
+// submitting it are added to the announcement as finders while the lobby hasn't requeued. The subscribers are
+// DMed about seeds that were announced somewhere
+func (bot *Bot) announceSeed(e events.SeedSubmitted) {
+	if e.Debug {
+		return
 	}
 
-	if len(results) == 0 {
-		return calc.CalcSeedResult{}, nil, fmt.Errorf("no results found for the given rooms")
+	// most submissions are too slow for every guild
+	guildIDs := bot.announcementGuilds()
+	if e.Result.BoostTime >= bot.highestThreshold(guildIDs) {
+		return
 	}
 
-	bestResult := results[0]
-
-	seedKey := strings.Join(rooms, "|")
-
-	if bestResult.BoostTime < 130 && !seedCache.HasSeen(seedKey) && !debug {
-		seedCache.MarkSeen(seedKey)
-
-		img, err := drawCalcResults(rooms, []calc.CalcSeedResult{bestResult})
-		if err != nil {
-			return calc.CalcSeedResult{}, nil, fmt.Errorf("error drawing seed results: %w", err)
+	var img *bytes.Buffer
+	var imgErr error
+	announced := false
+	for _, guildID := range guildIDs {
+		settings := bot.guildSettings(guildID)
+		if e.Result.BoostTime >= bot.announcementThreshold(settings) {
+			continue
 		}
 
-		content := fmt.Sprintf("%s has found a %s seed, %s requeues in %s",
-			ign, FormatTime(bestResult.BoostTime), lobby, timeLeft)
-
-		calcCommand := createCalcCommand(rooms[:len(rooms)-1]) // Exclude "finish room"
+		now := time.Now()
+		live, isNew := claimAnnouncement(guildID, e, now)
+		if live == nil {
+			continue
+		}
+		if !isNew {
+			log.Infof("Merged %s into the announcement of the seed in %s", e.Ign, e.Lobby)
+			bot.updateLiveAnnouncement(live, now)
+			continue
+		}
 
-		components := []discordgo.MessageComponent{
-			discordgo.ActionsRow{
-				Components: []discordgo.MessageComponent{
-					discordgo.Button{
-						CustomID: ButtonShowCalc,
-						Label:    "How did you get this?",
-						Style:    discordgo.SuccessButton,
-					},
-					discordgo.Button{
-						CustomID: ButtonCopyCalcCommand,
-						Label:    "Copy Calc Command",
-						Style:    discordgo.PrimaryButton,
-						Emoji: &discordgo.ComponentEmoji{
-							Name: "📋",
-						},
-					},
-				},
-			},
+		channelID := bot.announcementChannelID(settings)
+		if channelID == "" {
+			log.Errorf("could not find #%s channel in guild %s", bot.announcementChannelName, guildID)
+			releaseAnnouncement(guildID, e, live)
+			continue
 		}
 
-		message, err := s.ChannelMessageSendComplex(BotCommandsChannelID, &discordgo.MessageSend{
-			Content:    content,
-			Components: components,
-			Files: []*discordgo.File{
-				{
-					Name:   "seed.png",
-					Reader: bytes.NewReader(img.Bytes()),
-				},
-			},
-		})
-		if err != nil {
-			return calc.CalcSeedResult{}, nil, fmt.Errorf("error sending message to Discord: %w", err)
+		if err := bot.checkBotPermissions(channelID, !settings.HideImage); err != nil {
+			log.Errorf("permission error: %v", err)
+			releaseAnnouncement(guildID, e, live)
+			continue
 		}
 
-		messageStates[message.ID] = &ResultState{
-			Rooms:       rooms[:len(rooms)-1],
-			Results:     []calc.CalcSeedResult{bestResult},
-			Index:       0,
-			Filter:      ButtonAnyBoost,
-			CalcCommand: calcCommand, // Store the calc command in the state
+		// the image is the same for every guild, the ones that hide it are still announced when it can't be drawn
+		if img == nil && imgErr == nil && !settings.HideImage {
+			drawn, err := render.CalcResults(e.Rooms, []calc.CalcSeedResult{e.Result})
+			if err != nil {
+				log.Errorf("error drawing seed results: %v", err)
+				imgErr = err
+			} else {
+				img = &drawn
+			}
+		}
+		if img == nil && !settings.HideImage {
+			releaseAnnouncement(guildID, e, live)
+			continue
 		}
 
-		cleanupTimers[message.ID] = cleanupMessageState(message.ID, s, BotCommandsChannelID, true)
+		if !bot.sendAnnouncement(e, settings, channelID, img, live) {
+			releaseAnnouncement(guildID, e, live)
+			continue
+		}
+		seedCache.MarkSeen(liveKey(guildID, e))
+		announced = true
 	}
 
-	boostRooms := make([]BoostRoomsResponse, 0)
-	for _, room := range bestResult.BoostRooms {
-		boostRooms = append(boostRooms, BoostRoomsResponse{
-			Name:     fmt.Sprintf("%s (%s)", calc.RoomMap[rooms[room.Ind]].Name, calc.RoomMap[rooms[room.Ind]].BoostStrats[room.StratInd].Name),
-			Pacelock: room.Pacelock,
-			Index:    room.Ind,
-		})
+	if announced {
+		bot.notifySubscribers(e)
 	}
-
-	return bestResult, boostRooms, nil
 }
 
-type PkdutilResult struct {
-	Best struct {
-		Result     calc.CalcSeedResult
-		BoostRooms []BoostRoomsResponse
+// sendAnnouncement posts live, a claimed announcement, and is false if it couldn't
+func (bot *Bot) sendAnnouncement(e events.SeedSubmitted, settings storage.GuildSettings, channelID string, img *bytes.Buffer, live *liveAnnouncement) bool {
+	// only the configured roles are pinged, whatever else ends up in the message
+	allowedMentions := &discordgo.MessageAllowedMentions{}
+	roleIDs := bot.tierPings(settings.GuildID, e)
+	if settings.PingRoleID != "" && !slices.Contains(roleIDs, settings.PingRoleID) {
+		roleIDs = append([]string{settings.PingRoleID}, roleIDs...)
 	}
-	Personal struct {
-		Result     calc.CalcSeedResult
-		BoostRooms []BoostRoomsResponse
+	mentions := make([]string, 0, len(roleIDs))
+	for _, roleID := range roleIDs {
+		mentions = append(mentions, fmt.Sprintf("<@&%s>", roleID))
+	}
+	if len(roleIDs) > 0 {
+		allowedMentions.Roles = roleIDs
 	}
-}
 
-func PkdutilsHandle(rooms []string, splits map[string]calc.Room) (PkdutilResult, error) {
-	if s == nil {
-		return PkdutilResult{}, fmt.Errorf("discord session is not initialized")
+	liveMu.Lock()
+	live.mentions = strings.Join(mentions, " ")
+	content := live.content(time.Now())
+	sentFinders := len(live.finders)
+	liveMu.Unlock()
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					CustomID: ButtonShowCalc,
+					Label:    "How did you get this?",
+					Style:    discordgo.SuccessButton,
+				},
+				discordgo.Button{
+					CustomID: ButtonCopyCalcCommand,
+					Label:    "Copy Calc Command",
+					Style:    discordgo.PrimaryButton,
+					Emoji: &discordgo.ComponentEmoji{
+						Name: "📋",
+					},
+				},
+			},
+		},
 	}
 
-	for i := range rooms {
-		rooms[i] = strings.ToLower(rooms[i])
+	var files []*discordgo.File
+	if !settings.HideImage {
+		files = []*discordgo.File{
+			{
+				Name:   seedFileName(e.Rooms),
+				Reader: bytes.NewReader(img.Bytes()),
+			},
+		}
 	}
-	rooms = append(rooms, "finish room")
 
-	// calc with calc splits first
-	results, err := calc.CalcSeed(rooms)
+	message, err := bot.s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         content,
+		Components:      components,
+		Files:           files,
+		AllowedMentions: allowedMentions,
+	})
 	if err != nil {
-		return PkdutilResult{}, fmt.Errorf("error calculating seed: %w", err)
+		log.Errorf("error sending message to Discord: %v", err)
+		return false
+	}
+	metrics.Announcements.WithLabelValues("seed").Inc()
+
+	liveMu.Lock()
+	live.channelID, live.messageID, live.shown = message.ChannelID, message.ID, content
+	merged := len(live.finders) > sentFinders
+	liveMu.Unlock()
+	if merged {
+		bot.updateLiveAnnouncement(live, time.Now())
 	}
 
-	if len(results) == 0 {
-		return PkdutilResult{}, fmt.Errorf("no results found for the given rooms")
+	err = bot.store.AddAnnouncement(context.Background(), &storage.Announcement{
+		Ign:       e.Ign,
+		Lobby:     e.Lobby,
+		Rooms:     e.Rooms,
+		BoostTime: e.Result.BoostTime,
+		ChannelID: message.ChannelID,
+		MessageID: message.ID,
+		GuildID:   settings.GuildID,
+		At:        message.Timestamp,
+	})
+	if err != nil {
+		log.Warn(err)
 	}
 
-	bestResult := results[0]
+	bot.saveState(state.Message{
+		MessageID: message.ID,
+		ChannelID: channelID,
+		Rooms:     e.Rooms,
+		Index:     0,
+		Filter:    ButtonAnyBoost,
+		Stage:     state.StageNavigation,
+	})
+	return true
+}
 
-	boostRooms := make([]BoostRoomsResponse, 0)
-	for _, room := range bestResult.BoostRooms {
-		boostRooms = append(boostRooms, BoostRoomsResponse{
-			Name:     fmt.Sprintf("%s (%s)", calc.RoomMap[rooms[room.Ind]].Name, calc.RoomMap[rooms[room.Ind]].BoostStrats[room.StratInd].Name),
-			Pacelock: room.Pacelock,
-			Index:    room.Ind,
-		})
+// reportRejection tells the moderators about ChatTriggers submissions the api rejected, in the mod log channel
+func (bot *Bot) reportRejection(e events.SubmissionRejected) {
+	// anyone can make up a key id, only known keys are told apart by it
+	rejectionKey := strings.Join([]string{e.RemoteAddr, e.Reason}, "|")
+	if e.Owner != "" {
+		rejectionKey = strings.Join([]string{e.KeyID, e.Ign, e.Reason}, "|")
 	}
-
-	// calc with personal splits next
-	personalResults, err := calc.CalcSeedCustom(rooms, splits)
-	if err != nil {
-		return PkdutilResult{}, fmt.Errorf("error calculating seed: %w", err)
+	channelID := bot.modLogChannel()
+	if channelID == "" {
+		log.Errorf("could not find #%s channel", bot.modLogChannelName)
+		return
 	}
-	log.Debugf("%+v", personalResults[0])
-
-	if len(personalResults) == 0 {
-		return PkdutilResult{}, fmt.Errorf("no results found for the given rooms")
+	if !rejectionCache.MarkNew(rejectionKey) {
+		return
 	}
 
-	personalResult := personalResults[0]
-
-	personalBoostRooms := make([]BoostRoomsResponse, 0)
-	for _, room := range personalResult.BoostRooms {
-		personalBoostRooms = append(personalBoostRooms, BoostRoomsResponse{
-			Name:     fmt.Sprintf("%s (%s)", calc.RoomMap[rooms[room.Ind]].Name, calc.RoomMap[rooms[room.Ind]].BoostStrats[room.StratInd].Name),
-			Pacelock: room.Pacelock,
-			Index:    room.Ind,
-		})
+	key := "no api key"
+	if e.KeyID != "" {
+		key = fmt.Sprintf("api key `%s`", e.KeyID)
+		if e.Owner != "" {
+			key += fmt.Sprintf(" (%s)", e.Owner)
+		}
+	}
+	ign := e.Ign
+	if ign == "" {
+		ign = "unknown ign"
 	}
 
-	return PkdutilResult{
-		Best: struct {
-			Result     calc.CalcSeedResult
-			BoostRooms []BoostRoomsResponse
-		}{bestResult, boostRooms},
-		Personal: struct {
-			Result     calc.CalcSeedResult
-			BoostRooms []BoostRoomsResponse
-		}{personalResult, personalBoostRooms},
-	}, nil
+	content := fmt.Sprintf("Rejected a seed submission for **%s** from %s, %s: %s",
+		ign, e.RemoteAddr, key, e.Reason)
+	if _, err := bot.s.ChannelMessageSend(channelID, content); err != nil {
+		log.Errorf("error sending rejection to Discord: %v", err)
+		return
+	}
+	metrics.Announcements.WithLabelValues("rejection").Inc()
 }
 
-func GetChannelIDByName(channelName string) string {
-	if s == nil {
+func (bot *Bot) GetChannelIDByName(channelName string) string {
+	if bot.s == nil {
 		log.Error("Discord session is not initialized")
 		return ""
 	}
 
-	if GuildID == "" {
-		guilds, err := s.UserGuilds(100, "", "", false)
-		if err != nil {
-			log.Errorf("Error getting user guilds: %v", err)
-			return ""
+	for _, guildID := range bot.announcementGuilds() {
+		if channelID := bot.channelIDByName(guildID, channelName); channelID != "" {
+			return channelID
 		}
+	}
 
-		for _, guild := range guilds {
-			channels, err := s.GuildChannels(guild.ID)
-			if err != nil {
-				log.Errorf("Error getting channels for guild %s: %v", guild.ID, err)
-				continue
-			}
+	log.Errorf("Channel '%s' not found", channelName)
+	return ""
+}
 
-			for _, channel := range channels {
-				if channel.Type == discordgo.ChannelTypeGuildText && channel.Name == channelName {
-					return channel.ID
-				}
-			}
-		}
-	} else {
-		channels, err := s.GuildChannels(GuildID)
-		if err != nil {
-			log.Errorf("Error getting channels for guild %s: %v", GuildID, err)
-			return ""
-		}
+// channelIDByName looks for a text channel in one guild, it's empty if there's none
+func (bot *Bot) channelIDByName(guildID, channelName string) string {
+	channels, err := bot.s.GuildChannels(guildID)
+	if err != nil {
+		log.Errorf("Error getting channels for guild %s: %v", guildID, err)
+		return ""
+	}
 
-		for _, channel := range channels {
-			if channel.Type == discordgo.ChannelTypeGuildText && channel.Name == channelName {
-				return channel.ID
-			}
+	for _, channel := range channels {
+		if channel.Type == discordgo.ChannelTypeGuildText && channel.Name == channelName {
+			return channel.ID
 		}
 	}
-
-	log.Errorf("Channel '%s' not found", channelName)
 	return ""
 }
 
-func checkBotPermissions(channelID string) error {
+// checkBotPermissions checks that the bot can post in a channel, and upload images if attachFiles is set
+func (bot *Bot) checkBotPermissions(channelID string, attachFiles bool) error {
 	log.Info("checking bot permissions")
 
-	if s == nil {
+	if bot.s == nil {
 		err := fmt.Errorf("discord session is not initialized")
 		log.Error(err)
 		return err
 	}
 
-	_, err := s.Channel(channelID)
-	if err != nil {
-		err := fmt.Errorf("error getting channel info: %w", err)
-		log.Error(err)
-		return err
-	}
-
-	permissions, err := s.State.UserChannelPermissions(s.State.User.ID, channelID)
+	permissions, err := bot.s.UserChannelPermissions(bot.userID, channelID)
 	if err != nil {
 		err := fmt.Errorf("error getting permissions: %w", err)
 		log.Error(err)
 		return err
 	}
 
-	requiredPerms := discordgo.PermissionViewChannel |
-		discordgo.PermissionSendMessages |
-		discordgo.PermissionAttachFiles
+	var requiredPerms int64 = discordgo.PermissionViewChannel | discordgo.PermissionSendMessages
+	if attachFiles {
+		requiredPerms |= discordgo.PermissionAttachFiles
+	}
 
-	if permissions&int64(requiredPerms) != int64(requiredPerms) {
+	if permissions&requiredPerms != requiredPerms {
 		return fmt.Errorf("bot lacks necessary permissions for channel %s. Has: %d, Needs: %d",
 			channelID, permissions, requiredPerms)
 	}
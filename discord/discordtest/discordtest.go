@@ -0,0 +1,460 @@
+package discordtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Response is an interaction response the handlers sent
+type Response struct {
+	InteractionID string
+	*discordgo.InteractionResponse
+}
+
+// Session is an in-memory discord.Session. It keeps the messages sent to it, applies edits to them and
+// serves their attachments over http, so the cleanup can download them again
+type Session struct {
+	// Permissions are what the bot has in every channel
+	Permissions int64
+	// SendErr makes sending messages to channels fail while it's set
+	SendErr error
+
+	mu        sync.Mutex
+	nextID    int
+	channels  []*discordgo.Channel
+	messages  map[string]*discordgo.Message
+	files     map[string][]byte
+	responses []Response
+	edits     []*discordgo.MessageEdit
+	// originals are the messages created by interaction responses, by the interaction
+	originals map[string]string
+	handlers  []interface{}
+	// roles are the roles of members, by guild and user
+	roles map[[2]string][]string
+	// closedDMs are the users that don't take DMs
+	closedDMs map[string]bool
+	server    *httptest.Server
+}
+
+// NewSession returns an empty session whose bot has every permission, its file server is closed when the test ends
+func NewSession(t testing.TB) *Session {
+	fake := &Session{
+		Permissions: discordgo.PermissionAll,
+		messages:    map[string]*discordgo.Message{},
+		files:       map[string][]byte{},
+		originals:   map[string]string{},
+		roles:       map[[2]string][]string{},
+		closedDMs:   map[string]bool{},
+	}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.serveFile))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+// AddChannel adds a text channel to a guild
+func (fake *Session) AddChannel(guildID, channelID, name string) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.channels = append(fake.channels, &discordgo.Channel{
+		ID:      channelID,
+		GuildID: guildID,
+		Name:    name,
+		Type:    discordgo.ChannelTypeGuildText,
+	})
+}
+
+// Responses returns the interaction responses in the order they were sent
+func (fake *Session) Responses() []Response {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return slices.Clone(fake.responses)
+}
+
+// Edits returns the complex message edits in the order they were made
+func (fake *Session) Edits() []*discordgo.MessageEdit {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return slices.Clone(fake.edits)
+}
+
+// Messages returns the messages in a channel, the oldest first
+func (fake *Session) Messages(channelID string) []*discordgo.Message {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	var messages []*discordgo.Message
+	for _, m := range fake.messages {
+		if m.ChannelID == channelID {
+			messages = append(messages, copyMessage(m))
+		}
+	}
+	slices.SortFunc(messages, func(a, b *discordgo.Message) int {
+		return compareIDs(a.ID, b.ID)
+	})
+	return messages
+}
+
+// Message returns a message as it is now, nil if it doesn't exist
+func (fake *Session) Message(messageID string) *discordgo.Message {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if m, ok := fake.messages[messageID]; ok {
+		return copyMessage(m)
+	}
+	return nil
+}
+
+// DeleteMessage deletes a message like a user would
+func (fake *Session) DeleteMessage(messageID string) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	delete(fake.messages, messageID)
+}
+
+// CloseDMs makes sending DMs to a user fail, like when they don't take DMs from server members
+func (fake *Session) CloseDMs(userID string) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.closedDMs[userID] = true
+}
+
+// DMChannelID is the channel the DMs of a user are in
+func DMChannelID(userID string) string {
+	return "dm " + userID
+}
+
+// MemberRoles returns the roles given to a member through the session
+func (fake *Session) MemberRoles(guildID, userID string) []string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return slices.Clone(fake.roles[[2]string{guildID, userID}])
+}
+
+// Handlers are the handlers added with AddHandlerOnce that weren't removed
+func (fake *Session) Handlers() []interface{} {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return slices.Clone(fake.handlers)
+}
+
+func (fake *Session) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.responses = append(fake.responses, Response{InteractionID: interaction.ID, InteractionResponse: resp})
+
+	if resp.Type != discordgo.InteractionResponseChannelMessageWithSource || resp.Data == nil ||
+		resp.Data.Flags&discordgo.MessageFlagsEphemeral != 0 {
+		return nil
+	}
+	if _, ok := fake.originals[interaction.ID]; ok {
+		return restError(http.StatusBadRequest, "interaction has already been acknowledged")
+	}
+
+	m := fake.newMessage(interaction.ChannelID, resp.Data.Content, resp.Data.Components, resp.Data.Files)
+	fake.originals[interaction.ID] = m.ID
+	return nil
+}
+
+func (fake *Session) InteractionResponse(interaction *discordgo.Interaction, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	m, ok := fake.messages[fake.originals[interaction.ID]]
+	if !ok {
+		return nil, restError(http.StatusNotFound, "unknown message")
+	}
+	return copyMessage(m), nil
+}
+
+func (fake *Session) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	// a component can also defer a new message, its edits make that message
+	newMessage := slices.ContainsFunc(fake.responses, func(r Response) bool {
+		return r.InteractionID == interaction.ID && r.Type == discordgo.InteractionResponseDeferredChannelMessageWithSource
+	})
+	if interaction.Message != nil && !newMessage {
+		// a deferred update of a component's message
+		m, ok := fake.messages[interaction.Message.ID]
+		if !ok {
+			return nil, restError(http.StatusNotFound, "unknown message")
+		}
+		return copyMessage(m), nil
+	}
+
+	if _, ok := fake.originals[interaction.ID]; !ok {
+		// a deferred response becomes a message with its first edit
+		fake.originals[interaction.ID] = fake.newMessage(interaction.ChannelID, "", nil, nil).ID
+	}
+	m := fake.messages[fake.originals[interaction.ID]]
+	if newresp.Content != nil {
+		m.Content = *newresp.Content
+	}
+	if newresp.Components != nil {
+		m.Components = *newresp.Components
+	}
+	if newresp.Embeds != nil {
+		m.Embeds = *newresp.Embeds
+	}
+	if newresp.Files != nil {
+		m.Attachments = fake.attach(m.ID, newresp.Files)
+	}
+	return copyMessage(m), nil
+}
+
+func (fake *Session) ChannelMessage(channelID, messageID string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	m, ok := fake.messages[messageID]
+	if !ok || m.ChannelID != channelID {
+		return nil, restError(http.StatusNotFound, "unknown message")
+	}
+	return copyMessage(m), nil
+}
+
+func (fake *Session) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return fake.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Content: content}, options...)
+}
+
+func (fake *Session) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if userID, ok := strings.CutPrefix(channelID, DMChannelID("")); ok && fake.closedDMs[userID] {
+		return nil, restError(http.StatusForbidden, "Cannot send messages to this user")
+	}
+	if fake.SendErr != nil {
+		return nil, fake.SendErr
+	}
+
+	return copyMessage(fake.newMessage(channelID, data.Content, data.Components, data.Files)), nil
+}
+
+func (fake *Session) ChannelMessageEdit(channelID, messageID, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	return fake.ChannelMessageEditComplex(&discordgo.MessageEdit{ID: messageID, Channel: channelID, Content: &content}, options...)
+}
+
+func (fake *Session) ChannelMessageEditComplex(edit *discordgo.MessageEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.edits = append(fake.edits, edit)
+
+	m, ok := fake.messages[edit.ID]
+	if !ok || m.ChannelID != edit.Channel {
+		return nil, restError(http.StatusNotFound, "unknown message")
+	}
+	if edit.Content != nil {
+		m.Content = *edit.Content
+	}
+	if edit.Components != nil {
+		m.Components = *edit.Components
+	}
+	if edit.Embeds != nil {
+		m.Embeds = *edit.Embeds
+	}
+	// like discord, the attachments that aren't listed are removed and the files are added
+	if edit.Attachments != nil {
+		m.Attachments = slices.Clone(*edit.Attachments)
+	}
+	m.Attachments = append(m.Attachments, fake.attach(m.ID, edit.Files)...)
+	edited := time.Now()
+	m.EditedTimestamp = &edited
+	return copyMessage(m), nil
+}
+
+func (fake *Session) Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	for _, channel := range fake.channels {
+		if channel.ID == channelID {
+			c := *channel
+			return &c, nil
+		}
+	}
+	return nil, restError(http.StatusNotFound, "unknown channel")
+}
+
+// Guilds are the guilds the fake has channels in, the ones the gateway would send a GuildCreate for
+func (fake *Session) Guilds() []string {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	var guildIDs []string
+	for _, channel := range fake.channels {
+		if !slices.Contains(guildIDs, channel.GuildID) {
+			guildIDs = append(guildIDs, channel.GuildID)
+		}
+	}
+	return guildIDs
+}
+
+func (fake *Session) GuildChannels(guildID string, options ...discordgo.RequestOption) ([]*discordgo.Channel, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	var channels []*discordgo.Channel
+	for _, channel := range fake.channels {
+		if channel.GuildID == guildID {
+			c := *channel
+			channels = append(channels, &c)
+		}
+	}
+	return channels, nil
+}
+
+func (fake *Session) UserChannelPermissions(userID, channelID string, fetchOptions ...discordgo.RequestOption) (int64, error) {
+	if _, err := fake.Channel(channelID); err != nil {
+		return 0, err
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return fake.Permissions, nil
+}
+
+func (fake *Session) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: DMChannelID(recipientID), Type: discordgo.ChannelTypeDM}, nil
+}
+
+func (fake *Session) GuildMemberRoleAdd(guildID, userID, roleID string, options ...discordgo.RequestOption) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	key := [2]string{guildID, userID}
+	if !slices.Contains(fake.roles[key], roleID) {
+		fake.roles[key] = append(fake.roles[key], roleID)
+	}
+	return nil
+}
+
+func (fake *Session) GuildMemberRoleRemove(guildID, userID, roleID string, options ...discordgo.RequestOption) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	key := [2]string{guildID, userID}
+	fake.roles[key] = slices.DeleteFunc(fake.roles[key], func(id string) bool { return id == roleID })
+	return nil
+}
+
+func (fake *Session) AddHandlerOnce(handler interface{}) func() {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.handlers = append(fake.handlers, handler)
+	index := len(fake.handlers) - 1
+	return func() {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		fake.handlers[index] = nil
+	}
+}
+
+// newMessage has to be called with mu held
+func (fake *Session) newMessage(channelID, content string, components []discordgo.MessageComponent, files []*discordgo.File) *discordgo.Message {
+	fake.nextID++
+	m := &discordgo.Message{
+		ID:         strconv.Itoa(fake.nextID),
+		ChannelID:  channelID,
+		Content:    content,
+		Components: components,
+		Timestamp:  time.Now(),
+	}
+	m.Attachments = fake.attach(m.ID, files)
+	fake.messages[m.ID] = m
+	return m
+}
+
+// attach reads the files and serves them, it has to be called with mu held
+func (fake *Session) attach(messageID string, files []*discordgo.File) []*discordgo.MessageAttachment {
+	var attachments []*discordgo.MessageAttachment
+	for _, file := range files {
+		data, err := io.ReadAll(file.Reader)
+		if err != nil {
+			panic(fmt.Sprintf("failed to read file %s: %v", file.Name, err))
+		}
+
+		fake.nextID++
+		id := strconv.Itoa(fake.nextID)
+		path := "/attachments/" + messageID + "/" + id + "/" + file.Name
+		fake.files[path] = data
+		attachments = append(attachments, &discordgo.MessageAttachment{
+			ID:       id,
+			Filename: file.Name,
+			URL:      fake.server.URL + path,
+			Size:     len(data),
+		})
+	}
+	return attachments
+}
+
+func (fake *Session) serveFile(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	data, ok := fake.files[r.URL.Path]
+	fake.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:], time.Time{}, bytes.NewReader(data))
+}
+
+// copyMessage sends the message through json like discord does, so the handlers can't change the messages of
+// the session and get the components as pointers, like they're decoded from the api
+func copyMessage(m *discordgo.Message) *discordgo.Message {
+	// discordgo doesn't encode the components of messages, only of what's sent
+	data, err := json.Marshal(struct {
+		*discordgo.Message
+		Components []discordgo.MessageComponent `json:"components"`
+	}{m, m.Components})
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode message %s: %v", m.ID, err))
+	}
+
+	var c discordgo.Message
+	if err := json.Unmarshal(data, &c); err != nil {
+		panic(fmt.Sprintf("failed to decode message %s: %v", m.ID, err))
+	}
+	return &c
+}
+
+func compareIDs(a, b string) int {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	return x - y
+}
+
+func restError(status int, message string) error {
+	return &discordgo.RESTError{
+		Response:     &http.Response{StatusCode: status, Status: fmt.Sprintf("%d %s", status, http.StatusText(status))},
+		ResponseBody: []byte(fmt.Sprintf(`{"message": %q}`, message)),
+		Message:      &discordgo.APIErrorMessage{Message: message},
+	}
+}
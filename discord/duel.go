@@ -0,0 +1,177 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"pkd-bot/calc"
+	"pkd-bot/render"
+	"pkd-bot/storage"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+var duelCommand = &discordgo.ApplicationCommand{
+	Name:        "duel",
+	Description: "Race two players' splits against each other on the same seed",
+	Options: append(generateOptions(),
+		&discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionAttachment,
+			Name:        "player_1_splits",
+			Description: "pkdutils splits JSON of the first player, the ones they uploaded if it's their ign",
+		},
+		&discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionAttachment,
+			Name:        "player_2_splits",
+			Description: "pkdutils splits JSON of the second player, the ones they uploaded if it's their ign",
+		},
+		&discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "player_1_name",
+			Description: "Name to show for the first player, or their ign to use the splits they uploaded",
+		},
+		&discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "player_2_name",
+			Description: "Name to show for the second player, or their ign to use the splits they uploaded",
+		},
+	),
+}
+
+func (bot *Bot) duelHandler(s Session, i *discordgo.InteractionCreate) {
+	logUserInteraction(i, "command", "duel")
+
+	data := i.ApplicationCommandData()
+	selected := make([]string, 0, 8)
+	names := [2]string{"Player 1", "Player 2"}
+	var attachmentIDs [2]string
+
+	for _, option := range data.Options {
+		switch {
+		case strings.HasPrefix(option.Name, "room_"):
+			selected = append(selected, option.StringValue())
+		case option.Name == "player_1_splits":
+			attachmentIDs[0], _ = option.Value.(string)
+		case option.Name == "player_2_splits":
+			attachmentIDs[1], _ = option.Value.(string)
+		case option.Name == "player_1_name":
+			names[0] = option.StringValue()
+		case option.Name == "player_2_name":
+			names[1] = option.StringValue()
+		}
+	}
+
+	valid, err := validateInput(selected)
+	if !valid {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: err.Error(),
+			},
+		})
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{},
+	})
+	if err != nil {
+		log.Errorf("Failed to defer response: %v", err)
+		return
+	}
+
+	respondWithError := func(content string) {
+		_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+		})
+		if err != nil {
+			log.Errorf("Failed to edit response with error message: %v", err)
+		}
+	}
+
+	var splits [2]map[string]calc.Room
+	for p, attachmentID := range attachmentIDs {
+		if data.Resolved == nil || data.Resolved.Attachments[attachmentID] == nil {
+			// without an attachment the name is taken as the ign of a player that uploaded their splits
+			splits[p], err = bot.storedSplits(names[p])
+			if errors.Is(err, storage.ErrNotFound) {
+				respondWithError(fmt.Sprintf("Please attach the pkdutils splits of %s, they never uploaded theirs.", names[p]))
+				return
+			}
+			if err != nil {
+				log.Error(err)
+				respondWithError(fmt.Sprintf("I couldn't get the splits of %s, please attach them.", names[p]))
+				return
+			}
+			continue
+		}
+
+		splits[p], err = downloadPkdutilsSplits(data.Resolved.Attachments[attachmentID].URL)
+		if err != nil {
+			respondWithError(fmt.Sprintf("I couldn't read the splits of %s: %v", names[p], err))
+			return
+		}
+	}
+
+	duel, err := calc.Duel(selected, splits[0], splits[1])
+	if err != nil {
+		log.Error(err)
+		respondWithError("Go tell the developer he's an idiot 'cause something's broken idk")
+		return
+	}
+
+	img, err := render.DuelResults(duel, names, splits)
+	if err != nil {
+		log.Error(err)
+		respondWithError("Go tell the developer he's an idiot 'cause something's broken idk")
+		return
+	}
+
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Files: []*discordgo.File{
+			{
+				Name:   "duel.png",
+				Reader: bytes.NewReader(img.Bytes()),
+			},
+		},
+	})
+	if err != nil {
+		log.Errorf("Failed to edit response with duel results: %v", err)
+	}
+}
+
+func downloadPkdutilsSplits(url string) (map[string]calc.Room, error) {
+	content, err := downloadAttachment(url)
+	if err != nil {
+		log.Warn(err)
+		return nil, fmt.Errorf("failed to download the attachment")
+	}
+
+	var pkdutilsSplits map[string]calc.PkdutilsSplit
+	if err := json.Unmarshal(content, &pkdutilsSplits); err != nil {
+		log.Warnf("Failed to decode pkdutils splits: %v", err)
+		return nil, fmt.Errorf("this doesn't look like a pkdutils splits file")
+	}
+
+	// rooms the file doesn't have fall back to RoomMap, the ones it has have to be usable
+	splits := calc.FromPkdutils(pkdutilsSplits)
+	if err := calc.CheckSplits(calc.MergeSplits(splits)); err != nil {
+		return nil, err
+	}
+	return splits, nil
+}
+
+// storedSplits are the last splits ign uploaded through pkdutils, they were checked when they were uploaded
+func (bot *Bot) storedSplits(ign string) (map[string]calc.Room, error) {
+	pkdutilsSplits, _, err := bot.store.GetSplits(context.Background(), ign)
+	if err != nil {
+		return nil, err
+	}
+	return calc.FromPkdutils(pkdutilsSplits), nil
+}
@@ -0,0 +1,103 @@
+package discord
+
+import (
+	"testing"
+	"time"
+
+	"pkd-bot/events"
+	"pkd-bot/lobbies"
+	"pkd-bot/ratelimit"
+	"pkd-bot/state"
+	"pkd-bot/storage"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	SeedFileName           = seedFileName
+	InQuietHours           = inQuietHours
+	LockMessage            = lockMessage
+	ForgetMessageLock      = forgetMessageLock
+	DownloadAttachment     = downloadAttachment
+	DownloadPkdutilsSplits = downloadPkdutilsSplits
+	MaxAttachmentSize      = maxAttachmentSize
+)
+
+// the channel names of the bot UseFakes makes
+const (
+	AnnouncementChannel = "bot-commands"
+	ModLogChannel       = "mod-log"
+)
+
+// testBot is the bot UseFakes made for the test
+var testBot *Bot
+
+func CalcSeedHandler(s Session, i *discordgo.InteractionCreate)    { testBot.calcSeedHandler(s, i) }
+func ConfigHandler(s Session, i *discordgo.InteractionCreate)      { testBot.configHandler(s, i) }
+func SubscribeHandler(s Session, i *discordgo.InteractionCreate)   { testBot.subscribeHandler(s, i) }
+func LobbiesHandler(s Session, i *discordgo.InteractionCreate)     { testBot.lobbiesHandler(s, i) }
+func SeedsHandler(s Session, i *discordgo.InteractionCreate)       { testBot.seedsHandler(s, i) }
+func DuelHandler(s Session, i *discordgo.InteractionCreate)        { testBot.duelHandler(s, i) }
+func SeedsButtonHandler(s Session, i *discordgo.InteractionCreate) { testBot.seedsButtonHandler(s, i) }
+func LeaderboardHandler(s Session, i *discordgo.InteractionCreate) { testBot.leaderboardHandler(s, i) }
+func ButtonHandler(s Session, i *discordgo.InteractionCreate)      { testBot.buttonHandler(s, i) }
+
+func AnnounceSeed(e events.SeedSubmitted)                         { testBot.announceSeed(e) }
+func NotifySubscribers(e events.SeedSubmitted)                    { testBot.notifySubscribers(e) }
+func ReportRejection(e events.SubmissionRejected)                 { testBot.reportRejection(e) }
+func ExpireMessage(m state.Message)                               { testBot.expireMessage(m) }
+func UpdateLiveAnnouncements(now time.Time)                       { testBot.updateLiveAnnouncements(now) }
+func GuildCreated(s *discordgo.Session, g *discordgo.GuildCreate) { testBot.guildCreated(s, g) }
+func GuildDeleted(s *discordgo.Session, g *discordgo.GuildDelete) { testBot.guildDeleted(s, g) }
+
+// Storage is the store of the test's bot
+func Storage() storage.Store {
+	return testBot.store
+}
+
+// States keeps the message states of the test's bot
+func States() state.Store {
+	return testBot.states
+}
+
+// UseFakes makes a bot whose handlers go through session and keep their state in a new memory store until the test ends
+func UseFakes(t *testing.T, session Session) {
+	oldBot, oldSeedCache := testBot, seedCache
+	oldNotifiedSeeds, oldDMLimit, oldTierPingLimit := notifiedSeeds, dmLimit, tierPingLimit
+	oldLobbyRegistry, oldRejectionCache := lobbyRegistry, rejectionCache
+	t.Cleanup(func() {
+		testBot, seedCache = oldBot, oldSeedCache
+		notifiedSeeds, dmLimit, tierPingLimit = oldNotifiedSeeds, oldDMLimit, oldTierPingLimit
+		lobbyRegistry, rejectionCache = oldLobbyRegistry, oldRejectionCache
+		forgetLiveAnnouncements()
+	})
+
+	testBot = newBot(Config{
+		AnnouncementChannel: AnnouncementChannel,
+		ModLogChannel:       ModLogChannel,
+	}, storage.NewMemoryStore(), session)
+	testBot.userID = "bot"
+	seedCache = NewSeedCache(time.Hour)
+	notifiedSeeds, dmLimit, tierPingLimit = NewSeedCache(time.Hour), ratelimit.New(0.1, 3), ratelimit.New(0.5, 2)
+	lobbyRegistry, rejectionCache = lobbies.NewRegistry(), NewSeedCache(time.Hour)
+	forgetLiveAnnouncements()
+
+	// the fake has no gateway, its guilds are joined like the GuildCreates would
+	if fake, ok := session.(interface{ Guilds() []string }); ok {
+		for _, guildID := range fake.Guilds() {
+			testBot.joinGuild(guildID)
+		}
+	}
+}
+
+// forgetLiveAnnouncements forgets the announcements of the last test, they're in its fake
+func forgetLiveAnnouncements() {
+	liveMu.Lock()
+	clear(liveAnnouncements)
+	liveMu.Unlock()
+}
+
+// Lobbies are the lobbies /lobbies lists, until the test ends
+func Lobbies() *lobbies.Registry {
+	return lobbyRegistry
+}
@@ -0,0 +1,271 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"pkd-bot/calc"
+	"pkd-bot/storage"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+var noDMs = false
+
+var configCommand = &discordgo.ApplicationCommand{
+	Name:                     "config",
+	Description:              "Change how seeds are announced in this server",
+	DefaultMemberPermissions: &adminPermission,
+	DMPermission:             &noDMs,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "show",
+			Description: "Show the announcement settings",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "channel",
+			Description: "Announce seeds in a channel",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					Name:         "channel",
+					Description:  "The channel to announce seeds in",
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+					Required:     true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "threshold",
+			Description: "Only announce seeds faster than this",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionNumber,
+					Name:        "seconds",
+					Description: fmt.Sprintf("Boost time in seconds, e.g. %.0f for %s", calc.DefaultAnnouncementThreshold, calc.FormatTime(calc.DefaultAnnouncementThreshold)),
+					MinValue:    func() *float64 { v := 1.0; return &v }(),
+					MaxValue:    600,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "role",
+			Description: "Ping a role with every announcement",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionRole,
+					Name:        "role",
+					Description: "The role to ping, leave it out to stop pinging",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "image",
+			Description: "Choose whether announcements have the results image",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "include",
+					Description: "Whether to include the image",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "tier",
+			Description: "Choose the role members get with /subscribe role for a tier of seeds",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "tier",
+					Description: "The seeds the role is pinged for",
+					Choices:     tierChoices(),
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionRole,
+					Name:        "role",
+					Description: "The role, leave it out to stop having one for the tier",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "reset",
+			Description: "Go back to the defaults",
+		},
+	},
+}
+
+func (bot *Bot) configHandler(s Session, i *discordgo.InteractionCreate) {
+	logUserInteraction(i, "command", "config")
+
+	respond := func(content string) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content:         content,
+				Flags:           discordgo.MessageFlagsEphemeral,
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			},
+		})
+		if err != nil {
+			log.Errorf("Failed to respond to /config: %v", err)
+		}
+	}
+
+	if i.GuildID == "" || i.Member == nil {
+		respond("Announcements are set up per server, run this in one.")
+		return
+	}
+	// server admins can let anyone use the command, the settings are still only for administrators
+	if i.Member.Permissions&discordgo.PermissionAdministrator == 0 {
+		respond("Only administrators can change the announcement settings.")
+		return
+	}
+
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		respond("You sent an incomplete command.")
+		return
+	}
+
+	ctx := context.Background()
+	settings := bot.guildSettings(i.GuildID)
+	var warning string
+
+	switch sub := options[0]; sub.Name {
+	case "show":
+		respond(bot.describeGuildSettings(settings) + bot.describeTierRoles(i.GuildID))
+		return
+	case "tier":
+		t, ok := tierByName(sub.Options[0].StringValue())
+		if !ok {
+			respond("There is no such tier")
+			return
+		}
+
+		var err error
+		if len(sub.Options) > 1 {
+			err = bot.store.PutTierRole(ctx, storage.TierRole{GuildID: i.GuildID, MaxTime: t.maxTime, RoleID: sub.Options[1].RoleValue(nil, i.GuildID).ID})
+		} else {
+			err = bot.store.DeleteTierRole(ctx, i.GuildID, t.maxTime)
+		}
+		if err != nil {
+			log.Error(err)
+			respond("I couldn't save the tier role, try again later.")
+			return
+		}
+		respond("Saved." + bot.describeTierRoles(i.GuildID))
+		return
+	case "channel":
+		settings.AnnouncementChannelID = sub.Options[0].ChannelValue(nil).ID
+		if err := bot.checkBotPermissions(settings.AnnouncementChannelID, !settings.HideImage); err != nil {
+			warning = "\n\n⚠️ I can't announce there yet, give me the permissions to view the channel, send messages and attach files."
+		}
+	case "threshold":
+		settings.Threshold = sub.Options[0].FloatValue()
+	case "role":
+		settings.PingRoleID = ""
+		if len(sub.Options) > 0 {
+			settings.PingRoleID = sub.Options[0].RoleValue(nil, i.GuildID).ID
+		}
+	case "image":
+		settings.HideImage = !sub.Options[0].BoolValue()
+	case "reset":
+		if err := bot.store.DeleteGuildSettings(ctx, i.GuildID); err != nil {
+			log.Error(err)
+			respond("I couldn't reset the settings, try again later.")
+			return
+		}
+		bot.cachedSettings.Delete(i.GuildID)
+		respond("Back to the defaults.\n" + bot.describeGuildSettings(storage.GuildSettings{GuildID: i.GuildID}))
+		return
+	default:
+		respond("There is no such command")
+		return
+	}
+
+	if err := bot.store.PutGuildSettings(ctx, &settings); err != nil {
+		log.Error(err)
+		respond("I couldn't save the settings, try again later.")
+		return
+	}
+	bot.cachedSettings.Store(i.GuildID, settings)
+	log.Infof("Announcement settings of guild %s changed to %+v", i.GuildID, settings)
+	respond("Saved.\n" + bot.describeGuildSettings(settings) + warning)
+}
+
+func (bot *Bot) describeGuildSettings(settings storage.GuildSettings) string {
+	var b strings.Builder
+
+	threshold := bot.announcementThreshold(settings)
+	channel := "#" + bot.announcementChannelName
+	if settings.AnnouncementChannelID != "" {
+		channel = fmt.Sprintf("<#%s>", settings.AnnouncementChannelID)
+	}
+	fmt.Fprintf(&b, "Seeds under **%s** (%.2fs) are announced in %s", calc.FormatTime(threshold), threshold, channel)
+
+	if settings.PingRoleID != "" {
+		fmt.Fprintf(&b, ", pinging <@&%s>", settings.PingRoleID)
+	}
+	if settings.HideImage {
+		b.WriteString(", without the results image.")
+	} else {
+		b.WriteString(", with the results image.")
+	}
+
+	return b.String()
+}
+
+// describeTierRoles lists the tier roles of a guild on lines of their own
+func (bot *Bot) describeTierRoles(guildID string) string {
+	roles, err := bot.store.TierRoles(context.Background(), guildID)
+	if err != nil {
+		log.Warn(err)
+		return ""
+	}
+
+	var b strings.Builder
+	for _, t := range tiers {
+		for _, role := range roles {
+			if role.MaxTime == t.maxTime {
+				fmt.Fprintf(&b, "\n<@&%s> is pinged for %s seeds, members get it with /subscribe role.", role.RoleID, t.name)
+			}
+		}
+	}
+	return b.String()
+}
+
+func (bot *Bot) announcementThreshold(settings storage.GuildSettings) float64 {
+	if settings.Threshold > 0 {
+		return settings.Threshold
+	}
+	return bot.threshold
+}
+
+// announcementChannelID is the channel a guild announces seeds in, empty if it has none
+func (bot *Bot) announcementChannelID(settings storage.GuildSettings) string {
+	if settings.AnnouncementChannelID != "" {
+		return settings.AnnouncementChannelID
+	}
+
+	if channelID, ok := bot.announcementChannelIDs.Load(settings.GuildID); ok {
+		return channelID.(string)
+	}
+
+	channelID := bot.channelIDByName(settings.GuildID, bot.announcementChannelName)
+	if channelID != "" {
+		bot.announcementChannelIDs.Store(settings.GuildID, channelID)
+	}
+	return channelID
+}
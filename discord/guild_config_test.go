@@ -0,0 +1,207 @@
+package discord_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"pkd-bot/calc"
+	"pkd-bot/discord"
+	"pkd-bot/discord/discordtest"
+	"pkd-bot/storage"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var admin = &discordgo.Member{
+	User:        &discordgo.User{ID: "admin", Username: "admin"},
+	Permissions: discordgo.PermissionAdministrator,
+}
+
+// commandInteraction is m using the command name in the commands channel of the guild
+func commandInteraction(name, id string, m *discordgo.Member, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        id,
+		Type:      discordgo.InteractionApplicationCommand,
+		GuildID:   "guild",
+		ChannelID: "commands",
+		Member:    m,
+		Data:      discordgo.ApplicationCommandInteractionData{Name: name, Options: options},
+	}}
+}
+
+func subcommand(name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: discordgo.ApplicationCommandOptionSubCommand, Options: options}
+}
+
+func option(name string, optionType discordgo.ApplicationCommandOptionType, value interface{}) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: optionType, Value: value}
+}
+
+// lastResponse is the content of the last interaction response, which has to be ephemeral
+func lastResponse(t *testing.T, fake *discordtest.Session) string {
+	t.Helper()
+
+	responses := fake.Responses()
+	if len(responses) == 0 {
+		t.Fatal("got no response")
+	}
+	last := responses[len(responses)-1]
+	if last.Data.Flags&discordgo.MessageFlagsEphemeral == 0 {
+		t.Errorf("the response %q isn't ephemeral", last.Data.Content)
+	}
+	return last.Data.Content
+}
+
+func TestConfigHandler(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("guild", "seeds", "seeds")
+	discord.UseFakes(t, fake)
+	ctx := context.Background()
+
+	discord.ConfigHandler(fake, commandInteraction("config", "config show", admin, subcommand("show")))
+	if got := lastResponse(t, fake); !strings.Contains(got, "#"+discord.AnnouncementChannel) || !strings.Contains(got, "with the results image") {
+		t.Errorf("got %q, want the defaults", got)
+	}
+
+	discord.ConfigHandler(fake, commandInteraction("config", "config channel", admin, subcommand("channel", option("channel", discordgo.ApplicationCommandOptionChannel, "seeds"))))
+	discord.ConfigHandler(fake, commandInteraction("config", "config threshold", admin, subcommand("threshold", option("seconds", discordgo.ApplicationCommandOptionNumber, 125.0))))
+	discord.ConfigHandler(fake, commandInteraction("config", "config role", admin, subcommand("role", option("role", discordgo.ApplicationCommandOptionRole, "runners"))))
+	discord.ConfigHandler(fake, commandInteraction("config", "config image", admin, subcommand("image", option("include", discordgo.ApplicationCommandOptionBoolean, false))))
+
+	if got := lastResponse(t, fake); !strings.Contains(got, "<#seeds>") || !strings.Contains(got, "<@&runners>") ||
+		!strings.Contains(got, "without the results image") || strings.Contains(got, "⚠️") {
+		t.Errorf("got %q, want every setting", got)
+	}
+	settings, err := discord.Storage().GetGuildSettings(ctx, "guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := storage.GuildSettings{GuildID: "guild", AnnouncementChannelID: "seeds", Threshold: 125, PingRoleID: "runners", HideImage: true}
+	settings.UpdatedAt = want.UpdatedAt
+	if settings != want {
+		t.Errorf("got %+v, want %+v", settings, want)
+	}
+
+	// leaving the role out stops the pings
+	discord.ConfigHandler(fake, commandInteraction("config", "config role", admin, subcommand("role")))
+	if settings, _ := discord.Storage().GetGuildSettings(ctx, "guild"); settings.PingRoleID != "" {
+		t.Errorf("got role %q, want none", settings.PingRoleID)
+	}
+
+	discord.ConfigHandler(fake, commandInteraction("config", "config reset", admin, subcommand("reset")))
+	if _, err := discord.Storage().GetGuildSettings(ctx, "guild"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("got %v, want the settings gone after a reset", err)
+	}
+}
+
+func TestConfigHandlerWarnsAboutPermissions(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("guild", "seeds", "seeds")
+	fake.Permissions = discordgo.PermissionViewChannel
+	discord.UseFakes(t, fake)
+
+	discord.ConfigHandler(fake, commandInteraction("config", "config channel", admin, subcommand("channel", option("channel", discordgo.ApplicationCommandOptionChannel, "seeds"))))
+
+	if got := lastResponse(t, fake); !strings.Contains(got, "Saved") || !strings.Contains(got, "permissions") {
+		t.Errorf("got %q, want the channel saved with a warning", got)
+	}
+}
+
+func TestConfigHandlerNeedsAdministrator(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+
+	discord.ConfigHandler(fake, commandInteraction("config", "config threshold", member, subcommand("threshold", option("seconds", discordgo.ApplicationCommandOptionNumber, 200.0))))
+
+	if got := lastResponse(t, fake); !strings.Contains(got, "Only administrators") {
+		t.Errorf("got %q, want the change refused", got)
+	}
+	if _, err := discord.Storage().GetGuildSettings(context.Background(), "guild"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("got %v, want no settings", err)
+	}
+}
+
+func TestAnnounceSeedPerGuild(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("defaults", "defaults announcements", discord.AnnouncementChannel)
+	fake.AddChannel("strict", "strict announcements", discord.AnnouncementChannel)
+	fake.AddChannel("custom", "custom announcements", discord.AnnouncementChannel)
+	fake.AddChannel("custom", "custom seeds", "seeds")
+	discord.UseFakes(t, fake)
+	ctx := context.Background()
+
+	e := seedSubmitted(t)
+	e.Result.BoostTime = 125
+	discord.Storage().PutGuildSettings(ctx, &storage.GuildSettings{GuildID: "strict", Threshold: 120})
+	discord.Storage().PutGuildSettings(ctx, &storage.GuildSettings{
+		GuildID:               "custom",
+		AnnouncementChannelID: "custom seeds",
+		Threshold:             126,
+		PingRoleID:            "runners",
+		HideImage:             true,
+	})
+
+	discord.AnnounceSeed(e)
+
+	if messages := fake.Messages("defaults announcements"); len(messages) != 1 || len(messages[0].Attachments) != 1 {
+		t.Errorf("got %+v, want the seed announced with its image in the guild without settings", messages)
+	}
+	if messages := fake.Messages("strict announcements"); len(messages) != 0 {
+		t.Errorf("got %d announcements, want none over the guild's threshold", len(messages))
+	}
+	if messages := fake.Messages("custom announcements"); len(messages) != 0 {
+		t.Errorf("got %d announcements in the channel with the default name, want them in the configured one", len(messages))
+	}
+
+	messages := fake.Messages("custom seeds")
+	if len(messages) != 1 {
+		t.Fatalf("got %d announcements, want one in the configured channel", len(messages))
+	}
+	if !strings.HasPrefix(messages[0].Content, "<@&runners>") || len(messages[0].Attachments) != 0 {
+		t.Errorf("got %q with %d attachments, want the role pinged without the image", messages[0].Content, len(messages[0].Attachments))
+	}
+
+	// the buttons of announcements without an image are cleaned up too
+	expire(t, messages[0].ID)
+	if got := buttons(fake.Message(messages[0].ID)); len(got) != 1 || got[0] != discord.ButtonShowCalc {
+		t.Errorf("got buttons %v, want only show calc", got)
+	}
+}
+
+func TestAnnounceSeedFollowsGateway(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("guild", "announcements", discord.AnnouncementChannel)
+	fake.AddChannel("left", "left announcements", discord.AnnouncementChannel)
+	discord.UseFakes(t, fake)
+
+	// an outage doesn't take the guild away, leaving it does
+	discord.GuildDeleted(nil, &discordgo.GuildDelete{Guild: &discordgo.Guild{ID: "guild", Unavailable: true}})
+	discord.GuildDeleted(nil, &discordgo.GuildDelete{Guild: &discordgo.Guild{ID: "left"}})
+	discord.GuildCreated(nil, &discordgo.GuildCreate{Guild: &discordgo.Guild{ID: "joined"}})
+	fake.AddChannel("joined", "joined announcements", discord.AnnouncementChannel)
+
+	// the threshold is changed through /config, the cached settings have to follow
+	discord.ConfigHandler(fake, commandInteraction("config", "config threshold", admin, subcommand("threshold", option("seconds", discordgo.ApplicationCommandOptionNumber, 200.0))))
+
+	e := seedSubmitted(t)
+	e.Result.BoostTime = 150
+	discord.AnnounceSeed(e)
+
+	if messages := fake.Messages("announcements"); len(messages) != 1 {
+		t.Errorf("got %d announcements, want the seed under the guild's new threshold announced", len(messages))
+	}
+	if messages := fake.Messages("joined announcements"); len(messages) != 0 {
+		t.Errorf("got %d announcements, want none over the default threshold", len(messages))
+	}
+	if messages := fake.Messages("left announcements"); len(messages) != 0 {
+		t.Errorf("got %d announcements, want none in the guild the bot left", len(messages))
+	}
+
+	e.Lobby, e.Result.BoostTime = "m2A", calc.DefaultAnnouncementThreshold-1
+	discord.AnnounceSeed(e)
+	if messages := fake.Messages("joined announcements"); len(messages) != 1 {
+		t.Errorf("got %d announcements, want the seed announced in the guild the bot joined", len(messages))
+	}
+}
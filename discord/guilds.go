@@ -0,0 +1,85 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"pkd-bot/storage"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+func (bot *Bot) guildCreated(_ *discordgo.Session, g *discordgo.GuildCreate) {
+	bot.joinGuild(g.ID)
+}
+
+func (bot *Bot) guildDeleted(_ *discordgo.Session, g *discordgo.GuildDelete) {
+	// the bot is still in guilds that are only unavailable, e.g. during an outage
+	if g.Unavailable {
+		return
+	}
+	bot.leaveGuild(g.ID)
+}
+
+func (bot *Bot) joinGuild(guildID string) {
+	bot.guildsMu.Lock()
+	defer bot.guildsMu.Unlock()
+
+	bot.guilds[guildID] = struct{}{}
+}
+
+func (bot *Bot) leaveGuild(guildID string) {
+	bot.guildsMu.Lock()
+	delete(bot.guilds, guildID)
+	bot.guildsMu.Unlock()
+
+	bot.cachedSettings.Delete(guildID)
+	bot.announcementChannelIDs.Delete(guildID)
+}
+
+// announcementGuilds are the guilds seeds are announced in, only the configured one if there is one
+func (bot *Bot) announcementGuilds() []string {
+	if bot.guildID != "" {
+		return []string{bot.guildID}
+	}
+
+	bot.guildsMu.RLock()
+	defer bot.guildsMu.RUnlock()
+
+	ids := make([]string, 0, len(bot.guilds))
+	for guildID := range bot.guilds {
+		ids = append(ids, guildID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// guildSettings are the settings of a guild, the defaults if it has none or they couldn't be loaded
+func (bot *Bot) guildSettings(guildID string) storage.GuildSettings {
+	if settings, ok := bot.cachedSettings.Load(guildID); ok {
+		return settings.(storage.GuildSettings)
+	}
+
+	settings, err := bot.store.GetGuildSettings(context.Background(), guildID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			// not cached, the store is asked again next time
+			log.Warn(err)
+			return storage.GuildSettings{GuildID: guildID}
+		}
+		settings = storage.GuildSettings{GuildID: guildID}
+	}
+	bot.cachedSettings.Store(guildID, settings)
+	return settings
+}
+
+// highestThreshold is the threshold of the guild announcing the slowest seeds, nothing slower is announced anywhere
+func (bot *Bot) highestThreshold(guildIDs []string) float64 {
+	var highest float64
+	for _, guildID := range guildIDs {
+		highest = max(highest, bot.announcementThreshold(bot.guildSettings(guildID)))
+	}
+	return highest
+}
@@ -0,0 +1,104 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"pkd-bot/leaderboard"
+	"pkd-bot/render"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// leaderboardSize is how many players the image of /leaderboard has
+const leaderboardSize = 10
+
+var leaderboardCommand = &discordgo.ApplicationCommand{
+	Name:        "leaderboard",
+	Description: "See who finds the most and the best seeds",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "by",
+			Description: "What to rank the players by (default announced)",
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "Seeds announced", Value: string(leaderboard.Announced)},
+				{Name: "Best seed", Value: string(leaderboard.Best)},
+				{Name: fmt.Sprintf("Fastest average boost time, of %d seeds or more", leaderboard.MinSeedsForAverage), Value: string(leaderboard.AverageTime)},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "window",
+			Description: "The time to rank the seeds of (default this week)",
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "This week", Value: string(leaderboard.Week)},
+				{Name: "This month", Value: string(leaderboard.Month)},
+				{Name: "This season", Value: string(leaderboard.Season)},
+			},
+		},
+	},
+}
+
+func (bot *Bot) leaderboardHandler(s Session, i *discordgo.InteractionCreate) {
+	logUserInteraction(i, "command", "leaderboard")
+
+	var window leaderboard.Window
+	var metric leaderboard.Metric
+	var err error
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "window":
+			window, err = leaderboard.ParseWindow(option.StringValue())
+		case "by":
+			metric, err = leaderboard.ParseMetric(option.StringValue())
+		}
+		if err != nil {
+			s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{Content: err.Error(), Flags: discordgo.MessageFlagsEphemeral},
+			})
+			return
+		}
+	}
+	if window == "" {
+		window = leaderboard.Week
+	}
+	if metric == "" {
+		metric = leaderboard.Announced
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{},
+	})
+	if err != nil {
+		log.Errorf("Failed to defer /leaderboard: %v", err)
+		return
+	}
+
+	edit := func(content string, files []*discordgo.File) {
+		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content, Files: files}); err != nil {
+			log.Errorf("Failed to send the leaderboard: %v", err)
+		}
+	}
+
+	board, err := leaderboard.Build(context.Background(), bot.store, window, metric, time.Now(), leaderboardSize)
+	if err != nil {
+		log.Error(err)
+		edit("I couldn't rank the seeds, try again later.", nil)
+		return
+	}
+
+	content := fmt.Sprintf("**%s**, ends <t:%d:R>. A seed counts for whoever sent it first from their lobby.", board.Title(), board.Until.Unix())
+	img, err := render.Leaderboard(board)
+	if err != nil {
+		log.Errorf("error drawing the leaderboard: %v", err)
+		edit(content, nil)
+		return
+	}
+	edit(content, []*discordgo.File{{Name: "leaderboard.png", Reader: bytes.NewReader(img.Bytes())}})
+}
@@ -0,0 +1,39 @@
+package discord_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/discord"
+	"pkd-bot/discord/discordtest"
+	"pkd-bot/storage"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestLeaderboardHandler(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+
+	sub := &storage.Submission{Ign: "Finder", Lobby: "m1A", Rooms: testRooms, BoostTime: calc.DefaultAnnouncementThreshold - 1, At: time.Now()}
+	if err := discord.Storage().AddSubmission(context.Background(), sub); err != nil {
+		t.Fatal(err)
+	}
+
+	discord.LeaderboardHandler(fake, commandInteraction("leaderboard", "leaderboard", member, option("by", discordgo.ApplicationCommandOptionString, "best")))
+	messages := fake.Messages("commands")
+	if len(messages) != 1 || !strings.Contains(messages[0].Content, "Best seeds, Week of") {
+		t.Fatalf("got %+v, want the weekly leaderboard of the best seeds", messages)
+	}
+	if len(messages[0].Attachments) != 1 || messages[0].Attachments[0].Filename != "leaderboard.png" {
+		t.Errorf("got %+v, want the leaderboard drawn", messages[0].Attachments)
+	}
+
+	discord.LeaderboardHandler(fake, commandInteraction("leaderboard", "decade", member, option("window", discordgo.ApplicationCommandOptionString, "decade")))
+	if got := lastResponse(t, fake); !strings.Contains(got, "isn't a window") {
+		t.Errorf("got %q, want the window rejected", got)
+	}
+}
@@ -0,0 +1,254 @@
+package discord
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/events"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// mergeDuration is how long finders are merged into an announcement whose lobby didn't say when it requeues
+var mergeDuration = 5 * time.Minute
+
+// liveAnnouncement is a seed announcement that counts down to its lobby requeuing. They're only kept in memory,
+// after a restart the announcements stay as they were and the janitor takes their buttons away
+type liveAnnouncement struct {
+	channelID string
+	messageID string
+	lobby     string
+	boostTime float64
+	finders   []string
+	// mentions are the pings in front of the announcement, they stay when it's edited
+	mentions string
+	advice   *calc.Advice
+	// deadline is when the lobby requeues, it's zero if the finder's client didn't say
+	deadline time.Time
+	timeLeft string
+	at       time.Time
+	// shown is the content the message has, so it isn't edited for nothing
+	shown string
+}
+
+var (
+	liveMu sync.Mutex
+	// liveAnnouncements are by liveKey
+	liveAnnouncements = make(map[string]*liveAnnouncement)
+	// announceMu makes submissions of the same seed that come in at once merge into one announcement
+	announceMu sync.Mutex
+)
+
+// liveKey is the same for everyone in a lobby submitting a seed
+func liveKey(guildID string, e events.SeedSubmitted) string {
+	return guildID + "|" + strings.ToLower(e.Lobby) + "|" + strings.Join(e.Rooms, "|")
+}
+
+func newLiveAnnouncement(e events.SeedSubmitted, mentions string) *liveAnnouncement {
+	a := &liveAnnouncement{
+		lobby:     e.Lobby,
+		boostTime: e.Result.BoostTime,
+		finders:   []string{e.Ign},
+		mentions:  mentions,
+		advice:    e.Advice,
+		timeLeft:  e.TimeLeft,
+		at:        e.At,
+	}
+	if a.at.IsZero() {
+		a.at = time.Now()
+	}
+
+	if left, err := calc.ParseTimeLeft(e.TimeLeft); err == nil && left > 0 {
+		a.deadline = a.at.Add(left)
+	}
+	return a
+}
+
+func (a *liveAnnouncement) expired(now time.Time) bool {
+	return !a.deadline.IsZero() && !now.Before(a.deadline)
+}
+
+func (a *liveAnnouncement) content(now time.Time) string {
+	var b strings.Builder
+	if a.mentions != "" {
+		b.WriteString(a.mentions + " ")
+	}
+
+	finders := a.finders[0]
+	if n := len(a.finders); n > 1 {
+		finders = strings.Join(a.finders[:n-1], ", ") + " and " + a.finders[n-1]
+	}
+
+	switch {
+	case a.expired(now):
+		fmt.Fprintf(&b, "~~%s found a %s seed~~, %s has requeued so it's **expired**",
+			finders, calc.FormatTime(a.boostTime), a.lobby)
+	case len(a.finders) > 1:
+		fmt.Fprintf(&b, "%s have found a %s seed, %s requeues in %s",
+			finders, calc.FormatTime(a.boostTime), a.lobby, a.countdown(now))
+	default:
+		fmt.Fprintf(&b, "%s has found a %s seed, %s requeues in %s",
+			finders, calc.FormatTime(a.boostTime), a.lobby, a.countdown(now))
+	}
+
+	if a.advice != nil && !a.expired(now) {
+		fmt.Fprintf(&b, "\n> **%s**: %s", a.advice.Recommendation, a.advice.Justification)
+	}
+	return b.String()
+}
+
+// countdown is the time left until the lobby requeues, or what the finder sent if it couldn't be read
+func (a *liveAnnouncement) countdown(now time.Time) string {
+	if a.deadline.IsZero() {
+		return a.timeLeft
+	}
+
+	left := a.deadline.Sub(now).Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(left.Minutes()), int(left.Seconds())%60)
+}
+
+// claimAnnouncement adds the finder of e to the live announcement of the same seed and lobby, if the guild has one.
+// Otherwise it's a new announcement the caller has to send, unless the seed was announced already.
+// Only the maps are locked, so submissions don't wait on each other's messages
+func claimAnnouncement(guildID string, e events.SeedSubmitted, now time.Time) (a *liveAnnouncement, isNew bool) {
+	announceMu.Lock()
+	defer announceMu.Unlock()
+
+	key := liveKey(guildID, e)
+	liveMu.Lock()
+	defer liveMu.Unlock()
+
+	if a, ok := liveAnnouncements[key]; ok && !a.expired(now) {
+		if slices.ContainsFunc(a.finders, func(finder string) bool { return strings.EqualFold(finder, e.Ign) }) {
+			return nil, false
+		}
+		a.finders = append(a.finders, e.Ign)
+		return a, false
+	}
+	if seedCache.HasSeen(key) {
+		return nil, false
+	}
+
+	a = newLiveAnnouncement(e, "")
+	liveAnnouncements[key] = a
+	return a, true
+}
+
+// releaseAnnouncement forgets a claimed announcement that couldn't be sent, so the next finder tries again
+func releaseAnnouncement(guildID string, e events.SeedSubmitted, a *liveAnnouncement) {
+	announceMu.Lock()
+	defer announceMu.Unlock()
+
+	key := liveKey(guildID, e)
+	liveMu.Lock()
+	defer liveMu.Unlock()
+	if liveAnnouncements[key] == a {
+		delete(liveAnnouncements, key)
+	}
+}
+
+// updateLiveAnnouncements edits the countdowns of the announcements, and expires the ones whose lobby requeued
+func (bot *Bot) updateLiveAnnouncements(now time.Time) {
+	liveMu.Lock()
+	live := make(map[string]*liveAnnouncement, len(liveAnnouncements))
+	for key, a := range liveAnnouncements {
+		if a.messageID == "" {
+			// it's still being sent
+			continue
+		}
+		if a.deadline.IsZero() && now.Sub(a.at) > mergeDuration {
+			// there's nothing to count down, it's only kept for merging
+			delete(liveAnnouncements, key)
+			continue
+		}
+		live[key] = a
+	}
+	liveMu.Unlock()
+
+	for key, a := range live {
+		if !a.expired(now) {
+			bot.updateLiveAnnouncement(a, now)
+			continue
+		}
+
+		bot.expireLiveAnnouncement(a, now)
+		liveMu.Lock()
+		delete(liveAnnouncements, key)
+		liveMu.Unlock()
+	}
+}
+
+func (bot *Bot) updateLiveAnnouncement(a *liveAnnouncement, now time.Time) {
+	liveMu.Lock()
+	messageID := a.messageID
+	liveMu.Unlock()
+	if messageID == "" {
+		// sendAnnouncement shows the finders merged while it was sending
+		return
+	}
+
+	unlock := lockMessage(messageID)
+	defer unlock()
+
+	liveMu.Lock()
+	content := a.content(now)
+	if content == a.shown {
+		liveMu.Unlock()
+		return
+	}
+	a.shown = content
+	liveMu.Unlock()
+
+	_, err := bot.s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:              a.messageID,
+		Channel:         a.channelID,
+		Content:         &content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Errorf("Failed to update the countdown of message %s: %v", a.messageID, err)
+	}
+}
+
+// expireLiveAnnouncement marks an announcement as expired and takes all its buttons away
+func (bot *Bot) expireLiveAnnouncement(a *liveAnnouncement, now time.Time) {
+	unlock := lockMessage(a.messageID)
+	defer unlock()
+
+	liveMu.Lock()
+	content := a.content(now)
+	a.shown = content
+	liveMu.Unlock()
+
+	message, err := bot.s.ChannelMessage(a.channelID, a.messageID)
+	if err != nil {
+		log.Errorf("Failed to get message %s to expire it: %v", a.messageID, err)
+		bot.deleteState(a.messageID)
+		forgetMessageLock(a.messageID)
+		return
+	}
+
+	edit := &discordgo.MessageEdit{
+		ID:              a.messageID,
+		Channel:         a.channelID,
+		Content:         &content,
+		Components:      &[]discordgo.MessageComponent{},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	if err := keepImage(edit, message); err != nil {
+		log.Error(err)
+		return
+	}
+	if _, err := bot.s.ChannelMessageEditComplex(edit); err != nil {
+		log.Errorf("Failed to expire message %s: %v", a.messageID, err)
+	}
+
+	log.Infof("The lobby of the seed in message %s requeued", a.messageID)
+	bot.deleteState(a.messageID)
+	forgetMessageLock(a.messageID)
+}
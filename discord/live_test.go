@@ -0,0 +1,86 @@
+package discord_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"pkd-bot/discord"
+	"pkd-bot/discord/discordtest"
+	"pkd-bot/state"
+)
+
+func TestLiveAnnouncement(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("guild", "announcements", discord.AnnouncementChannel)
+	discord.UseFakes(t, fake)
+
+	e := seedSubmitted(t)
+	discord.AnnounceSeed(e)
+
+	messages := fake.Messages("announcements")
+	if len(messages) != 1 || !strings.Contains(messages[0].Content, "m1A requeues in 2:") {
+		t.Fatalf("got %+v, want the announcement with the time left", messages)
+	}
+	id := messages[0].ID
+
+	discord.UpdateLiveAnnouncements(e.At.Add(time.Minute))
+	if got := fake.Message(id).Content; !strings.Contains(got, "requeues in 1:30") {
+		t.Errorf("got %q, want the countdown a minute later", got)
+	}
+
+	other := e
+	other.Ign = "Other"
+	discord.AnnounceSeed(other)
+	elsewhere := e
+	elsewhere.Lobby = "m2B"
+	discord.AnnounceSeed(elsewhere)
+
+	messages = fake.Messages("announcements")
+	if len(messages) != 2 || !strings.Contains(messages[1].Content, "m2B") {
+		t.Fatalf("got %d announcements, want the seed of the other lobby announced", len(messages))
+	}
+	if got := fake.Message(id).Content; !strings.Contains(got, "Finder and Other have found") {
+		t.Errorf("got %q, want the second finder merged into the announcement", got)
+	}
+
+	discord.UpdateLiveAnnouncements(e.At.Add(3 * time.Minute))
+	message := fake.Message(id)
+	if !strings.Contains(message.Content, "expired") || strings.Contains(message.Content, "requeues in") {
+		t.Errorf("got %q, want the announcement expired", message.Content)
+	}
+	if got := buttons(message); len(got) != 0 {
+		t.Errorf("got buttons %v, want none once the lobby requeued", got)
+	}
+	if len(message.Attachments) != 1 {
+		t.Errorf("got %d attachments, want the image kept", len(message.Attachments))
+	}
+	if _, err := discord.States().Get(id); !errors.Is(err, state.ErrNotFound) {
+		t.Errorf("got %v, want the state gone", err)
+	}
+
+	// someone submitting the seed late doesn't announce it again
+	late := e
+	late.Ign = "Late"
+	discord.AnnounceSeed(late)
+	if messages := fake.Messages("announcements"); len(messages) != 2 {
+		t.Errorf("got %d announcements, want no new one after the lobby requeued", len(messages))
+	}
+}
+
+func TestLiveAnnouncementWithoutTimeLeft(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("guild", "announcements", discord.AnnouncementChannel)
+	discord.UseFakes(t, fake)
+
+	e := seedSubmitted(t)
+	e.TimeLeft = "soon"
+	discord.AnnounceSeed(e)
+	discord.UpdateLiveAnnouncements(e.At.Add(time.Minute))
+
+	messages := fake.Messages("announcements")
+	if len(messages) != 1 || !strings.Contains(messages[0].Content, "requeues in soon") || len(buttons(messages[0])) != 2 {
+		t.Errorf("got %+v, want the announcement as it was sent", messages)
+	}
+}
@@ -0,0 +1,103 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/lobbies"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxListedLobbies keeps /lobbies within the fields an embed can have
+const maxListedLobbies = 10
+
+// lobbyRegistry is swapped out in tests
+var lobbyRegistry = lobbies.Current
+
+var lobbiesCommand = &discordgo.ApplicationCommand{
+	Name:        "lobbies",
+	Description: "List the lobbies with a good seed you can still join",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "max_time",
+			Description: fmt.Sprintf("Only seeds under this boost time, e.g. 2:05 (default %s)", calc.FormatTime(calc.DefaultAnnouncementThreshold)),
+		},
+	},
+}
+
+func (bot *Bot) lobbiesHandler(s Session, i *discordgo.InteractionCreate) {
+	logUserInteraction(i, "command", "lobbies")
+
+	respond := func(data *discordgo.InteractionResponseData) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: data,
+		})
+		if err != nil {
+			log.Errorf("Failed to respond to /lobbies: %v", err)
+		}
+	}
+
+	maxTime := bot.threshold
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name != "max_time" {
+			continue
+		}
+		d, err := calc.ParseTimeLeft(option.StringValue())
+		if err != nil || d <= 0 {
+			respond(&discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("\"%s\" isn't a time like 2:05 or 125", option.StringValue()),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			})
+			return
+		}
+		maxTime = d.Seconds()
+	}
+
+	now := time.Now()
+	joinable := lobbyRegistry.Joinable(now, maxTime)
+	if len(joinable) == 0 {
+		respond(&discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("Nobody has sent a seed under %s from a lobby that's still up.", calc.FormatTime(maxTime)),
+		})
+		return
+	}
+
+	respond(&discordgo.InteractionResponseData{
+		Embeds:          []*discordgo.MessageEmbed{lobbiesEmbed(joinable, maxTime, now)},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+}
+
+func lobbiesEmbed(joinable []lobbies.Lobby, maxTime float64, now time.Time) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Seeds under %s you can still join", calc.FormatTime(maxTime)),
+		Color: 0x45D3B3,
+	}
+	if len(joinable) > maxListedLobbies {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("and %d more", len(joinable)-maxListedLobbies)}
+		joinable = joinable[:maxListedLobbies]
+	}
+
+	for _, l := range joinable {
+		var value strings.Builder
+		// discord counts the relative timestamp down by itself
+		if !l.Deadline.IsZero() {
+			fmt.Fprintf(&value, "Requeues <t:%d:R>", l.Deadline.Unix())
+		} else {
+			fmt.Fprintf(&value, "Sent <t:%d:R>", l.LastSeen.Unix())
+		}
+		fmt.Fprintf(&value, ", found by %s\n%s", strings.Join(l.Finders, ", "), strings.Join(l.Rooms, ", "))
+
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("%s · %s", l.Name, calc.FormatTime(l.Result.BoostTime)),
+			Value: value.String(),
+		})
+	}
+	return embed
+}
@@ -0,0 +1,48 @@
+package discord_test
+
+import (
+	"strings"
+	"testing"
+
+	"pkd-bot/discord"
+	"pkd-bot/discord/discordtest"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestLobbiesHandler(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+
+	discord.LobbiesHandler(fake, commandInteraction("lobbies", "lobbies", member))
+	if got := fake.Responses(); len(got) != 1 || !strings.Contains(got[0].Data.Content, "Nobody") {
+		t.Fatalf("got %+v, want to be told there are no lobbies", got)
+	}
+
+	fast := seedSubmitted(t)
+	fast.Result.BoostTime = 120
+	slow := seedSubmitted(t)
+	slow.Lobby, slow.Result.BoostTime = "m2B", 128
+	discord.Lobbies().Add(slow)
+	discord.Lobbies().Add(fast)
+
+	discord.LobbiesHandler(fake, commandInteraction("lobbies", "lobbies", member))
+	embeds := fake.Responses()[1].Data.Embeds
+	if len(embeds) != 1 || len(embeds[0].Fields) != 2 {
+		t.Fatalf("got %+v, want both lobbies", embeds)
+	}
+	if first := embeds[0].Fields[0]; !strings.HasPrefix(first.Name, "m1A") || !strings.Contains(first.Value, "Requeues <t:") ||
+		!strings.Contains(first.Value, "Finder") {
+		t.Errorf("got %+v, want the fastest seed first with its requeue time and finder", first)
+	}
+
+	discord.LobbiesHandler(fake, commandInteraction("lobbies", "lobbies", member, option("max_time", discordgo.ApplicationCommandOptionString, "2:05")))
+	if embeds := fake.Responses()[2].Data.Embeds; len(embeds) != 1 || len(embeds[0].Fields) != 1 {
+		t.Errorf("got %+v, want only the seed under 2:05", embeds)
+	}
+
+	discord.LobbiesHandler(fake, commandInteraction("lobbies", "lobbies", member, option("max_time", discordgo.ApplicationCommandOptionString, "soon")))
+	if got := lastResponse(t, fake); !strings.Contains(got, "isn't a time") {
+		t.Errorf("got %q, want the time rejected", got)
+	}
+}
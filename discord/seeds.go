@@ -0,0 +1,432 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/render"
+	"pkd-bot/storage"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// the buttons of /seeds have what they need after the prefix, so they keep working after a restart
+const (
+	ButtonSeedsPage   = "seeds_page"
+	ButtonSeedsRecalc = "seeds_recalc"
+)
+
+// seedsPerPage fits the recalc buttons of a page in one row
+const seedsPerPage = 5
+
+// ignPattern is what minecraft names look like, it keeps the ign short enough for the button ids and free of colons
+var ignPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,16}$`)
+
+var seedsCommand = &discordgo.ApplicationCommand{
+	Name:        "seeds",
+	Description: "Search the seeds players submitted with ChatTriggers",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "since",
+			Description: "Found after this, e.g. 24h, 7d or 2024-06-01",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "until",
+			Description: "Found before this, e.g. 24h, 7d or 2024-06-01",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "max_time",
+			Description: "The slowest boost time, e.g. 2:05",
+		},
+		{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         "room",
+			Description:  "A room the seed has",
+			Autocomplete: true,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "ign",
+			Description: "Who found the seed",
+			MaxLength:   16,
+		},
+	},
+}
+
+// seedsQuery is what /seeds searches for, times are absolute so the pages don't shift while they're browsed
+type seedsQuery struct {
+	since   time.Time
+	until   time.Time
+	maxTime float64
+	room    string
+	ign     string
+}
+
+func (q seedsQuery) filter() storage.SubmissionFilter {
+	return storage.SubmissionFilter{
+		Ign:           q.ign,
+		Since:         q.since,
+		Until:         q.until,
+		MaxTime:       q.maxTime,
+		Room:          q.room,
+		NoDebug:       true,
+		FirstPerLobby: true,
+	}
+}
+
+// customID is the id of the button to a page of the query, igns and room slugs have no colons in them
+func (q seedsQuery) customID(page int) string {
+	unix := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return strconv.FormatInt(t.Unix(), 36)
+	}
+	room := ""
+	if q.room != "" {
+		room = calc.RoomSlug(q.room)
+	}
+
+	return strings.Join([]string{
+		ButtonSeedsPage,
+		strconv.Itoa(page),
+		unix(q.since),
+		unix(q.until),
+		strconv.FormatFloat(q.maxTime, 'f', -1, 64),
+		room,
+		q.ign,
+	}, ":")
+}
+
+func parseSeedsPageID(customID string) (seedsQuery, int, error) {
+	parts := strings.Split(customID, ":")
+	if len(parts) != 7 || parts[0] != ButtonSeedsPage {
+		return seedsQuery{}, 0, fmt.Errorf("%q isn't a page of /seeds", customID)
+	}
+
+	var q seedsQuery
+	page, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return seedsQuery{}, 0, fmt.Errorf("%q isn't a page of /seeds: %w", customID, err)
+	}
+	for i, t := range []*time.Time{&q.since, &q.until} {
+		if parts[2+i] == "" {
+			continue
+		}
+		unix, err := strconv.ParseInt(parts[2+i], 36, 64)
+		if err != nil {
+			return seedsQuery{}, 0, fmt.Errorf("%q isn't a page of /seeds: %w", customID, err)
+		}
+		*t = time.Unix(unix, 0)
+	}
+	if q.maxTime, err = strconv.ParseFloat(parts[4], 64); err != nil {
+		return seedsQuery{}, 0, fmt.Errorf("%q isn't a page of /seeds: %w", customID, err)
+	}
+	if parts[5] != "" {
+		var ok bool
+		if q.room, ok = calc.RoomBySlug(parts[5]); !ok {
+			return seedsQuery{}, 0, fmt.Errorf("%q isn't a page of /seeds: no room %s", customID, parts[5])
+		}
+	}
+	q.ign = parts[6]
+
+	return q, page, nil
+}
+
+// parseSeedsTime reads how long ago, like 24h, 7d or 2w, or a date like 2024-06-01 in UTC
+func parseSeedsTime(v string, now time.Time) (time.Time, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if date, err := time.Parse("2006-01-02", v); err == nil {
+		return date, nil
+	}
+
+	units := map[string]time.Duration{"h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if n, err := strconv.Atoi(strings.TrimSuffix(v, suffix)); err == nil && strings.HasSuffix(v, suffix) && n >= 0 {
+			return now.Add(-time.Duration(n) * unit), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("\"%s\" isn't a time like 24h, 7d or 2024-06-01", v)
+}
+
+func parseSeedsQuery(options []*discordgo.ApplicationCommandInteractionDataOption, now time.Time) (seedsQuery, error) {
+	var q seedsQuery
+	for _, option := range options {
+		var err error
+		switch option.Name {
+		case "since":
+			q.since, err = parseSeedsTime(option.StringValue(), now)
+		case "until":
+			q.until, err = parseSeedsTime(option.StringValue(), now)
+		case "max_time":
+			d, parseErr := calc.ParseTimeLeft(option.StringValue())
+			if parseErr != nil || d <= 0 {
+				err = fmt.Errorf("\"%s\" isn't a time like 2:05 or 125", option.StringValue())
+			}
+			q.maxTime = d.Seconds()
+		case "room":
+			var rooms []string
+			rooms, err = parseRoomList(option.StringValue())
+			if err == nil && len(rooms) != 1 {
+				err = fmt.Errorf("pick one room")
+			}
+			if err == nil {
+				q.room = rooms[0]
+			}
+		case "ign":
+			q.ign = strings.TrimSpace(option.StringValue())
+			if !ignPattern.MatchString(q.ign) {
+				err = fmt.Errorf("\"%s\" isn't an ign", q.ign)
+			}
+		}
+		if err != nil {
+			return seedsQuery{}, err
+		}
+	}
+	return q, nil
+}
+
+func (bot *Bot) seedsHandler(s Session, i *discordgo.InteractionCreate) {
+	logUserInteraction(i, "command", "seeds")
+
+	respond := func(data *discordgo.InteractionResponseData) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: data,
+		})
+		if err != nil {
+			log.Errorf("Failed to respond to /seeds: %v", err)
+		}
+	}
+
+	q, err := parseSeedsQuery(i.ApplicationCommandData().Options, time.Now())
+	if err != nil {
+		respond(&discordgo.InteractionResponseData{Content: err.Error(), Flags: discordgo.MessageFlagsEphemeral})
+		return
+	}
+
+	data, err := bot.seedsPage(q, 0, i.GuildID)
+	if err != nil {
+		log.Error(err)
+		respond(&discordgo.InteractionResponseData{Content: "I couldn't search the seeds, try again later.", Flags: discordgo.MessageFlagsEphemeral})
+		return
+	}
+	respond(data)
+}
+
+// seedsPage is a page of the seeds found for q, with links to their announcements in guildID if it has them
+func (bot *Bot) seedsPage(q seedsQuery, page int, guildID string) (*discordgo.InteractionResponseData, error) {
+	ctx := context.Background()
+
+	total, err := bot.store.CountSubmissions(ctx, q.filter())
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return &discordgo.InteractionResponseData{Content: "No seeds were found like that.", Components: []discordgo.MessageComponent{}}, nil
+	}
+
+	pages := (total + seedsPerPage - 1) / seedsPerPage
+	page = max(0, min(page, pages-1))
+	filter := q.filter()
+	filter.Limit, filter.Offset = seedsPerPage, page*seedsPerPage
+	subs, err := bot.store.ListSubmissions(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:  "Seeds",
+		Color:  0x45D3B3,
+		Footer: &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d, %d seeds", page+1, pages, total)},
+	}
+	recalcButtons := make([]discordgo.MessageComponent, 0, len(subs))
+	for n, sub := range subs {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("%d. %s by %s in %s", n+1, calc.FormatTime(sub.BoostTime), sub.Ign, sub.Lobby),
+			Value: bot.describeHistorySeed(sub, guildID),
+		})
+		recalcButtons = append(recalcButtons, discordgo.Button{
+			CustomID: fmt.Sprintf("%s:%d", ButtonSeedsRecalc, sub.ID),
+			Label:    fmt.Sprintf("Recalc %d", n+1),
+			Style:    discordgo.SecondaryButton,
+		})
+	}
+
+	return &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{CustomID: q.customID(page - 1), Label: "Previous", Style: discordgo.PrimaryButton, Disabled: page == 0},
+				discordgo.Button{CustomID: q.customID(page + 1), Label: "Next", Style: discordgo.PrimaryButton, Disabled: page >= pages-1},
+			}},
+			discordgo.ActionsRow{Components: recalcButtons},
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}, nil
+}
+
+func (bot *Bot) describeHistorySeed(sub storage.Submission, guildID string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<t:%d:f>", sub.At.Unix())
+	if link := bot.announcementLink(sub, guildID); link != "" {
+		fmt.Fprintf(&b, " · [announcement](%s)", link)
+	}
+	if sub.SplitsHash != "" {
+		fmt.Fprintf(&b, " · splits `%s`", sub.SplitsHash)
+	}
+	fmt.Fprintf(&b, "\n%s", strings.Join(sub.Rooms, ", "))
+	if plan := describePlan(sub.Rooms, sub.Plan); plan != "" {
+		fmt.Fprintf(&b, "\nBoosts: %s", plan)
+	}
+	return b.String()
+}
+
+// announcementLink links to the announcement of the submission's seed, the one in guildID if there's one there
+func (bot *Bot) announcementLink(sub storage.Submission, guildID string) string {
+	announcements, err := bot.store.SeedAnnouncements(context.Background(), sub.Rooms, sub.Lobby)
+	if err != nil {
+		log.Warn(err)
+		return ""
+	}
+
+	// announcements without a guild are from before they were recorded, they can't be linked
+	announcements = slices.DeleteFunc(announcements, func(a storage.Announcement) bool { return a.GuildID == "" })
+	if len(announcements) == 0 {
+		return ""
+	}
+	a := announcements[0]
+	if index := slices.IndexFunc(announcements, func(a storage.Announcement) bool { return a.GuildID == guildID }); index >= 0 {
+		a = announcements[index]
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", a.GuildID, a.ChannelID, a.MessageID)
+}
+
+// describePlan names the boosts of a plan with the current splits, the ones whose strats are gone since are left out
+func describePlan(rooms []string, plan []calc.CalcResultBoost) string {
+	withFinish := append(slices.Clone(rooms), "finish room")
+
+	var boosts []string
+	for _, boost := range plan {
+		if boost.Ind < 0 || boost.Ind >= len(withFinish) {
+			continue
+		}
+		room, exists := calc.RoomMap[withFinish[boost.Ind]]
+		if !exists || boost.StratInd < 0 || boost.StratInd >= len(room.BoostStrats) {
+			continue
+		}
+		boosts = append(boosts, fmt.Sprintf("%s (%s)", room.Name, room.BoostStrats[boost.StratInd].Name))
+	}
+	return strings.Join(boosts, ", ")
+}
+
+// seedsButtonHandler turns the pages of /seeds and recalcs their seeds
+func (bot *Bot) seedsButtonHandler(s Session, i *discordgo.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+	logUserInteraction(i, "button click", customID)
+
+	if strings.HasPrefix(customID, ButtonSeedsRecalc+":") {
+		bot.recalcHistorySeed(s, i, strings.TrimPrefix(customID, ButtonSeedsRecalc+":"))
+		return
+	}
+
+	q, page, err := parseSeedsPageID(customID)
+	var data *discordgo.InteractionResponseData
+	if err == nil {
+		data, err = bot.seedsPage(q, page, i.GuildID)
+	}
+	if err != nil {
+		log.Error(err)
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Content: "I couldn't get that page, run /seeds again.", Flags: discordgo.MessageFlagsEphemeral},
+		})
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: data,
+	})
+	if err != nil {
+		log.Errorf("Failed to turn the page of /seeds: %v", err)
+	}
+}
+
+// recalcHistorySeed calcs a seed from the history again with the current splits, for the one who clicked
+func (bot *Bot) recalcHistorySeed(s Session, i *discordgo.InteractionCreate, submissionID string) {
+	respond := func(content string) {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Content: content, Flags: discordgo.MessageFlagsEphemeral},
+		})
+	}
+
+	id, err := strconv.ParseInt(submissionID, 10, 64)
+	if err != nil {
+		respond("That seed doesn't exist anymore.")
+		return
+	}
+	sub, err := bot.store.GetSubmission(context.Background(), id)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Error(err)
+		}
+		respond("That seed doesn't exist anymore.")
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.Errorf("Failed to defer the recalc: %v", err)
+		return
+	}
+
+	edit := func(content string, files []*discordgo.File) {
+		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content, Files: files}); err != nil {
+			log.Errorf("Failed to send the recalc: %v", err)
+		}
+	}
+
+	results, err := calc.Results.CalcSeed(slices.Clone(sub.Rooms))
+	if err != nil || len(results) == 0 {
+		log.Errorf("Failed to recalc submission %d: %v", sub.ID, err)
+		edit("I couldn't calc that seed with the current splits, its rooms might have changed.", nil)
+		return
+	}
+	best := results[0]
+
+	hash := calc.SplitsHash(calc.RoomMap)
+	content := fmt.Sprintf("**%s** with the current splits (`%s`), it was **%s**", calc.FormatTime(best.BoostTime), hash, calc.FormatTime(sub.BoostTime))
+	if sub.SplitsHash != "" {
+		content += fmt.Sprintf(" with `%s`", sub.SplitsHash)
+	}
+	if diff := best.BoostTime - sub.BoostTime; diff != 0 {
+		content += fmt.Sprintf(" (%+.2fs)", diff)
+	}
+	content += fmt.Sprintf("\nBoosts: %s\n```%s```", describePlan(sub.Rooms, best.BoostRooms), createCalcCommand(sub.Rooms))
+
+	img, err := render.CalcResults(sub.Rooms, results[:1])
+	if err != nil {
+		log.Errorf("error drawing seed results: %v", err)
+		edit(content, nil)
+		return
+	}
+	edit(content, []*discordgo.File{{Name: seedFileName(sub.Rooms), Reader: bytes.NewReader(img.Bytes())}})
+}
@@ -0,0 +1,133 @@
+package discord_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/discord"
+	"pkd-bot/discord/discordtest"
+	"pkd-bot/storage"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// seedsButtons are the custom ids of the buttons of a /seeds page, the page buttons first
+func seedsButtons(data *discordgo.InteractionResponseData) []string {
+	var ids []string
+	for _, row := range data.Components {
+		for _, component := range row.(discordgo.ActionsRow).Components {
+			ids = append(ids, component.(discordgo.Button).CustomID)
+		}
+	}
+	return ids
+}
+
+// addHistory adds n seeds found a minute apart in their own lobbies, the fastest is the newest
+func addHistory(t *testing.T, n int) {
+	t.Helper()
+
+	now := time.Now()
+	for i := range n {
+		sub := &storage.Submission{
+			Ign:        "Finder",
+			Lobby:      "m" + string(rune('A'+i)),
+			Rooms:      testRooms,
+			BoostTime:  float64(130 - i),
+			Plan:       []calc.CalcResultBoost{{Ind: 2, StratInd: 0}},
+			SplitsHash: "old",
+			At:         now.Add(time.Duration(i-n) * time.Minute),
+		}
+		if err := discord.Storage().AddSubmission(context.Background(), sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSeedsHandler(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+
+	discord.SeedsHandler(fake, commandInteraction("seeds", "seeds1", member))
+	if got := fake.Responses()[0].Data.Content; !strings.Contains(got, "No seeds") {
+		t.Fatalf("got %q, want to be told there are no seeds", got)
+	}
+
+	addHistory(t, 7)
+	err := discord.Storage().AddAnnouncement(context.Background(), &storage.Announcement{
+		GuildID: "guild", Lobby: "mG", Rooms: testRooms, BoostTime: 124, ChannelID: "announcements", MessageID: "announced", At: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discord.SeedsHandler(fake, commandInteraction("seeds", "seeds2", member))
+	first := fake.Responses()[1].Data
+	fields := first.Embeds[0].Fields
+	if len(fields) != 5 || !strings.Contains(fields[0].Name, "mG") {
+		t.Fatalf("got %+v, want the 5 newest seeds", fields)
+	}
+	if !strings.Contains(fields[0].Value, "https://discord.com/channels/guild/announcements/announced") ||
+		!strings.Contains(fields[0].Value, "`old`") || !strings.Contains(fields[0].Value, "Boosts: Fences") {
+		t.Errorf("got %q, want the link to the announcement, the splits and the plan", fields[0].Value)
+	}
+	if strings.Contains(fields[1].Value, "announcement") {
+		t.Errorf("got %q, want no link for a seed that wasn't announced", fields[1].Value)
+	}
+
+	ids := seedsButtons(first)
+	if len(ids) != 7 {
+		t.Fatalf("got buttons %v, want previous, next and a recalc for each seed", ids)
+	}
+	page := &discordgo.Message{ID: "page", ChannelID: "commands"}
+	discord.SeedsButtonHandler(fake, click("next", page, ids[1]))
+	second := fake.Responses()[2]
+	if second.Type != discordgo.InteractionResponseUpdateMessage || len(second.Data.Embeds[0].Fields) != 2 ||
+		!strings.Contains(second.Data.Embeds[0].Footer.Text, "Page 2 of 2") {
+		t.Errorf("got %+v, want the page turned to the last 2 seeds", second.Data)
+	}
+
+	discord.SeedsButtonHandler(fake, click("recalc", page, ids[2]))
+	messages := fake.Messages("commands")
+	if len(messages) == 0 || !strings.Contains(messages[len(messages)-1].Content, "it was **2:04") ||
+		!strings.Contains(messages[len(messages)-1].Content, calc.SplitsHash(calc.RoomMap)) {
+		t.Errorf("got %+v, want the seed recalced with the current splits", messages)
+	}
+
+	discord.SeedsHandler(fake, commandInteraction("seeds", "seeds3", member, option("max_time", discordgo.ApplicationCommandOptionString, "2:06")))
+	if got := fake.Responses(); len(got[len(got)-1].Data.Embeds[0].Fields) != 3 {
+		t.Errorf("got %+v, want only the seeds up to 2:06", got[len(got)-1].Data.Embeds[0].Fields)
+	}
+
+	discord.SeedsHandler(fake, commandInteraction("seeds", "seeds4", member, option("since", discordgo.ApplicationCommandOptionString, "soon")))
+	if got := lastResponse(t, fake); !strings.Contains(got, "isn't a time") {
+		t.Errorf("got %q, want the time rejected", got)
+	}
+
+	discord.SeedsHandler(fake, commandInteraction("seeds", "seeds5", member, option("ign", discordgo.ApplicationCommandOptionString, "not:a:name")))
+	if got := lastResponse(t, fake); !strings.Contains(got, "isn't an ign") {
+		t.Errorf("got %q, want the ign rejected", got)
+	}
+}
+
+func TestSeedsPagesKeepTheirFilter(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+	addHistory(t, 12)
+
+	discord.SeedsHandler(fake, commandInteraction("seeds", "seeds5", member,
+		option("since", discordgo.ApplicationCommandOptionString, "1h"),
+		option("room", discordgo.ApplicationCommandOptionString, "ice"),
+		option("ign", discordgo.ApplicationCommandOptionString, "finder"),
+		option("max_time", discordgo.ApplicationCommandOptionString, "2:08"),
+	))
+	next := seedsButtons(fake.Responses()[0].Data)[1]
+
+	discord.SeedsButtonHandler(fake, click("next", &discordgo.Message{ID: "page", ChannelID: "commands"}, next))
+	got := fake.Responses()[1].Data
+	if len(got.Embeds) != 1 || !strings.Contains(got.Embeds[0].Footer.Text, "10 seeds") {
+		t.Errorf("got %+v, want the second page of the seeds under 2:08", got)
+	}
+}
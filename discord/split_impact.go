@@ -0,0 +1,193 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"pkd-bot/calc"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+const maxHistogramLines = 15
+
+var adminPermission int64 = discordgo.PermissionAdministrator
+
+var splitImpactCommand = &discordgo.ApplicationCommand{
+	Name:                     "splitimpact",
+	Description:              "See what candidate splits do to random seeds",
+	DefaultMemberPermissions: &adminPermission,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionAttachment,
+			Name:        "splits",
+			Description: "JSON file with the candidate splits (same shape as the calc's RoomMap)",
+			Required:    true,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "samples",
+			Description: fmt.Sprintf("How many random seeds to check (default %d)", calc.DefaultImpactSamples),
+			MinValue:    func() *float64 { v := 1.0; return &v }(),
+			MaxValue:    calc.MaxImpactSamples,
+		},
+	},
+}
+
+func (bot *Bot) splitImpactHandler(s Session, i *discordgo.InteractionCreate) {
+	logUserInteraction(i, "command", "splitimpact")
+
+	data := i.ApplicationCommandData()
+	samples := calc.DefaultImpactSamples
+	var attachmentID string
+	for _, option := range data.Options {
+		switch option.Name {
+		case "splits":
+			attachmentID, _ = option.Value.(string)
+		case "samples":
+			samples = int(option.IntValue())
+		}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{},
+	})
+	if err != nil {
+		log.Errorf("Failed to defer response: %v", err)
+		return
+	}
+
+	respondWithError := func(content string) {
+		_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+		})
+		if err != nil {
+			log.Errorf("Failed to edit response with error message: %v", err)
+		}
+	}
+
+	if data.Resolved == nil || data.Resolved.Attachments[attachmentID] == nil {
+		respondWithError("Please attach a JSON file with the candidate splits.")
+		return
+	}
+	attachment := data.Resolved.Attachments[attachmentID]
+
+	content, err := downloadAttachment(attachment.URL)
+	if err != nil {
+		log.Warn(err)
+		respondWithError("Failed to download the attachment. Please try again.")
+		return
+	}
+
+	candidate, err := calc.LoadSplits(bytes.NewReader(content))
+	if err != nil {
+		respondWithError(fmt.Sprintf("I couldn't read these splits: %v", err))
+		return
+	}
+
+	report, err := calc.SplitImpact(context.Background(), candidate, samples, bot.threshold, rand.New(rand.NewSource(time.Now().UnixNano())))
+	if err != nil {
+		log.Error(err)
+		respondWithError("Go tell the developer he's an idiot 'cause something's broken idk")
+		return
+	}
+
+	var csvBuf bytes.Buffer
+	if err := report.WriteCSV(&csvBuf); err != nil {
+		log.Error(err)
+		respondWithError("Failed to build the CSV report.")
+		return
+	}
+
+	embed := createSplitImpactEmbed(attachment.Filename, report)
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds: &[]*discordgo.MessageEmbed{embed},
+		Files: []*discordgo.File{
+			{
+				Name:        "split_impact.csv",
+				ContentType: "text/csv",
+				Reader:      &csvBuf,
+			},
+		},
+	})
+	if err != nil {
+		log.Errorf("Failed to edit response with split impact report: %v", err)
+	}
+}
+
+func createSplitImpactEmbed(filename string, report calc.ImpactReport) *discordgo.MessageEmbed {
+	var histogram strings.Builder
+	histogram.WriteString("```\n")
+
+	// Merge neighbouring buckets so the histogram fits into an embed field
+	buckets := report.Histogram
+	if len(buckets) > maxHistogramLines {
+		groupSize := (len(buckets) + maxHistogramLines - 1) / maxHistogramLines
+		merged := make([]calc.ImpactBucket, 0, maxHistogramLines)
+		for start := 0; start < len(buckets); start += groupSize {
+			end := min(start+groupSize, len(buckets))
+			bucket := calc.ImpactBucket{From: buckets[start].From, To: buckets[end-1].To}
+			for _, b := range buckets[start:end] {
+				bucket.Count += b.Count
+			}
+			merged = append(merged, bucket)
+		}
+		buckets = merged
+	}
+
+	maxCount := 0
+	for _, bucket := range buckets {
+		maxCount = max(maxCount, bucket.Count)
+	}
+	for _, bucket := range buckets {
+		if bucket.Count == 0 {
+			continue
+		}
+
+		barLength := bucket.Count * 20 / maxCount
+		histogram.WriteString(fmt.Sprintf("%+6.1f..%+6.1f %-20s %d\n",
+			bucket.From, bucket.To, strings.Repeat("#", barLength), bucket.Count))
+	}
+	histogram.WriteString("```")
+
+	percent := func(n int) string {
+		return fmt.Sprintf("%d (%.1f%%)", n, float64(n)*100/float64(report.Samples))
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Split impact: %s", filename),
+		Description: fmt.Sprintf("Checked %d random seeds. Negative deltas mean the candidate splits are faster.", report.Samples),
+		Color:       0x45D3B3,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Time delta",
+				Value:  fmt.Sprintf("mean %+.2fs\nmedian %+.2fs\nmin %+.2fs / max %+.2fs", report.MeanDelta, report.MedianDelta, report.MinDelta, report.MaxDelta),
+				Inline: true,
+			},
+			{
+				Name:   "Boost placement flipped",
+				Value:  percent(report.Flipped),
+				Inline: true,
+			},
+			{
+				Name: fmt.Sprintf("Under %s", calc.FormatTime(report.Threshold)),
+				Value: fmt.Sprintf("now %s\ncandidate %s\n+%d / -%d seeds",
+					percent(report.CurrentUnderThreshold), percent(report.CandidateUnderThreshold), report.Gained, report.Lost),
+				Inline: true,
+			},
+			{
+				Name:  "Distribution",
+				Value: histogram.String(),
+			},
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Per-seed results are in the attached CSV",
+		},
+	}
+}
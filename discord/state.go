@@ -0,0 +1,252 @@
+package discord
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/metrics"
+	"pkd-bot/state"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// buttonDuration is how long a message keeps all its buttons after the last click
+	buttonDuration = 5 * time.Minute
+	// longButtonDuration is how long "How did you get this?" stays after that
+	longButtonDuration = 5 * time.Minute
+	janitorInterval    = 15 * time.Second
+)
+
+// trackMessageStates has to be called after changing the states
+func (bot *Bot) trackMessageStates() {
+	count, err := bot.states.Len()
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+	metrics.MessageStates.Set(float64(count))
+}
+
+var messageLocks sync.Map
+
+// lockMessage serializes what happens to a message, clicks and cleanups read its state, edit the message and save the state again
+func lockMessage(messageID string) func() {
+	for {
+		v, _ := messageLocks.LoadOrStore(messageID, &sync.Mutex{})
+		mu := v.(*sync.Mutex)
+		mu.Lock()
+
+		// whoever held it before could have forgotten it, then the next caller would make a new one and not wait for us
+		if current, ok := messageLocks.Load(messageID); ok && current == v {
+			return mu.Unlock
+		}
+		mu.Unlock()
+	}
+}
+
+// forgetMessageLock drops the lock of a message that's done, it has to be called while holding that lock
+func forgetMessageLock(messageID string) {
+	messageLocks.Delete(messageID)
+}
+
+func stageDuration(stage state.Stage) time.Duration {
+	if stage == state.StageShowCalc {
+		return longButtonDuration
+	}
+	return buttonDuration
+}
+
+// saveState stores m, its buttons expire a whole stage from now
+func (bot *Bot) saveState(m state.Message) {
+	m.Expires = time.Now().Add(stageDuration(m.Stage))
+	if err := bot.states.Put(m); err != nil {
+		log.Error(err)
+	}
+	bot.trackMessageStates()
+}
+
+func (bot *Bot) deleteState(messageID string) {
+	if err := bot.states.Delete(messageID); err != nil {
+		log.Error(err)
+	}
+	bot.trackMessageStates()
+}
+
+// seedFileName puts the seed id in the name of the image, so the state of the message can be rebuilt from it
+func seedFileName(rooms []string) string {
+	return calc.SeedID(rooms) + ".png"
+}
+
+// loadState gets the state of a message. If the store lost it, e.g. after a restart with the memory store,
+// it's rebuilt from the rooms in the name of the message's image, starting from the best result again
+func (bot *Bot) loadState(message *discordgo.Message) (state.Message, error) {
+	m, err := bot.states.Get(message.ID)
+	if !errors.Is(err, state.ErrNotFound) || len(message.Attachments) == 0 {
+		return m, err
+	}
+
+	rooms, parseErr := calc.ParseSeedID(strings.TrimSuffix(message.Attachments[0].Filename, ".png"))
+	if parseErr != nil {
+		// the image is from before its name was the seed id
+		return m, err
+	}
+
+	log.Infof("Rebuilt the state of message %s from its seed", message.ID)
+	return state.Message{
+		MessageID: message.ID,
+		ChannelID: message.ChannelID,
+		Rooms:     rooms,
+		Index:     0,
+		Filter:    ButtonAnyBoost,
+		Stage:     messageStage(message),
+	}, nil
+}
+
+// messageStage tells from the buttons a message still has how far along their cleanup is
+func messageStage(message *discordgo.Message) state.Stage {
+	for _, row := range message.Components {
+		actions, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, component := range actions.Components {
+			if button, ok := component.(*discordgo.Button); ok && button.CustomID != ButtonShowCalc {
+				return state.StageNavigation
+			}
+		}
+	}
+	return state.StageShowCalc
+}
+
+func showCalcButtonRow() []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					CustomID: ButtonShowCalc,
+					Label:    "How did you get this?",
+					Style:    discordgo.SuccessButton,
+				},
+			},
+		},
+	}
+}
+
+// runStateJanitor takes away the buttons of messages that weren't clicked in a while, until stopJanitor is closed.
+// It goes by the expiry times in the states instead of timers, so the messages from before a restart expire too.
+// The countdowns of the announcements are updated on the same ticks
+func (bot *Bot) runStateJanitor() {
+	defer close(bot.janitorDone)
+
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := bot.states.Expired(time.Now())
+		if err != nil {
+			log.Error(err)
+		}
+		for _, m := range expired {
+			bot.expireMessage(m)
+		}
+		bot.updateLiveAnnouncements(time.Now())
+
+		select {
+		case <-bot.stopJanitor:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireMessage first leaves only "How did you get this?" on a message, and removes that too the next time
+func (bot *Bot) expireMessage(m state.Message) {
+	unlock := lockMessage(m.MessageID)
+	defer unlock()
+
+	// a click could have pushed the expiry back since it was listed
+	m, err := bot.states.Get(m.MessageID)
+	if err != nil {
+		if !errors.Is(err, state.ErrNotFound) {
+			log.Error(err)
+		}
+		return
+	}
+	if m.Expires.After(time.Now()) {
+		return
+	}
+
+	message, err := bot.s.ChannelMessage(m.ChannelID, m.MessageID)
+	if err != nil {
+		var restErr *discordgo.RESTError
+		if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound {
+			// the message was deleted, there are no buttons left to remove
+			bot.deleteState(m.MessageID)
+			forgetMessageLock(m.MessageID)
+			return
+		}
+		log.Errorf("Failed to get message for cleanup: %v", err)
+		return
+	}
+
+	components := []discordgo.MessageComponent{}
+	if m.Stage == state.StageNavigation {
+		components = showCalcButtonRow()
+	}
+
+	edit := &discordgo.MessageEdit{
+		ID:         m.MessageID,
+		Channel:    m.ChannelID,
+		Components: &components,
+	}
+	if err := keepImage(edit, message); err != nil {
+		log.Error(err)
+		return
+	}
+
+	if _, err := bot.s.ChannelMessageEditComplex(edit); err != nil {
+		log.Errorf("Failed to update buttons: %v", err)
+	}
+
+	if m.Stage == state.StageNavigation {
+		m.Stage = state.StageShowCalc
+		bot.saveState(m)
+		return
+	}
+
+	// Only delete state when fully done
+	bot.deleteState(m.MessageID)
+	forgetMessageLock(m.MessageID)
+}
+
+// keepImage uploads the image of message again with edit, so it stays when the buttons change.
+// Guilds can have their announcements without the image, then there's nothing to keep
+func keepImage(edit *discordgo.MessageEdit, message *discordgo.Message) error {
+	if len(message.Attachments) == 0 {
+		return nil
+	}
+
+	resp, err := http.Get(message.Attachments[0].URL)
+	if err != nil {
+		return fmt.Errorf("failed to get attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read attachment data: %w", err)
+	}
+
+	edit.Files = []*discordgo.File{{Name: message.Attachments[0].Filename, Reader: bytes.NewReader(data)}}
+	edit.Attachments = &[]*discordgo.MessageAttachment{}
+	return nil
+}
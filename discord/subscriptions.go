@@ -0,0 +1,536 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/events"
+	"pkd-bot/metrics"
+	"pkd-bot/ratelimit"
+	"pkd-bot/storage"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// tier is a group of seeds guilds can have a role for, members get it with /subscribe role
+type tier struct {
+	name    string
+	maxTime float64
+}
+
+var tiers = []tier{
+	{name: "sub-2:05", maxTime: 125},
+	{name: "sub-2:10", maxTime: 130},
+}
+
+func tierByName(name string) (tier, bool) {
+	for _, t := range tiers {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return tier{}, false
+}
+
+func tierChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(tiers))
+	for _, t := range tiers {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: t.name, Value: t.name})
+	}
+	return choices
+}
+
+var (
+	// notifiedSeeds keeps subscribers from getting the same seed again when the rest of the lobby submits it
+	notifiedSeeds = NewSeedCache(1 * time.Hour)
+	// dmLimit is per subscriber, the DMs that don't fit are dropped
+	dmLimit = ratelimit.New(0.1, 3)
+	// tierPingLimit is per guild and role, the pings that don't fit are left out of the announcement
+	tierPingLimit = ratelimit.New(0.5, 2)
+)
+
+var subscribeCommand = &discordgo.ApplicationCommand{
+	Name:        "subscribe",
+	Description: "Get told about good seeds",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "dm",
+			Description: "Get DMed about the seeds you care about, this replaces what you subscribed to before",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "max_time",
+					Description: fmt.Sprintf("The slowest boost time you want, e.g. 2:05 (default %s)", calc.FormatTime(calc.DefaultAnnouncementThreshold)),
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "rooms",
+					Description: "Rooms the seed has to have, separated by commas",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "exclude_rooms",
+					Description: "Rooms the seed can't have, separated by commas",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "lobby",
+					Description: "Only seeds in this lobby, e.g. m1A",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "igns",
+					Description: "Only seeds found by these players, separated by commas",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "quiet_hours",
+					Description: "When not to DM you, e.g. 23:00-07:00",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionNumber,
+					Name:        "utc_offset",
+					Description: "Your time zone for the quiet hours, in hours from UTC, e.g. -5 or 5.5",
+					MinValue:    func() *float64 { v := -12.0; return &v }(),
+					MaxValue:    14,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "role",
+			Description: "Get pinged for every seed of a tier in this server, run it again to stop",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "tier",
+					Description: "The seeds to get pinged for",
+					Choices:     tierChoices(),
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "show",
+			Description: "Show what you're subscribed to",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "stop",
+			Description: "Stop the DMs",
+		},
+	},
+}
+
+// interactionUser is who ran a command, in a guild or in DMs
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+func (bot *Bot) subscribeHandler(s Session, i *discordgo.InteractionCreate) {
+	logUserInteraction(i, "command", "subscribe")
+
+	respond := func(content string) {
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content:         content,
+				Flags:           discordgo.MessageFlagsEphemeral,
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			},
+		})
+		if err != nil {
+			log.Errorf("Failed to respond to /subscribe: %v", err)
+		}
+	}
+
+	user := interactionUser(i)
+	options := i.ApplicationCommandData().Options
+	if user == nil || len(options) == 0 {
+		respond("You sent an incomplete command.")
+		return
+	}
+	ctx := context.Background()
+
+	switch sub := options[0]; sub.Name {
+	case "dm":
+		subscription, err := bot.parseSubscription(user.ID, sub.Options)
+		if err != nil {
+			respond(err.Error())
+			return
+		}
+		if err := bot.store.PutSubscription(ctx, &subscription); err != nil {
+			log.Error(err)
+			respond("I couldn't save your subscription, try again later.")
+			return
+		}
+		bot.forgetSubscriptions()
+		respond("Subscribed, I'll DM you about " + describeSubscription(subscription) +
+			"\nYou need to allow DMs from members of a server we're both in.")
+	case "role":
+		respond(bot.toggleTierRole(s, i, sub.Options[0].StringValue()))
+	case "show":
+		content := "You're not getting DMs about seeds."
+		subscription, err := bot.store.GetSubscription(ctx, user.ID)
+		switch {
+		case err == nil:
+			content = "I DM you about " + describeSubscription(subscription)
+		case !errors.Is(err, storage.ErrNotFound):
+			log.Error(err)
+			content = "I couldn't get your subscription, try again later."
+		}
+
+		if i.GuildID != "" && i.Member != nil {
+			roles, err := bot.store.TierRoles(ctx, i.GuildID)
+			if err != nil {
+				log.Warn(err)
+			}
+			for _, role := range roles {
+				if slices.Contains(i.Member.Roles, role.RoleID) {
+					content += fmt.Sprintf("\nYou get pinged with <@&%s> for seeds under %s.", role.RoleID, calc.FormatTime(role.MaxTime))
+				}
+			}
+		}
+		respond(content)
+	case "stop":
+		if err := bot.store.DeleteSubscription(ctx, user.ID); err != nil {
+			log.Error(err)
+			respond("I couldn't unsubscribe you, try again later.")
+			return
+		}
+		bot.forgetSubscriptions()
+		respond("You won't get DMs about seeds anymore.")
+	default:
+		respond("There is no such command")
+	}
+}
+
+// toggleTierRole gives the member the guild's role of a tier, or takes it away if they have it
+func (bot *Bot) toggleTierRole(s Session, i *discordgo.InteractionCreate, tierName string) string {
+	if i.GuildID == "" || i.Member == nil {
+		return "Tier roles are per server, run this in one."
+	}
+
+	t, ok := tierByName(tierName)
+	if !ok {
+		return fmt.Sprintf("There's no %s tier.", tierName)
+	}
+
+	roles, err := bot.store.TierRoles(context.Background(), i.GuildID)
+	if err != nil {
+		log.Error(err)
+		return "I couldn't get the tier roles, try again later."
+	}
+	index := slices.IndexFunc(roles, func(role storage.TierRole) bool { return role.MaxTime == t.maxTime })
+	if index < 0 {
+		return fmt.Sprintf("This server has no role for %s seeds, an admin can set one with /config tier.", t.name)
+	}
+	roleID := roles[index].RoleID
+
+	if slices.Contains(i.Member.Roles, roleID) {
+		if err := s.GuildMemberRoleRemove(i.GuildID, i.Member.User.ID, roleID); err != nil {
+			log.Errorf("Failed to remove tier role %s: %v", roleID, err)
+			return "I couldn't take the role away, I might be missing the Manage Roles permission."
+		}
+		return fmt.Sprintf("You won't get pinged with <@&%s> anymore.", roleID)
+	}
+
+	if err := s.GuildMemberRoleAdd(i.GuildID, i.Member.User.ID, roleID); err != nil {
+		log.Errorf("Failed to add tier role %s: %v", roleID, err)
+		return "I couldn't give you the role, I might be missing the Manage Roles permission."
+	}
+	return fmt.Sprintf("You'll get pinged with <@&%s> for %s seeds, run this again to stop.", roleID, t.name)
+}
+
+func (bot *Bot) parseSubscription(userID string, options []*discordgo.ApplicationCommandInteractionDataOption) (storage.Subscription, error) {
+	sub := storage.Subscription{UserID: userID, MaxTime: bot.threshold}
+
+	for _, option := range options {
+		var err error
+		switch option.Name {
+		case "max_time":
+			var d time.Duration
+			d, err = calc.ParseTimeLeft(option.StringValue())
+			if err != nil || d <= 0 {
+				return storage.Subscription{}, fmt.Errorf("\"%s\" isn't a time like 2:05 or 125", option.StringValue())
+			}
+			sub.MaxTime = d.Seconds()
+		case "rooms":
+			sub.Rooms, err = parseRoomList(option.StringValue())
+		case "exclude_rooms":
+			sub.ExcludedRooms, err = parseRoomList(option.StringValue())
+		case "lobby":
+			sub.Lobby = strings.TrimSpace(option.StringValue())
+		case "igns":
+			sub.Igns = splitList(option.StringValue())
+		case "quiet_hours":
+			sub.QuietStart, sub.QuietEnd, err = parseQuietHours(option.StringValue())
+		case "utc_offset":
+			sub.UTCOffset = int(math.Round(option.FloatValue() * 60))
+		}
+		if err != nil {
+			return storage.Subscription{}, err
+		}
+	}
+
+	for _, room := range sub.Rooms {
+		if slices.Contains(sub.ExcludedRooms, room) {
+			return storage.Subscription{}, fmt.Errorf("%s can't be both required and excluded", room)
+		}
+	}
+
+	return sub, nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseRoomList resolves rooms separated by commas like /calc does, misspelled names are corrected
+func parseRoomList(v string) ([]string, error) {
+	var rooms []string
+	for _, name := range splitList(v) {
+		name = strings.ToLower(name)
+		if key, ok := calc.RoomBySlug(name); ok {
+			name = key
+		}
+
+		if !slices.Contains(roomOptions, name) {
+			bestMatch, score := fuzzyMatch(name, roomOptions)
+			if score < 0.6 {
+				return nil, fmt.Errorf("I don't know a room called \"%s\". Did you mean \"%s\"?", name, bestMatch)
+			}
+			name = bestMatch
+		}
+
+		if !slices.Contains(rooms, name) {
+			rooms = append(rooms, name)
+		}
+	}
+	return rooms, nil
+}
+
+// parseQuietHours reads e.g. 23:00-07:00 or 23-7 into minutes of the day
+func parseQuietHours(v string) (int, int, error) {
+	from, to, found := strings.Cut(v, "-")
+	if !found {
+		return 0, 0, fmt.Errorf("\"%s\" aren't quiet hours like 23:00-07:00", v)
+	}
+
+	parse := func(clock string) (int, error) {
+		hours, minutes, _ := strings.Cut(strings.TrimSpace(clock), ":")
+		h, err := strconv.Atoi(hours)
+		if err != nil || h < 0 || h > 24 {
+			return 0, fmt.Errorf("\"%s\" aren't quiet hours like 23:00-07:00", v)
+		}
+		m := 0
+		if minutes != "" {
+			m, err = strconv.Atoi(minutes)
+			if err != nil || m < 0 || m > 59 {
+				return 0, fmt.Errorf("\"%s\" aren't quiet hours like 23:00-07:00", v)
+			}
+		}
+		return (h*60 + m) % (24 * 60), nil
+	}
+
+	start, err := parse(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parse(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func describeSubscription(sub storage.Subscription) string {
+	var b strings.Builder
+
+	if sub.MaxTime > 0 {
+		fmt.Fprintf(&b, "seeds under **%s**", calc.FormatTime(sub.MaxTime))
+	} else {
+		b.WriteString("every seed")
+	}
+	if sub.Lobby != "" {
+		fmt.Fprintf(&b, " in %s", sub.Lobby)
+	}
+	if len(sub.Igns) > 0 {
+		fmt.Fprintf(&b, " found by %s", strings.Join(sub.Igns, ", "))
+	}
+	if len(sub.Rooms) > 0 {
+		fmt.Fprintf(&b, " with %s", strings.Join(sub.Rooms, ", "))
+	}
+	if len(sub.ExcludedRooms) > 0 {
+		fmt.Fprintf(&b, " without %s", strings.Join(sub.ExcludedRooms, ", "))
+	}
+	b.WriteString(".")
+
+	if sub.QuietStart != sub.QuietEnd {
+		offset := time.Duration(sub.UTCOffset) * time.Minute
+		fmt.Fprintf(&b, " Not between %s and %s (UTC%+g).", formatClock(sub.QuietStart), formatClock(sub.QuietEnd), offset.Hours())
+	}
+
+	return b.String()
+}
+
+func subscriptionMatches(sub storage.Subscription, e events.SeedSubmitted) bool {
+	// like the announcements and the tier roles, a seed has to be under the time
+	if sub.MaxTime > 0 && e.Result.BoostTime >= sub.MaxTime {
+		return false
+	}
+
+	if sub.Lobby != "" && !strings.EqualFold(sub.Lobby, e.Lobby) {
+		return false
+	}
+
+	if len(sub.Igns) > 0 && !slices.ContainsFunc(sub.Igns, func(ign string) bool { return strings.EqualFold(ign, e.Ign) }) {
+		return false
+	}
+
+	for _, room := range sub.Rooms {
+		if !slices.Contains(e.Rooms, room) {
+			return false
+		}
+	}
+	for _, room := range sub.ExcludedRooms {
+		if slices.Contains(e.Rooms, room) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inQuietHours is whether it's in the subscriber's quiet hours at now, the hours can go over midnight
+func inQuietHours(sub storage.Subscription, now time.Time) bool {
+	if sub.QuietStart == sub.QuietEnd {
+		return false
+	}
+
+	local := now.UTC().Add(time.Duration(sub.UTCOffset) * time.Minute)
+	minute := local.Hour()*60 + local.Minute()
+	if sub.QuietStart < sub.QuietEnd {
+		return minute >= sub.QuietStart && minute < sub.QuietEnd
+	}
+	return minute >= sub.QuietStart || minute < sub.QuietEnd
+}
+
+// subscriptions are the subscriptions of every user, the caller mustn't change them
+func (bot *Bot) subscriptions() ([]storage.Subscription, error) {
+	bot.subscriptionsMu.Lock()
+	defer bot.subscriptionsMu.Unlock()
+
+	if !bot.subscriptionsLoaded {
+		subs, err := bot.store.ListSubscriptions(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		bot.cachedSubscriptions, bot.subscriptionsLoaded = subs, true
+	}
+	return bot.cachedSubscriptions, nil
+}
+
+// forgetSubscriptions has them loaded again with the next announcement
+func (bot *Bot) forgetSubscriptions() {
+	bot.subscriptionsMu.Lock()
+	defer bot.subscriptionsMu.Unlock()
+
+	bot.cachedSubscriptions, bot.subscriptionsLoaded = nil, false
+}
+
+// notifySubscribers DMs the users whose subscriptions match an announced seed, outside of their quiet hours
+func (bot *Bot) notifySubscribers(e events.SeedSubmitted) {
+	if e.Debug {
+		return
+	}
+
+	subs, err := bot.subscriptions()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	now := time.Now()
+	// the same seed in another lobby is another chance to play it
+	seedKey := strings.ToLower(e.Lobby) + "|" + strings.Join(e.Rooms, "|")
+	for _, sub := range subs {
+		if !subscriptionMatches(sub, e) || inQuietHours(sub, now) {
+			continue
+		}
+
+		if !notifiedSeeds.MarkNew(sub.UserID + "|" + seedKey) {
+			continue
+		}
+
+		if ok, _ := dmLimit.Allow(sub.UserID, now); !ok {
+			log.Debugf("Not DMing %s about a seed, they got too many", sub.UserID)
+			continue
+		}
+
+		bot.sendSubscriptionDM(sub.UserID, e)
+	}
+}
+
+func (bot *Bot) sendSubscriptionDM(userID string, e events.SeedSubmitted) {
+	channel, err := bot.s.UserChannelCreate(userID)
+	if err != nil {
+		log.Errorf("Failed to open the DMs of %s: %v", userID, err)
+		return
+	}
+
+	content := fmt.Sprintf("**%s** has found a **%s** seed, %s requeues in %s\n%s\n```%s```",
+		e.Ign, calc.FormatTime(e.Result.BoostTime), e.Lobby, e.TimeLeft, strings.Join(e.Rooms, ", "), createCalcCommand(e.Rooms))
+	if _, err := bot.s.ChannelMessageSend(channel.ID, content); err != nil {
+		// most likely their DMs are closed, there's nothing to do about that
+		log.Infof("Failed to DM %s about a seed: %v", userID, err)
+		return
+	}
+	metrics.Announcements.WithLabelValues("dm").Inc()
+}
+
+// tierPings are the tier roles of a guild to ping for a seed, the ones pinged too often lately are left out
+func (bot *Bot) tierPings(guildID string, e events.SeedSubmitted) []string {
+	roles, err := bot.store.TierRoles(context.Background(), guildID)
+	if err != nil {
+		log.Warn(err)
+		return nil
+	}
+
+	var roleIDs []string
+	now := time.Now()
+	for _, role := range roles {
+		if e.Result.BoostTime >= role.MaxTime {
+			continue
+		}
+		if ok, _ := tierPingLimit.Allow(guildID+"|"+role.RoleID, now); !ok {
+			log.Infof("Not pinging tier role %s in guild %s, it was pinged too often", role.RoleID, guildID)
+			continue
+		}
+		roleIDs = append(roleIDs, role.RoleID)
+	}
+	return roleIDs
+}
@@ -0,0 +1,239 @@
+package discord_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/discord"
+	"pkd-bot/discord/discordtest"
+	"pkd-bot/storage"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSubscribeHandler(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+	ctx := context.Background()
+
+	discord.SubscribeHandler(fake, commandInteraction("subscribe", "subscribe dm", member, subcommand("dm",
+		option("max_time", discordgo.ApplicationCommandOptionString, "2:05"),
+		option("rooms", discordgo.ApplicationCommandOptionString, "blocks, fortres"),
+		option("exclude_rooms", discordgo.ApplicationCommandOptionString, "sandpit"),
+		option("quiet_hours", discordgo.ApplicationCommandOptionString, "23:00-07:00"),
+		option("utc_offset", discordgo.ApplicationCommandOptionNumber, -5.0),
+	)))
+	if got := lastResponse(t, fake); !strings.Contains(got, "Subscribed") || !strings.Contains(got, "fortress") {
+		t.Errorf("got %q, want the subscription with the room corrected", got)
+	}
+
+	sub, err := discord.Storage().GetSubscription(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.MaxTime != 125 || len(sub.Rooms) != 2 || sub.Rooms[1] != "fortress" || sub.ExcludedRooms[0] != "sandpit" ||
+		sub.QuietStart != 23*60 || sub.QuietEnd != 7*60 || sub.UTCOffset != -300 {
+		t.Errorf("got %+v, want every option", sub)
+	}
+
+	discord.SubscribeHandler(fake, commandInteraction("subscribe", "subscribe show", member, subcommand("show")))
+	if got := lastResponse(t, fake); !strings.Contains(got, "2:05") || !strings.Contains(got, "23:00") {
+		t.Errorf("got %q, want the subscription", got)
+	}
+
+	discord.SubscribeHandler(fake, commandInteraction("subscribe", "subscribe stop", member, subcommand("stop")))
+	if _, err := discord.Storage().GetSubscription(ctx, "user"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("got %v, want the subscription gone", err)
+	}
+}
+
+func TestSubscribeHandlerRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		option *discordgo.ApplicationCommandInteractionDataOption
+	}{
+		{name: "time", option: option("max_time", discordgo.ApplicationCommandOptionString, "soon")},
+		{name: "room", option: option("rooms", discordgo.ApplicationCommandOptionString, "kitchen")},
+		{name: "quiet hours", option: option("quiet_hours", discordgo.ApplicationCommandOptionString, "night")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := discordtest.NewSession(t)
+			discord.UseFakes(t, fake)
+
+			discord.SubscribeHandler(fake, commandInteraction("subscribe", "subscribe dm", member, subcommand("dm", tt.option)))
+
+			if got := lastResponse(t, fake); strings.Contains(got, "Subscribed") {
+				t.Errorf("got %q, want the option rejected", got)
+			}
+			if _, err := discord.Storage().GetSubscription(context.Background(), "user"); !errors.Is(err, storage.ErrNotFound) {
+				t.Errorf("got %v, want nothing saved", err)
+			}
+		})
+	}
+}
+
+func TestSubscribeHandlerTogglesTierRole(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+
+	discord.SubscribeHandler(fake, commandInteraction("subscribe", "subscribe role", member, subcommand("role", option("tier", discordgo.ApplicationCommandOptionString, "sub-2:05"))))
+	if got := lastResponse(t, fake); !strings.Contains(got, "/config tier") {
+		t.Errorf("got %q, want to be told there's no role", got)
+	}
+
+	discord.ConfigHandler(fake, commandInteraction("config", "config tier", admin, subcommand("tier",
+		option("tier", discordgo.ApplicationCommandOptionString, "sub-2:05"),
+		option("role", discordgo.ApplicationCommandOptionRole, "fast"),
+	)))
+	discord.SubscribeHandler(fake, commandInteraction("subscribe", "subscribe role", member, subcommand("role", option("tier", discordgo.ApplicationCommandOptionString, "sub-2:05"))))
+	if roles := fake.MemberRoles("guild", "user"); len(roles) != 1 || roles[0] != "fast" {
+		t.Fatalf("got roles %v, want the tier role", roles)
+	}
+
+	withRole := *member
+	withRole.Roles = []string{"fast"}
+	discord.SubscribeHandler(fake, commandInteraction("subscribe", "subscribe role", &withRole, subcommand("role", option("tier", discordgo.ApplicationCommandOptionString, "sub-2:05"))))
+	if roles := fake.MemberRoles("guild", "user"); len(roles) != 0 {
+		t.Errorf("got roles %v, want the tier role taken away", roles)
+	}
+}
+
+func TestNotifySubscribers(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.CloseDMs("closed")
+	discord.UseFakes(t, fake)
+	ctx := context.Background()
+
+	e := seedSubmitted(t)
+	e.Result.BoostTime = 124
+	subs := []storage.Subscription{
+		{UserID: "fast", MaxTime: 125},
+		{UserID: "faster", MaxTime: 120},
+		{UserID: "exact", MaxTime: 124},
+		{UserID: "rooms", MaxTime: 130, Rooms: []string{"blocks"}, ExcludedRooms: []string{"sandpit"}},
+		{UserID: "lobby", MaxTime: 130, Lobby: "M1a", Igns: []string{"finder"}},
+		{UserID: "other lobby", MaxTime: 130, Lobby: "m2B"},
+		{UserID: "closed", MaxTime: 130},
+	}
+	for i := range subs {
+		if err := discord.Storage().PutSubscription(ctx, &subs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	discord.NotifySubscribers(e)
+	// the rest of the lobby submitting the seed doesn't DM anyone again
+	discord.NotifySubscribers(e)
+	// but the same seed in another lobby does
+	e.Lobby = "m3C"
+	discord.NotifySubscribers(e)
+
+	for userID, want := range map[string]int{"fast": 2, "faster": 0, "exact": 0, "rooms": 0, "lobby": 1, "other lobby": 0, "closed": 0} {
+		messages := fake.Messages(discordtest.DMChannelID(userID))
+		if len(messages) != want {
+			t.Errorf("%s got %d DMs, want %d", userID, len(messages), want)
+			continue
+		}
+		if want > 0 && !strings.Contains(messages[0].Content, "Finder") {
+			t.Errorf("%s got %q, want the finder", userID, messages[0].Content)
+		}
+	}
+}
+
+func TestNotifySubscribersRateLimit(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	discord.UseFakes(t, fake)
+	discord.Storage().PutSubscription(context.Background(), &storage.Subscription{UserID: "user"})
+
+	e := seedSubmitted(t)
+	for n := 0; n < 4; n++ {
+		e.Rooms = append([]string(nil), testRooms...)
+		e.Rooms[0], e.Rooms[n+1] = e.Rooms[n+1], e.Rooms[0]
+		discord.NotifySubscribers(e)
+	}
+
+	if messages := fake.Messages(discordtest.DMChannelID("user")); len(messages) != 3 {
+		t.Errorf("got %d DMs, want the burst of 3", len(messages))
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	overnight := storage.Subscription{QuietStart: 23 * 60, QuietEnd: 7 * 60, UTCOffset: -5 * 60}
+	daytime := storage.Subscription{QuietStart: 9 * 60, QuietEnd: 17 * 60}
+
+	tests := []struct {
+		sub  storage.Subscription
+		at   string
+		want bool
+	}{
+		{sub: overnight, at: "05:00", want: true},  // midnight in UTC-5
+		{sub: overnight, at: "12:30", want: false}, // 07:30
+		{sub: overnight, at: "04:00", want: true},  // 23:00
+		{sub: daytime, at: "09:00", want: true},
+		{sub: daytime, at: "17:00", want: false},
+		{sub: storage.Subscription{}, at: "12:00", want: false},
+	}
+
+	for _, tt := range tests {
+		at, _ := time.Parse("15:04", tt.at)
+		if got := discord.InQuietHours(tt.sub, at); got != tt.want {
+			t.Errorf("InQuietHours(%d-%d%+d, %s) = %v, want %v", tt.sub.QuietStart, tt.sub.QuietEnd, tt.sub.UTCOffset, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestAnnounceSeedPingsTierRoles(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("guild", "announcements", discord.AnnouncementChannel)
+	discord.UseFakes(t, fake)
+	ctx := context.Background()
+
+	discord.Storage().PutGuildSettings(ctx, &storage.GuildSettings{GuildID: "guild", PingRoleID: "everyone"})
+	discord.Storage().PutTierRole(ctx, storage.TierRole{GuildID: "guild", MaxTime: 125, RoleID: "fast"})
+	discord.Storage().PutTierRole(ctx, storage.TierRole{GuildID: "guild", MaxTime: 130, RoleID: "good"})
+
+	e := seedSubmitted(t)
+	e.Result.BoostTime = 127
+	discord.AnnounceSeed(e)
+
+	messages := fake.Messages("announcements")
+	if len(messages) != 1 {
+		t.Fatalf("got %d announcements, want one", len(messages))
+	}
+	if content := messages[0].Content; !strings.HasPrefix(content, "<@&everyone> <@&good>") || strings.Contains(content, "<@&fast>") {
+		t.Errorf("got %q, want the configured role and the tiers the seed is in pinged", content)
+	}
+}
+
+func TestAnnounceSeedNotifiesSubscribers(t *testing.T) {
+	fake := discordtest.NewSession(t)
+	fake.AddChannel("guild", "announcements", discord.AnnouncementChannel)
+	discord.UseFakes(t, fake)
+
+	discord.Storage().PutSubscription(context.Background(), &storage.Subscription{UserID: "early"})
+
+	// the subscriptions any seed matches are only for the seeds that get announced
+	e := seedSubmitted(t)
+	e.Result.BoostTime = calc.DefaultAnnouncementThreshold
+	discord.AnnounceSeed(e)
+	if messages := fake.Messages(discordtest.DMChannelID("early")); len(messages) != 0 {
+		t.Errorf("got %d DMs, want none about a seed nobody announced", len(messages))
+	}
+
+	// subscribing after the subscriptions were loaded
+	discord.SubscribeHandler(fake, commandInteraction("subscribe", "subscribe dm", member, subcommand("dm")))
+
+	e.Result.BoostTime = calc.DefaultAnnouncementThreshold - 1
+	discord.AnnounceSeed(e)
+	for _, userID := range []string{"early", "user"} {
+		if messages := fake.Messages(discordtest.DMChannelID(userID)); len(messages) != 1 {
+			t.Errorf("%s got %d DMs, want one about the announced seed", userID, len(messages))
+		}
+	}
+}
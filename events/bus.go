@@ -0,0 +1,101 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Bus hands every published event to all of its subscribers.
+// Each subscriber runs in its own goroutine so a slow one (e.g. discord) can't hold up the publisher
+type Bus[T any] struct {
+	mu          sync.RWMutex
+	nextID      int
+	subscribers map[int]func(T)
+
+	// running counts the handlers that haven't returned yet, idle is closed once it drops to 0
+	runningMu sync.Mutex
+	running   int
+	idle      chan struct{}
+}
+
+func NewBus[T any]() *Bus[T] {
+	return &Bus[T]{subscribers: make(map[int]func(T))}
+}
+
+// Subscribe registers handler for every event published from now on, call the returned func to stop receiving them
+func (b *Bus[T]) Subscribe(handler func(T)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// Publish doesn't wait for the subscribers to handle the event
+func (b *Bus[T]) Publish(event T) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.subscribers {
+		b.started()
+		go func(handler func(T)) {
+			defer b.finished()
+			defer func() {
+				if err := recover(); err != nil {
+					log.Errorf("Panic in event subscriber: %v\n", err)
+					log.Errorf("Stack trace: %s\n", debug.Stack())
+				}
+			}()
+			handler(event)
+		}(handler)
+	}
+}
+
+// Drain waits for the handlers that are running to return, unsubscribe first so no new ones start
+func (b *Bus[T]) Drain(ctx context.Context) error {
+	b.runningMu.Lock()
+	if b.running == 0 {
+		b.runningMu.Unlock()
+		return nil
+	}
+	idle := b.idle
+	b.runningMu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("event handlers still running: %w", ctx.Err())
+	}
+}
+
+func (b *Bus[T]) started() {
+	b.runningMu.Lock()
+	defer b.runningMu.Unlock()
+
+	if b.running == 0 {
+		b.idle = make(chan struct{})
+	}
+	b.running++
+}
+
+func (b *Bus[T]) finished() {
+	b.runningMu.Lock()
+	defer b.runningMu.Unlock()
+
+	b.running--
+	if b.running == 0 {
+		close(b.idle)
+	}
+}
@@ -0,0 +1,88 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pkd-bot/events"
+)
+
+func TestBus(t *testing.T) {
+	bus := events.NewBus[int]()
+
+	first := make(chan int, 1)
+	second := make(chan int, 1)
+	bus.Subscribe(func(e int) { first <- e })
+	unsubscribe := bus.Subscribe(func(e int) { second <- e })
+
+	bus.Publish(1)
+	for _, ch := range []chan int{first, second} {
+		select {
+		case e := <-ch:
+			if e != 1 {
+				t.Errorf("got event %d, want 1", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("subscriber didn't receive the event")
+		}
+	}
+
+	unsubscribe()
+	bus.Publish(2)
+	if e := <-first; e != 2 {
+		t.Errorf("got event %d, want 2", e)
+	}
+
+	select {
+	case e := <-second:
+		t.Errorf("unsubscribed handler received event %d", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBusRecoversPanics(t *testing.T) {
+	bus := events.NewBus[int]()
+
+	done := make(chan struct{})
+	bus.Subscribe(func(int) { panic("boom") })
+	bus.Subscribe(func(int) { close(done) })
+
+	bus.Publish(1)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a panicking subscriber kept the others from running")
+	}
+}
+
+func TestBusDrain(t *testing.T) {
+	bus := events.NewBus[int]()
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	unsubscribe := bus.Subscribe(func(int) {
+		<-release
+		close(done)
+	})
+
+	bus.Publish(1)
+	unsubscribe()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := bus.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("drained while a handler was running: %v", err)
+	}
+
+	close(release)
+	if err := bus.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	default:
+		t.Error("drained before the handler returned")
+	}
+}
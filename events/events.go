@@ -0,0 +1,45 @@
+package events
+
+import (
+	"time"
+
+	"pkd-bot/calc"
+)
+
+// SeedSubmitted is published for every seed ChatTriggers sends to the api
+type SeedSubmitted struct {
+	Ign      string
+	Lobby    string
+	TimeLeft string
+	// Rooms are the 8 lowercased room keys, without the finish room
+	Rooms  []string
+	Result calc.CalcSeedResult
+	// Advice is nil when the advisor couldn't be consulted
+	Advice *calc.Advice
+	// Debug submissions are calced like any other, but shouldn't be announced
+	Debug bool
+	At    time.Time
+}
+
+var SeedSubmissions = NewBus[SeedSubmitted]()
+
+// Announceable is whether the seed is under the threshold seeds are announced under, announcers still have to skip
+// seeds they've already announced
+func (e SeedSubmitted) Announceable(threshold float64) bool {
+	return !e.Debug && e.Result.BoostTime < threshold
+}
+
+// SubmissionRejected is published when a ChatTriggers submission fails authentication or is rate limited
+type SubmissionRejected struct {
+	KeyID string
+	// Owner is empty when the key isn't known
+	Owner string
+	// Ign is empty unless the submission was signed with the key
+	Ign    string
+	Reason string
+	// RemoteAddr is the address without the port
+	RemoteAddr string
+	At         time.Time
+}
+
+var SubmissionRejections = NewBus[SubmissionRejected]()
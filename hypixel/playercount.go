@@ -4,12 +4,45 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"sync"
+	"time"
+
+	"pkd-bot/metrics"
 
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+const baseURL = "https://api.hypixel.net/v2"
+
+const (
+	playerCountTTL = time.Minute
+	// playerCountBackoff is how long a failed fetch is kept, so hypixel being down doesn't make every caller ask again
+	playerCountBackoff = 10 * time.Second
 )
 
-var baseURL = "https://api.hypixel.net/v2"
+// Client asks the hypixel api with an api key, and keeps the player count for a while
+type Client struct {
+	apiKey string
+	// http gives up on hypixel before the requests waiting for it do
+	http *http.Client
+
+	playerCountFetches singleflight.Group
+
+	playerCountMu      sync.Mutex
+	cachedPlayerCount  int
+	hasPlayerCount     bool
+	playerCountErr     error
+	playerCountFetched time.Time
+}
+
+// NewClient makes a client sending apiKey with every request
+func NewClient(apiKey string) *Client {
+	return &Client{
+		apiKey: apiKey,
+		http:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
 
 type countGame struct {
 	Players int            `json:"players"`
@@ -22,15 +55,18 @@ type getCountBody struct {
 	Games       map[string]countGame `json:"games"`
 }
 
-func GetPlayerCount() (int, error) {
+// PlayerCount asks hypixel how many are playing PKD
+func (c *Client) PlayerCount() (count int, err error) {
+	defer func() { metrics.ObserveHypixelRequest("counts", err) }()
+
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", baseURL, "counts"), nil)
 	if err != nil {
 		log.Error(err)
 		return 0, err
 	}
 
-	req.Header.Add("API-Key", os.Getenv("HYPIXEL_API_KEY"))
-	resp, err := http.DefaultClient.Do(req)
+	req.Header.Add("API-Key", c.apiKey)
+	resp, err := c.http.Do(req)
 	if err != nil {
 		log.Error(err)
 		return 0, err
@@ -55,3 +91,49 @@ func GetPlayerCount() (int, error) {
 	log.Error(err)
 	return 0, err
 }
+
+// CachedPlayerCount is PlayerCount, but it only asks hypixel once a minute and once at a time.
+// While hypixel fails, it's the last count it sent
+func (c *Client) CachedPlayerCount() (int, error) {
+	if count, fresh, err := c.cachedCount(); fresh {
+		return count, err
+	}
+
+	// the callers that come while hypixel is asked wait for its answer
+	c.playerCountFetches.Do("counts", func() (any, error) {
+		count, err := c.PlayerCount()
+
+		c.playerCountMu.Lock()
+		defer c.playerCountMu.Unlock()
+
+		c.playerCountFetched, c.playerCountErr = time.Now(), err
+		if err == nil {
+			c.cachedPlayerCount, c.hasPlayerCount = count, true
+		}
+		return nil, nil
+	})
+
+	count, _, err := c.cachedCount()
+	return count, err
+}
+
+// cachedCount is the last count, or the error of the last fetch if there never was one
+func (c *Client) cachedCount() (count int, fresh bool, err error) {
+	c.playerCountMu.Lock()
+	defer c.playerCountMu.Unlock()
+
+	ttl := playerCountTTL
+	if c.playerCountErr != nil {
+		ttl = playerCountBackoff
+	}
+	fresh = !c.playerCountFetched.IsZero() && time.Since(c.playerCountFetched) < ttl
+
+	if !c.hasPlayerCount {
+		err = c.playerCountErr
+		if err == nil {
+			err = fmt.Errorf("the player count hasn't been fetched yet")
+		}
+		return 0, fresh, err
+	}
+	return c.cachedPlayerCount, fresh, nil
+}
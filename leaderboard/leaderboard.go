@@ -0,0 +1,166 @@
+package leaderboard
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/storage"
+)
+
+// Window is the time a leaderboard ranks the seeds of
+type Window string
+
+const (
+	Week   Window = "week"
+	Month  Window = "month"
+	Season Window = "season"
+)
+
+var Windows = []Window{Week, Month, Season}
+
+// Metric is what a leaderboard ranks the finders by
+type Metric string
+
+const (
+	// Announced is how many of the seeds found the bot announced
+	Announced Metric = "announced"
+	// Best is the fastest seed found
+	Best Metric = "best"
+	// AverageTime is the average boost time of the seeds found, it says nothing else about how good they were
+	AverageTime Metric = "average_time"
+)
+
+var Metrics = []Metric{Announced, Best, AverageTime}
+
+// MinSeedsForAverage keeps players with a lucky seed or two off the average leaderboard
+const MinSeedsForAverage = 5
+
+// ParseWindow is Week for ""
+func ParseWindow(v string) (Window, error) {
+	if v == "" {
+		return Week, nil
+	}
+	w := Window(strings.ToLower(v))
+	if !slices.Contains(Windows, w) {
+		return "", fmt.Errorf("\"%s\" isn't a window, it's week, month or season", v)
+	}
+	return w, nil
+}
+
+// ParseMetric is Announced for ""
+func ParseMetric(v string) (Metric, error) {
+	if v == "" {
+		return Announced, nil
+	}
+	m := Metric(strings.ToLower(v))
+	if !slices.Contains(Metrics, m) {
+		return "", fmt.Errorf("\"%s\" isn't a leaderboard, it's announced, best or average_time", v)
+	}
+	return m, nil
+}
+
+// Range is the window now is in. Weeks start on monday and seasons are the quarters of the year, all in UTC
+func (w Window) Range(now time.Time) (since, until time.Time) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch w {
+	case Month:
+		since = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return since, since.AddDate(0, 1, 0)
+	case Season:
+		since = time.Date(now.Year(), (now.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+		return since, since.AddDate(0, 3, 0)
+	default:
+		since = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return since, since.AddDate(0, 0, 7)
+	}
+}
+
+// Title names the window that starts at since
+func (w Window) Title(since time.Time) string {
+	switch w {
+	case Month:
+		return since.Format("January 2006")
+	case Season:
+		return fmt.Sprintf("Season %d of %d", (since.Month()-1)/3+1, since.Year())
+	default:
+		return "Week of " + since.Format("Jan 2 2006")
+	}
+}
+
+// Entry is a player's place on a leaderboard, players with the same value share their rank
+type Entry struct {
+	Rank int
+	storage.FinderStats
+}
+
+type Board struct {
+	Window  Window
+	Metric  Metric
+	Since   time.Time
+	Until   time.Time
+	Entries []Entry
+}
+
+func (b Board) Title() string {
+	titles := map[Metric]string{Announced: "Most seeds announced", Best: "Best seeds", AverageTime: "Fastest average boost time"}
+	return fmt.Sprintf("%s, %s", titles[b.Metric], b.Window.Title(b.Since))
+}
+
+// Value is what e is ranked by, the way the leaderboard shows it
+func (b Board) Value(e Entry) string {
+	switch b.Metric {
+	case Best:
+		return calc.FormatTime(e.BestTime)
+	case AverageTime:
+		return fmt.Sprintf("%s in %d seeds", calc.FormatTime(e.AverageTime), e.Seeds)
+	default:
+		return fmt.Sprintf("%d of %d seeds", e.Announced, e.Seeds)
+	}
+}
+
+// Build ranks the finders of the seeds found in the window now is in by metric, the first limit of them.
+// A seed counts for the first player who submitted it from its lobby
+func Build(ctx context.Context, repo storage.SubmissionRepository, window Window, metric Metric, now time.Time, limit int) (Board, error) {
+	board := Board{Window: window, Metric: metric}
+	board.Since, board.Until = window.Range(now)
+
+	filter := storage.SubmissionFilter{Since: board.Since, Until: board.Until, NoDebug: true, FirstPerLobby: true}
+	stats, err := repo.FinderStats(ctx, filter)
+	if err != nil {
+		return Board{}, err
+	}
+
+	stats = slices.DeleteFunc(stats, func(st storage.FinderStats) bool {
+		return metric == Announced && st.Announced == 0 || metric == AverageTime && st.Seeds < MinSeedsForAverage
+	})
+	// compare is what the rank is by, ties are broken by how many seeds were found
+	compare := func(a, b storage.FinderStats) int {
+		switch metric {
+		case Best:
+			return cmp.Compare(a.BestTime, b.BestTime)
+		case AverageTime:
+			return cmp.Compare(a.AverageTime, b.AverageTime)
+		default:
+			return cmp.Compare(b.Announced, a.Announced)
+		}
+	}
+	slices.SortStableFunc(stats, func(a, b storage.FinderStats) int {
+		return cmp.Or(compare(a, b), cmp.Compare(b.Seeds, a.Seeds))
+	})
+
+	for i, st := range stats[:min(limit, len(stats))] {
+		rank := i + 1
+		if i > 0 && compare(stats[i-1], st) == 0 {
+			rank = board.Entries[i-1].Rank
+		}
+		board.Entries = append(board.Entries, Entry{Rank: rank, FinderStats: st})
+	}
+	return board, nil
+}
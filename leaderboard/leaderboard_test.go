@@ -0,0 +1,116 @@
+package leaderboard_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/leaderboard"
+	"pkd-bot/storage"
+)
+
+var testRooms = []string{"around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"}
+
+func TestRange(t *testing.T) {
+	// a wednesday
+	now := time.Date(2026, time.August, 19, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		window leaderboard.Window
+		since  time.Time
+		until  time.Time
+		title  string
+	}{
+		{leaderboard.Week, time.Date(2026, time.August, 17, 0, 0, 0, 0, time.UTC), time.Date(2026, time.August, 24, 0, 0, 0, 0, time.UTC), "Week of Aug 17 2026"},
+		{leaderboard.Month, time.Date(2026, time.August, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC), "August 2026"},
+		{leaderboard.Season, time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC), "Season 3 of 2026"},
+	}
+	for _, tt := range tests {
+		since, until := tt.window.Range(now)
+		if !since.Equal(tt.since) || !until.Equal(tt.until) {
+			t.Errorf("%s: got %v to %v, want %v to %v", tt.window, since, until, tt.since, tt.until)
+		}
+		if title := tt.window.Title(since); title != tt.title {
+			t.Errorf("%s: got %q, want %q", tt.window, title, tt.title)
+		}
+	}
+
+	// sunday is still the week before
+	if since, _ := leaderboard.Week.Range(time.Date(2026, time.August, 23, 23, 0, 0, 0, time.UTC)); since.Day() != 17 {
+		t.Errorf("got the week of %v, want the one of the 17th", since)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := storage.NewMemoryStore()
+
+	add := func(ign, lobby string, boostTime float64, at time.Time) {
+		t.Helper()
+		sub := &storage.Submission{Ign: ign, Lobby: lobby, Rooms: testRooms, BoostTime: boostTime, At: at}
+		if err := store.AddSubmission(ctx, sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+	announce := func(lobby string) {
+		t.Helper()
+		a := &storage.Announcement{GuildID: "guild", Lobby: lobby, Rooms: testRooms, At: now}
+		if err := store.AddAnnouncement(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fast := calc.DefaultAnnouncementThreshold - 10
+	add("Lucky", "m1A", fast-5, now)
+	for i, lobby := range []string{"m2A", "m2B", "m2C", "m2D", "m2E"} {
+		add("Steady", lobby, fast+float64(i), now)
+	}
+	add("Other", "m3A", fast, now)
+	// the seed in m2E wasn't announced, e.g. discord was down
+	for _, lobby := range []string{"m1A", "m2A", "m2B", "m2C", "m2D", "m3A"} {
+		announce(lobby)
+	}
+	// the rest of the lobby and a seed from long ago don't count
+	add("Lobby", "m1A", fast-5, now.Add(time.Second))
+	add("Old", "m4A", 10, now.AddDate(-1, 0, 0))
+
+	board, err := leaderboard.Build(ctx, store, leaderboard.Week, leaderboard.Announced, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(board.Entries) != 3 || board.Entries[0].Ign != "Steady" || board.Entries[0].Announced != 4 {
+		t.Fatalf("got %+v, want the most seeds announced first", board.Entries)
+	}
+	if board.Entries[1].Rank != 2 || board.Entries[2].Rank != 2 {
+		t.Errorf("got %+v, want the players with a seed each to share their rank", board.Entries)
+	}
+
+	board, err = leaderboard.Build(ctx, store, leaderboard.Week, leaderboard.Best, now, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(board.Entries) != 2 || board.Entries[0].Ign != "Lucky" || board.Value(board.Entries[0]) != calc.FormatTime(fast-5) {
+		t.Errorf("got %+v, want the 2 best seeds", board.Entries)
+	}
+
+	board, err = leaderboard.Build(ctx, store, leaderboard.Season, leaderboard.AverageTime, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(board.Entries) != 1 || board.Entries[0].Ign != "Steady" {
+		t.Errorf("got %+v, want only the players with enough seeds for an average", board.Entries)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if w, err := leaderboard.ParseWindow(""); err != nil || w != leaderboard.Week {
+		t.Errorf("got %q, %v, want the week by default", w, err)
+	}
+	if m, err := leaderboard.ParseMetric("Best"); err != nil || m != leaderboard.Best {
+		t.Errorf("got %q, %v, want best", m, err)
+	}
+	if _, err := leaderboard.ParseWindow("decade"); err == nil {
+		t.Error("want an error for an unknown window")
+	}
+}
@@ -0,0 +1,80 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Component is a part of the app Run starts and stops
+type Component struct {
+	Name string
+	// Start brings the component up and returns, it shouldn't block
+	Start func() error
+	// Stop has to give up when ctx is done
+	Stop func(ctx context.Context) error
+	// Failed, if set, delivers an error when the component stops working on its own after starting
+	Failed <-chan error
+	// Optional components that fail to start are left out instead of stopping the app
+	Optional bool
+}
+
+// Run starts the components in order, then waits for ctx to be done or a component to fail.
+// The components that started are then stopped in reverse order, all within timeout
+func Run(ctx context.Context, timeout time.Duration, components ...Component) error {
+	started := make([]Component, 0, len(components))
+	failed := make(chan error, len(components))
+
+	var runErr error
+	for _, c := range components {
+		if err := c.Start(); err != nil {
+			if c.Optional {
+				log.Errorf("%s didn't start, running without it: %v", c.Name, err)
+				continue
+			}
+
+			runErr = fmt.Errorf("%s didn't start: %w", c.Name, err)
+			break
+		}
+
+		log.Infof("Started %s", c.Name)
+		started = append(started, c)
+
+		if c.Failed != nil {
+			go func(c Component) {
+				if err, ok := <-c.Failed; ok && err != nil {
+					failed <- fmt.Errorf("%s stopped: %w", c.Name, err)
+				}
+			}(c)
+		}
+	}
+
+	if runErr == nil {
+		select {
+		case <-ctx.Done():
+			log.Info("Shutting down...")
+		case runErr = <-failed:
+			log.Errorf("Shutting down: %v", runErr)
+		}
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopErrs := []error{runErr}
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+		start := time.Now()
+		if err := c.Stop(stopCtx); err != nil {
+			log.Errorf("Failed to stop %s: %v", c.Name, err)
+			stopErrs = append(stopErrs, fmt.Errorf("stopping %s: %w", c.Name, err))
+			continue
+		}
+		log.Infof("Stopped %s in %v", c.Name, time.Since(start))
+	}
+
+	return errors.Join(stopErrs...)
+}
@@ -0,0 +1,99 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"pkd-bot/lifecycle"
+)
+
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) component(name string, startErr error) lifecycle.Component {
+	return lifecycle.Component{
+		Name: name,
+		Start: func() error {
+			r.calls = append(r.calls, "start "+name)
+			return startErr
+		},
+		Stop: func(ctx context.Context) error {
+			r.calls = append(r.calls, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func TestRunStopsInReverse(t *testing.T) {
+	var r recorder
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	optional := r.component("optional", errors.New("no token"))
+	optional.Optional = true
+
+	err := lifecycle.Run(ctx, time.Second, r.component("a", nil), optional, r.component("b", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"start a", "start optional", "start b", "stop b", "stop a"}
+	if !slices.Equal(r.calls, want) {
+		t.Errorf("got %v, want %v", r.calls, want)
+	}
+}
+
+func TestRunStartFailure(t *testing.T) {
+	var r recorder
+
+	err := lifecycle.Run(context.Background(), time.Second, r.component("a", nil), r.component("b", errors.New("port taken")), r.component("c", nil))
+	if err == nil {
+		t.Fatal("expected the start error")
+	}
+
+	want := []string{"start a", "start b", "stop a"}
+	if !slices.Equal(r.calls, want) {
+		t.Errorf("got %v, want %v", r.calls, want)
+	}
+}
+
+func TestRunComponentFailure(t *testing.T) {
+	var r recorder
+	failed := make(chan error, 1)
+
+	server := r.component("server", nil)
+	server.Failed = failed
+	failed <- errors.New("listener closed")
+
+	err := lifecycle.Run(context.Background(), time.Second, server)
+	if err == nil || !slices.Equal(r.calls, []string{"start server", "stop server"}) {
+		t.Errorf("got error %v and calls %v", err, r.calls)
+	}
+}
+
+func TestRunStopTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	slow := lifecycle.Component{
+		Name:  "slow",
+		Start: func() error { return nil },
+		Stop: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	start := time.Now()
+	err := lifecycle.Run(ctx, 50*time.Millisecond, slow)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the stop timing out", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("the stop timeout wasn't respected")
+	}
+}
@@ -0,0 +1,159 @@
+package lobbies
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/events"
+)
+
+// unknownDeadlineTTL is how long a lobby whose players didn't send the time left is kept after its last submission
+var unknownDeadlineTTL = 5 * time.Minute
+
+// Lobby is the seed a lobby is on, from what its players submitted
+type Lobby struct {
+	Name  string
+	Rooms []string
+	// Result is the best way to run the seed with the default splits
+	Result  calc.CalcSeedResult
+	Finders []string
+	// Deadline is when the lobby requeues, it's zero if nobody sent the time left
+	Deadline  time.Time
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// TimeLeft is how long until the lobby requeues, it's zero once it has or if the deadline isn't known
+func (l Lobby) TimeLeft(now time.Time) time.Duration {
+	if l.Deadline.IsZero() || !now.Before(l.Deadline) {
+		return 0
+	}
+	return l.Deadline.Sub(now)
+}
+
+func (l Lobby) active(now time.Time) bool {
+	if l.Deadline.IsZero() {
+		return now.Sub(l.LastSeen) < unknownDeadlineTTL
+	}
+	return now.Before(l.Deadline)
+}
+
+// Registry keeps the lobbies players submit seeds from, until they requeue. It's safe for concurrent use
+type Registry struct {
+	mu sync.Mutex
+	// lobbies are by lowercased name, players don't agree on the case
+	lobbies map[string]*Lobby
+}
+
+func NewRegistry() *Registry {
+	return &Registry{lobbies: make(map[string]*Lobby)}
+}
+
+// Current are the lobbies of the seeds ChatTriggers submits, once Track is called
+var Current = NewRegistry()
+
+// Track adds every submitted seed to r until the returned func is called
+func (r *Registry) Track() (unsubscribe func()) {
+	return events.SeedSubmissions.Subscribe(r.Add)
+}
+
+// Add puts the seed of e on its lobby. Another seed in the same lobby means it requeued, the old one is replaced
+func (r *Registry) Add(e events.SeedSubmitted) {
+	if e.Debug || e.Lobby == "" {
+		return
+	}
+
+	at := e.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	var deadline time.Time
+	if left, err := calc.ParseTimeLeft(e.TimeLeft); err == nil && left > 0 {
+		deadline = at.Add(left)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune(at)
+
+	key := strings.ToLower(e.Lobby)
+	l, exists := r.lobbies[key]
+	stale := exists && at.Before(l.LastSeen)
+	if stale && !slices.Equal(l.Rooms, e.Rooms) {
+		// a late submission of the seed the lobby had before, it didn't requeue
+		return
+	}
+	if !exists || !slices.Equal(l.Rooms, e.Rooms) {
+		r.lobbies[key] = &Lobby{
+			Name:      e.Lobby,
+			Rooms:     slices.Clone(e.Rooms),
+			Result:    e.Result,
+			Finders:   []string{e.Ign},
+			Deadline:  deadline,
+			FirstSeen: at,
+			LastSeen:  at,
+		}
+		return
+	}
+
+	if !slices.ContainsFunc(l.Finders, func(finder string) bool { return strings.EqualFold(finder, e.Ign) }) {
+		l.Finders = append(l.Finders, e.Ign)
+	}
+	if stale {
+		return
+	}
+	// the newest time left is the closest to the lobby's
+	if !deadline.IsZero() {
+		l.Deadline = deadline
+	}
+	l.LastSeen = at
+}
+
+// Active lists the lobbies that haven't requeued at now, the best seeds first and the ones with more time left
+// before others of the same time
+func (r *Registry) Active(now time.Time) []Lobby {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune(now)
+
+	active := make([]Lobby, 0, len(r.lobbies))
+	for _, l := range r.lobbies {
+		active = append(active, clone(*l))
+	}
+	slices.SortFunc(active, func(a, b Lobby) int {
+		if c := cmp.Compare(a.Result.BoostTime, b.Result.BoostTime); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.TimeLeft(now), a.TimeLeft(now)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return active
+}
+
+// Joinable are the active lobbies with a seed faster than maxTime, sorted like Active
+func (r *Registry) Joinable(now time.Time, maxTime float64) []Lobby {
+	return slices.DeleteFunc(r.Active(now), func(l Lobby) bool {
+		return l.Result.BoostTime >= maxTime
+	})
+}
+
+// prune has to be called with mu held
+func (r *Registry) prune(now time.Time) {
+	for key, l := range r.lobbies {
+		if !l.active(now) {
+			delete(r.lobbies, key)
+		}
+	}
+}
+
+func clone(l Lobby) Lobby {
+	l.Rooms = slices.Clone(l.Rooms)
+	l.Finders = slices.Clone(l.Finders)
+	return l
+}
@@ -0,0 +1,89 @@
+package lobbies_test
+
+import (
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/events"
+	"pkd-bot/lobbies"
+)
+
+func submission(lobby, ign, timeLeft string, boostTime float64, at time.Time, rooms ...string) events.SeedSubmitted {
+	return events.SeedSubmitted{
+		Ign:      ign,
+		Lobby:    lobby,
+		TimeLeft: timeLeft,
+		Rooms:    rooms,
+		Result:   calc.CalcSeedResult{BoostTime: boostTime},
+		At:       at,
+	}
+}
+
+func names(ls []lobbies.Lobby) []string {
+	var names []string
+	for _, l := range ls {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+func TestRegistry(t *testing.T) {
+	r := lobbies.NewRegistry()
+	now := time.Now()
+
+	r.Add(submission("m1A", "Finder", "2:00", 125, now, "blocks"))
+	r.Add(submission("m1a", "Other", "1:50", 125, now.Add(10*time.Second), "blocks"))
+	r.Add(submission("m2B", "Slow", "2:00", 140, now, "ice"))
+	r.Add(submission("m3C", "Late", "3:00", 125, now, "fences"))
+	r.Add(submission("m4D", "Unknown", "", 120, now, "sandpit"))
+	r.Add(submission("m5E", "Debug", "2:00", 100, now, "ice"))
+	r.Add(events.SeedSubmitted{Ign: "Debug", Lobby: "m6F", TimeLeft: "2:00", Debug: true, At: now})
+
+	active := r.Active(now.Add(time.Minute))
+	if got := names(active); len(got) != 5 || got[0] != "m5E" || got[1] != "m4D" || got[2] != "m3C" || got[3] != "m1A" || got[4] != "m2B" {
+		t.Fatalf("got %v, want the fastest seeds first and the one with more time left first among equals", got)
+	}
+	if l := active[3]; len(l.Finders) != 2 || l.Finders[1] != "Other" || !l.Deadline.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("got %+v, want both finders and the newest deadline", l)
+	}
+
+	if got := names(r.Joinable(now.Add(time.Minute), 130)); len(got) != 4 || got[len(got)-1] != "m1A" {
+		t.Errorf("got %v, want the seeds under 130", got)
+	}
+
+	// the lobby requeued into another seed
+	r.Add(submission("m1A", "Finder", "2:30", 128, now.Add(2*time.Minute), "fortress"))
+	// m1A's new seed, m3C and m4D, whose time left isn't known, are all that's left
+	active = r.Active(now.Add(150 * time.Second))
+	if got := names(active); len(got) != 3 || got[0] != "m4D" || got[1] != "m3C" || got[2] != "m1A" {
+		t.Fatalf("got %v, want the lobbies that haven't requeued", got)
+	}
+	if l := active[2]; l.Rooms[0] != "fortress" || len(l.Finders) != 1 {
+		t.Errorf("got %+v, want the new seed", l)
+	}
+
+	if got := names(r.Active(now.Add(6 * time.Minute))); len(got) != 0 {
+		t.Errorf("got %v, want no lobbies left", got)
+	}
+}
+
+func TestRegistryIgnoresLateSubmissions(t *testing.T) {
+	r := lobbies.NewRegistry()
+	now := time.Now()
+
+	r.Add(submission("m1A", "Finder", "2:00", 128, now, "fortress"))
+	// submitted before the lobby requeued into fortress, but it arrived after
+	r.Add(submission("m1A", "Old", "0:10", 125, now.Add(-time.Minute), "blocks"))
+	// the same seed, sent before the first finder's
+	r.Add(submission("m1A", "Early", "2:10", 128, now.Add(-10*time.Second), "fortress"))
+
+	active := r.Active(now)
+	if len(active) != 1 {
+		t.Fatalf("got %v, want one lobby", names(active))
+	}
+	l := active[0]
+	if l.Rooms[0] != "fortress" || len(l.Finders) != 2 || !l.Deadline.Equal(now.Add(2*time.Minute)) || !l.LastSeen.Equal(now) {
+		t.Errorf("got %+v, want the newest seed with both of its finders and the newest sighting", l)
+	}
+}
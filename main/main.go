@@ -1,20 +1,166 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/config"
 	"pkd-bot/discord"
+	"pkd-bot/events"
+	"pkd-bot/hypixel"
+	"pkd-bot/lifecycle"
+	"pkd-bot/lobbies"
 	"pkd-bot/server"
+	"pkd-bot/storage"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// shutdownTimeout is how long in-flight requests and message edits get before the process exits anyway
+const shutdownTimeout = 15 * time.Second
+
 func main() {
-	go func() {
-		if err := server.StartServer(); err != nil {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if cfg.Debug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	// docker stops containers with SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.SplitsPath != "" {
+		if err := loadSplits(cfg.SplitsPath); err != nil {
 			log.Fatal(err)
 		}
-	}()
+	}
+
+	// strat qualities are derived from the calc itself, this has to happen before anything reads RoomMap
+	start := time.Now()
+	if err := calc.ApplyMoveQualities(calc.RoomMap, calc.DefaultQualitySamples, rand.New(rand.NewSource(calc.QualitySeed))); err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Classified boost strats in %v", time.Since(start))
+
+	// warm up the requeue advisor so the first chattriggers request doesn't pay for the sampling
+	go calc.DefaultDistribution()
 
-	if err := discord.StartDiscordBot(); err != nil {
+	// the database is opened before anything starts, the server and the bot are made with it
+	store, err := storage.Open(ctx, cfg.DatabaseURL)
+	if err != nil {
 		log.Fatal(err)
 	}
+
+	hypixelClient := hypixel.NewClient(cfg.HypixelAPIKey)
+	srv := server.NewServer(server.Config{
+		Port:                  cfg.HTTPPort,
+		APIKeysFile:           cfg.APIKeysFile,
+		AdminToken:            cfg.AdminToken,
+		AnnouncementThreshold: cfg.AnnouncementThreshold,
+		PlayerCount:           hypixelClient.CachedPlayerCount,
+	}, store)
+
+	var bot *discord.Bot
+	var stopRecording, stopTracking func()
+
+	// components stop in reverse, so requests in flight are done before the bot stops announcing what they submit,
+	// and both are done before the database closes
+	err = lifecycle.Run(ctx, shutdownTimeout,
+		lifecycle.Component{
+			Name: "storage",
+			Start: func() error {
+				stopRecording = storage.RecordSubmissions(store)
+				server.RegisterReadinessCheck("storage", func() error {
+					pingCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+					defer cancel()
+					return store.Ping(pingCtx)
+				})
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				stopRecording()
+				// the submissions still being recorded
+				if err := events.SeedSubmissions.Drain(ctx); err != nil {
+					log.Warn(err)
+				}
+				return store.Close()
+			},
+		},
+		lifecycle.Component{
+			Name: "lobby tracker",
+			Start: func() error {
+				stopTracking = lobbies.Current.Track()
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				stopTracking()
+				return nil
+			},
+		},
+		// the api keeps running without discord, seeds just won't be announced
+		lifecycle.Component{
+			Name: "discord bot",
+			Start: func() error {
+				var err error
+				bot, err = discord.New(discord.Config{
+					BotToken:              cfg.BotToken,
+					GuildID:               cfg.GuildID,
+					AnnouncementChannel:   cfg.AnnouncementChannel,
+					ModLogChannel:         cfg.ModLogChannel,
+					AnnouncementThreshold: cfg.AnnouncementThreshold,
+					PlayerCount:           hypixelClient.PlayerCount,
+				}, store)
+				if err != nil {
+					return err
+				}
+				if err := bot.Start(); err != nil {
+					return err
+				}
+				server.RegisterStatusCheck("discord", bot.GatewayStatus)
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				return bot.Stop(ctx)
+			},
+			Optional: true,
+		},
+		lifecycle.Component{
+			Name:   "http server",
+			Start:  srv.Start,
+			Stop:   srv.Stop,
+			Failed: srv.Failed(),
+		},
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadSplits lays the splits of the file over RoomMap, the rooms the file doesn't have keep theirs
+func loadSplits(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open the splits: %w", err)
+	}
+	defer f.Close()
+
+	splits, err := calc.LoadSplits(f)
+	if err != nil {
+		return err
+	}
+	for key, room := range splits {
+		calc.RoomMap[key] = room
+	}
+
+	log.Infof("Loaded the splits of %d rooms from %s", len(splits), path)
+	return nil
 }
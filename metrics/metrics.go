@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "pkd"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "How long HTTP requests took by route template and method, feed streams count for as long as they're open.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	CalcDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "calc_duration_seconds",
+		Help:      "How long calculating every result of a seed took.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 14),
+	})
+
+	CalcCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "calc_cache_requests_total",
+		Help:      "Seed calculations through the result cache, by whether they were a hit or a miss.",
+	}, []string{"result"})
+
+	CalcCacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "calc_cache_evictions_total",
+		Help:      "Seeds dropped from the result cache to make room for new ones.",
+	})
+
+	DiscordInteractions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discord_interactions_total",
+		Help:      "Discord interactions by type (command, button or autocomplete) and command name or button id.",
+	}, []string{"type", "name"})
+
+	Announcements = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "announcements_total",
+		Help:      "Messages the bot posted on its own, by kind (seed or rejection).",
+	}, []string{"kind"})
+
+	MessageStates = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "discord_message_states",
+		Help:      "Messages whose buttons still have a result state.",
+	})
+
+	DiscordGatewayConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "discord_gateway_connected",
+		Help:      "1 while the bot is connected to the discord gateway, 0 otherwise.",
+	})
+
+	HypixelRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hypixel_requests_total",
+		Help:      "Requests to the hypixel api by endpoint and result (ok or error).",
+	}, []string{"endpoint", "result"})
+)
+
+// ObserveCalc records a calc that started at start
+func ObserveCalc(start time.Time) {
+	CalcDuration.Observe(time.Since(start).Seconds())
+}
+
+// ObserveHypixelRequest records a request to the hypixel api that returned err
+func ObserveHypixelRequest(endpoint string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	HypixelRequests.WithLabelValues(endpoint, result).Inc()
+}
@@ -0,0 +1,9 @@
+package ratelimit
+
+// Keys is how many keys have a bucket
+func (l *Limiter) Keys() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.buckets)
+}
@@ -0,0 +1,45 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"pkd-bot/ratelimit"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := ratelimit.New(6, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow("a", now); !ok {
+			t.Fatalf("request %d of the burst was limited", i+1)
+		}
+	}
+
+	ok, retry := limiter.Allow("a", now)
+	if ok || retry != 10*time.Second {
+		t.Errorf("got %v with retry %v, want to be limited for 10s", ok, retry)
+	}
+	if ok, _ := limiter.Allow("b", now); !ok {
+		t.Error("another key was limited")
+	}
+	if ok, _ := limiter.Allow("a", now.Add(10*time.Second)); !ok {
+		t.Error("still limited after the retry time")
+	}
+}
+
+func TestLimiterForgetsFullBuckets(t *testing.T) {
+	limiter := ratelimit.New(6, 1)
+	now := time.Now()
+
+	limiter.Allow("a", now)
+	limiter.Allow("b", now.Add(time.Minute-time.Second))
+	limiter.Allow("c", now.Add(time.Minute))
+	if keys := limiter.Keys(); keys != 2 {
+		t.Errorf("got %d keys, want the one that filled up again dropped", keys)
+	}
+	if ok, _ := limiter.Allow("b", now.Add(time.Minute)); ok {
+		t.Error("a key that's still limited was forgotten")
+	}
+}
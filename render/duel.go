@@ -0,0 +1,172 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"strings"
+
+	"pkd-bot/calc"
+
+	"github.com/fogleman/gg"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	duelFontSize    = 20
+	duelRowHeight   = 36
+	duelRectHeight  = 28
+	duelGapWidth    = 150
+	duelIconPadding = 40
+)
+
+// DuelResults draws both players' plans next to each other, with the gap between them after every room in the middle
+func DuelResults(duel calc.DuelResult, names [2]string, splits [2]map[string]calc.Room) (bytes.Buffer, error) {
+	dc := gg.NewContext(1, 1)
+	if err := loadFontFace(dc, duelFontSize); err != nil {
+		log.Warn(err)
+		return bytes.Buffer{}, err
+	}
+
+	type laneRoom struct {
+		text        string
+		highlight   bool
+		moveQuality calc.MoveQuality
+	}
+
+	lanes := [2][]laneRoom{}
+	laneWidth := 0.0
+	for p, player := range duel.Players {
+		boosts := make(map[int]calc.CalcResultBoost)
+		for _, br := range player.Result.BoostRooms {
+			boosts[br.Ind] = br
+		}
+
+		for i, room := range duel.Rooms {
+			info := splits[p][room]
+			if info.Name == "" {
+				info = calc.RoomMap[room]
+			}
+
+			lr := laneRoom{text: calc.RoomMap[room].Name}
+			if br, isBoost := boosts[i]; isBoost {
+				lr.highlight = true
+				lr.text = fmt.Sprintf("%s (%s)", lr.text, info.BoostStrats[br.StratInd].Name)
+				lr.moveQuality = info.BoostStrats[br.StratInd].Quality
+			}
+
+			w, _ := dc.MeasureString(lr.text)
+			laneWidth = max(laneWidth, w+40)
+			lanes[p] = append(lanes[p], lr)
+		}
+	}
+
+	leadChanges := make(map[int]bool, len(duel.LeadChanges))
+	for _, ind := range duel.LeadChanges {
+		leadChanges[ind] = true
+	}
+
+	var summary string
+	switch duel.Winner {
+	case -1:
+		summary = "It's a tie!"
+	default:
+		summary = fmt.Sprintf("%s wins by %.1fs", names[duel.Winner], duel.Margin)
+	}
+
+	if len(duel.LeadChanges) > 0 {
+		rooms := make([]string, 0, len(duel.LeadChanges))
+		for _, ind := range duel.LeadChanges {
+			rooms = append(rooms, calc.RoomMap[duel.Rooms[ind]].Name)
+		}
+		summary += fmt.Sprintf(", lead changes in %s", strings.Join(rooms, ", "))
+	}
+
+	summaryWidth, _ := dc.MeasureString(summary)
+	width := int(max(2*(laneWidth+duelIconPadding)+duelGapWidth, summaryWidth+40))
+	height := 90 + len(duel.Rooms)*duelRowHeight + 100
+
+	dc = gg.NewContext(width, height)
+	if err := drawBackground(dc, width, height); err != nil {
+		log.Warn(err)
+		return bytes.Buffer{}, err
+	}
+
+	if err := loadFontFace(dc, duelFontSize); err != nil {
+		log.Warn(err)
+		return bytes.Buffer{}, err
+	}
+
+	laneCenters := [2]float64{
+		duelIconPadding + laneWidth/2,
+		float64(width) - duelIconPadding - laneWidth/2,
+	}
+	gapCenter := float64(width) / 2
+
+	y := 40.0
+	dc.SetColor(color.White)
+	for p, name := range names {
+		drawStringAnchored(dc, fmt.Sprintf("%s - %s", name, calc.FormatTime(duel.Players[p].Result.BoostTime)), laneCenters[p], y, 0.5, 0.5, duelFontSize)
+	}
+	drawStringAnchored(dc, "gap", gapCenter, y, 0.5, 0.5, duelFontSize)
+	y += 50
+
+	for i := range duel.Rooms {
+		for p := range lanes {
+			room := lanes[p][i]
+			rectX := laneCenters[p] - laneWidth/2
+			rectY := y - duelRectHeight/2
+
+			dc.Push()
+			if room.highlight {
+				setMoveQualityColor(dc, room.moveQuality)
+			} else {
+				dc.SetRGBA(0, 0, 0, 0.5)
+			}
+			dc.DrawRoundedRectangle(rectX, rectY, laneWidth, duelRectHeight, 10)
+			dc.Fill()
+			dc.Pop()
+
+			if room.highlight {
+				iconX := rectX - 20
+				if p == 1 {
+					iconX = rectX + laneWidth + 20
+				}
+				drawMoveQualityIcon(dc, room.moveQuality, iconX, y, duelRectHeight)
+			}
+
+			dc.SetColor(color.White)
+			drawStringAnchored(dc, room.text, laneCenters[p], y, 0.5, 0.5, duelFontSize)
+		}
+
+		// The arrow points at whoever is ahead after this room
+		gap := duel.Players[1].Splits[i] - duel.Players[0].Splits[i]
+		arrow := "<"
+		if gap < 0 {
+			arrow = ">"
+			gap = -gap
+		}
+
+		gapText := fmt.Sprintf("%s %.1fs", arrow, gap)
+		if gap < 0.05 {
+			gapText = "even"
+		}
+
+		dc.SetColor(color.White)
+		if leadChanges[i] {
+			dc.SetColor(color.RGBA{255, 255, 200, 255})
+			gapText = "lead! " + gapText
+		}
+		drawStringAnchored(dc, gapText, gapCenter, y, 0.5, 0.5, duelFontSize)
+
+		y += duelRowHeight
+	}
+	y += 30
+
+	dc.SetColor(color.White)
+	drawStringAnchored(dc, summary, float64(width)/2, y, 0.5, 0.5, duelFontSize)
+
+	var buf bytes.Buffer
+	dc.EncodePNG(&buf)
+	return buf, nil
+}
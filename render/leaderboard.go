@@ -0,0 +1,103 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+
+	"pkd-bot/calc"
+	"pkd-bot/leaderboard"
+
+	"github.com/fogleman/gg"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	leaderboardFontSize   = 24
+	leaderboardRowHeight  = 40
+	leaderboardRectHeight = 30
+	leaderboardColumnGap  = 40
+)
+
+// podiumQualities color the first three ranks like the moves of a seed
+var podiumQualities = []calc.MoveQuality{calc.BrilliantMove, calc.GreatMove, calc.BestMove}
+
+// Leaderboard draws the entries of board one per row, the podium highlighted
+func Leaderboard(board leaderboard.Board) (bytes.Buffer, error) {
+	dc := gg.NewContext(1, 1)
+	if err := loadFontFace(dc, leaderboardFontSize); err != nil {
+		log.Warn(err)
+		return bytes.Buffer{}, err
+	}
+
+	type row struct {
+		rank, ign, value string
+	}
+	rows := make([]row, 0, len(board.Entries))
+	rankWidth, ignWidth, valueWidth := 0.0, 0.0, 0.0
+	for _, e := range board.Entries {
+		r := row{rank: fmt.Sprintf("#%d", e.Rank), ign: e.Ign, value: board.Value(e)}
+		w, _ := dc.MeasureString(r.rank)
+		rankWidth = max(rankWidth, w)
+		w, _ = dc.MeasureString(r.ign)
+		ignWidth = max(ignWidth, w)
+		w, _ = dc.MeasureString(r.value)
+		valueWidth = max(valueWidth, w)
+		rows = append(rows, r)
+	}
+
+	title := board.Title()
+	if len(rows) == 0 {
+		title += ": nobody yet"
+	}
+	titleWidth, _ := dc.MeasureString(title)
+	rectWidth := max(rankWidth+ignWidth+valueWidth+2*leaderboardColumnGap+40, titleWidth+40)
+	width := int(rectWidth + 100)
+	height := 90 + len(rows)*leaderboardRowHeight + 20
+
+	dc = gg.NewContext(width, height)
+	if err := drawBackground(dc, width, height); err != nil {
+		log.Warn(err)
+		return bytes.Buffer{}, err
+	}
+
+	if err := loadFontFace(dc, leaderboardFontSize); err != nil {
+		log.Warn(err)
+		return bytes.Buffer{}, err
+	}
+
+	dc.SetColor(color.White)
+	drawStringAnchored(dc, title, float64(width)/2, 40, 0.5, 0.5, leaderboardFontSize)
+
+	rectX := (float64(width) - rectWidth) / 2
+	y := 90.0
+	for i, r := range rows {
+		rank := board.Entries[i].Rank
+		onPodium := rank <= len(podiumQualities)
+
+		dc.Push()
+		if onPodium {
+			setMoveQualityColor(dc, podiumQualities[rank-1])
+		} else {
+			dc.SetRGBA(0, 0, 0, 0.5)
+		}
+		dc.DrawRoundedRectangle(rectX, y-leaderboardRectHeight/2, rectWidth, leaderboardRectHeight, 10)
+		dc.Fill()
+		dc.Pop()
+
+		if onPodium {
+			drawMoveQualityIcon(dc, podiumQualities[rank-1], float64(int(rectX-25)), y, leaderboardRectHeight)
+		}
+
+		dc.SetColor(color.White)
+		drawStringAnchored(dc, r.rank, rectX+20, y, 0, 0.5, leaderboardFontSize)
+		drawStringAnchored(dc, r.ign, rectX+20+rankWidth+leaderboardColumnGap, y, 0, 0.5, leaderboardFontSize)
+		drawStringAnchored(dc, r.value, rectX+rectWidth-20, y, 1, 0.5, leaderboardFontSize)
+
+		y += leaderboardRowHeight
+	}
+
+	var buf bytes.Buffer
+	dc.EncodePNG(&buf)
+	return buf, nil
+}
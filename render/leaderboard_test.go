@@ -0,0 +1,38 @@
+package render_test
+
+import (
+	"image/png"
+	"testing"
+	"time"
+
+	"pkd-bot/leaderboard"
+	"pkd-bot/render"
+	"pkd-bot/storage"
+)
+
+func TestLeaderboard(t *testing.T) {
+	board := leaderboard.Board{Window: leaderboard.Week, Metric: leaderboard.Best, Since: time.Now()}
+	ranks := []int{1, 2, 2, 4}
+	for i, ign := range []string{"First", "Second", "AlsoSecond", "Fourth"} {
+		board.Entries = append(board.Entries, leaderboard.Entry{
+			Rank:        ranks[i],
+			FinderStats: storage.FinderStats{Ign: ign, Seeds: 3, Announced: 1, BestTime: 120 + float64(i), AverageTime: 125},
+		})
+	}
+
+	for _, entries := range [][]leaderboard.Entry{board.Entries, nil} {
+		board.Entries = entries
+		img, err := render.Leaderboard(board)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := png.Decode(&img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 110 + len(entries)*40; decoded.Bounds().Dy() != want {
+			t.Errorf("got height %d, want %d for %d entries", decoded.Bounds().Dy(), want, len(entries))
+		}
+	}
+}
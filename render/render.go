@@ -0,0 +1,144 @@
+package render
+
+import (
+	"bytes"
+	"embed"
+	"image"
+	_ "image/png"
+	"math"
+	"sync"
+
+	"pkd-bot/calc"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/image/font"
+)
+
+//go:embed font images
+var assets embed.FS
+
+var (
+	fontOnce   sync.Once
+	parsedFont *truetype.Font
+	fontErr    error
+
+	imagesMu sync.Mutex
+	images   = make(map[string]image.Image)
+)
+
+// loadFontFace is gg's LoadFontFace for the embedded minecraft font
+func loadFontFace(dc *gg.Context, size float64) error {
+	fontOnce.Do(func() {
+		var b []byte
+		if b, fontErr = assets.ReadFile("font/minecraft_font.ttf"); fontErr != nil {
+			return
+		}
+		parsedFont, fontErr = truetype.Parse(b)
+	})
+	if fontErr != nil {
+		return fontErr
+	}
+
+	dc.SetFontFace(newFace(size))
+	return nil
+}
+
+func newFace(size float64) font.Face {
+	return truetype.NewFace(parsedFont, &truetype.Options{Size: size})
+}
+
+// drawStringAnchored is dc.DrawStringAnchored, but anchored with the line height gg uses for fonts it loads from a file.
+// SetFontFace uses the face's metrics instead, which would move all text a few pixels
+func drawStringAnchored(dc *gg.Context, s string, x, y, ax, ay, size float64) {
+	w, _ := dc.MeasureString(s)
+	dc.DrawString(s, x-ax*w, y+ay*size*72/96)
+}
+
+// loadImage decodes an embedded image once and keeps it around
+func loadImage(path string) (image.Image, error) {
+	imagesMu.Lock()
+	defer imagesMu.Unlock()
+
+	if img, exists := images[path]; exists {
+		return img, nil
+	}
+
+	b, err := assets.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	images[path] = img
+	return img, nil
+}
+
+func moveQualityIconPath(quality calc.MoveQuality) string {
+	switch quality {
+	case calc.BrilliantMove:
+		return "images/brilliant.png"
+	case calc.GreatMove:
+		return "images/great.png"
+	default:
+		return "images/best.png"
+	}
+}
+
+// drawBackground covers the whole context with the background image, keeping its aspect ratio
+func drawBackground(dc *gg.Context, width, height int) error {
+	bgImage, err := loadImage("images/background.png")
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+
+	bgWidth := bgImage.Bounds().Dx()
+	bgHeight := bgImage.Bounds().Dy()
+	scaleX := float64(width) / float64(bgWidth)
+	scaleY := float64(height) / float64(bgHeight)
+	scale := math.Max(scaleX, scaleY)
+
+	newWidth := float64(bgWidth) * scale
+	newHeight := float64(bgHeight) * scale
+	x := (float64(width) - newWidth) / 2
+	y := (float64(height) - newHeight) / 2
+
+	dc.Push()
+	dc.Scale(scale, scale)
+	dc.DrawImage(bgImage, int(x/scale), int(y/scale))
+	dc.Pop()
+
+	return nil
+}
+
+func setMoveQualityColor(dc *gg.Context, quality calc.MoveQuality) {
+	c := moveQualityColor(quality)
+
+	dc.SetRGBA(float64(c.R)/255,
+		float64(c.G)/255,
+		float64(c.B)/255,
+		float64(c.A)/255)
+}
+
+// drawMoveQualityIcon draws the quality icon centered at x, y and scaled to size
+func drawMoveQualityIcon(dc *gg.Context, quality calc.MoveQuality, x, y, size float64) {
+	img, err := loadImage(moveQualityIconPath(quality))
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	scale := size / float64(img.Bounds().Dy())
+
+	dc.Push()
+	dc.Translate(x, y)
+	dc.Scale(scale, scale)
+	dc.DrawImageAnchored(img, 0, 0, 0.5, 0.5)
+	dc.Pop()
+}
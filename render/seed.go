@@ -0,0 +1,214 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+
+	"pkd-bot/calc"
+
+	"github.com/fogleman/gg"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	bestMoveColor      = color.RGBA{155, 199, 0, 200}
+	greatMoveColor     = color.RGBA{0, 121, 211, 200}
+	brilliantMoveColor = color.RGBA{48, 162, 197, 200}
+	pacelockColor      = color.RGBA{255, 255, 200, 255}
+)
+
+const (
+	seedFontSize   = 24
+	seedRectHeight = 30
+)
+
+func moveQualityColor(quality calc.MoveQuality) color.RGBA {
+	switch quality {
+	case calc.BrilliantMove:
+		return brilliantMoveColor
+	case calc.GreatMove:
+		return greatMoveColor
+	default:
+		return bestMoveColor
+	}
+}
+
+type seedRoom struct {
+	text        string
+	highlight   bool
+	pacelock    string
+	moveQuality calc.MoveQuality
+	y           float64
+}
+
+type seedTime struct {
+	prefix string
+	time   string
+	y      float64
+}
+
+// seedLayout is where everything goes on a seed image, CalcResults and CalcResultsSVG both draw from it
+type seedLayout struct {
+	width, height int
+	rooms         []seedRoom
+	rectX         float64
+	rectWidth     float64
+	times         []seedTime
+	timesX        float64
+	timesPrefixW  float64
+}
+
+func layoutSeed(roomList []string, res calc.CalcSeedResult) (seedLayout, error) {
+	if roomList[len(roomList)-1] != "finish room" {
+		roomList = append(roomList, "finish room")
+	}
+
+	dc := gg.NewContext(1, 1)
+	if err := loadFontFace(dc, seedFontSize); err != nil {
+		log.Warn(err)
+		return seedLayout{}, err
+	}
+
+	maxPacelockWidth := 0.0
+	for _, br := range res.BoostRooms {
+		if math.Abs(br.Pacelock) >= 1e-6 {
+			roundedPacelock := math.Round(br.Pacelock*10) / 10
+			pacelockText := fmt.Sprintf("pacelock %.1fs", roundedPacelock)
+			width, _ := dc.MeasureString(pacelockText)
+			if width > maxPacelockWidth {
+				maxPacelockWidth = width
+			}
+		}
+	}
+
+	layout := seedLayout{width: 775, height: 490}
+	if maxPacelockWidth > 0 {
+		layout.width = 775 + int(maxPacelockWidth) + 40 // Add padding
+	}
+
+	rooms := make([]seedRoom, 0, 9)
+	for i := 0; i < 9; i++ {
+		words := strings.Split(roomList[i], " ")
+		for j := range words {
+			if len(words[j]) > 0 {
+				words[j] = strings.ToUpper(string(words[j][0])) + words[j][1:]
+			}
+		}
+		rooms = append(rooms, seedRoom{
+			text: strings.Join(words, " "),
+		})
+	}
+
+	for _, br := range res.BoostRooms {
+		strat := calc.RoomMap[roomList[br.Ind]].BoostStrats[br.StratInd]
+		rooms[br.Ind].highlight = true
+		rooms[br.Ind].text = fmt.Sprintf("%s (%s)", rooms[br.Ind].text, strat.Name)
+		rooms[br.Ind].moveQuality = strat.Quality
+		if math.Abs(br.Pacelock) >= 1e-6 {
+			rooms[br.Ind].pacelock = fmt.Sprintf("pacelock %.1fs", math.Round(br.Pacelock*10)/10)
+		}
+	}
+
+	if !rooms[len(rooms)-1].highlight {
+		rooms = rooms[:8]
+	}
+
+	// Calculate maximum text width for consistent rectangle size
+	var maxWidth float64
+	for _, room := range rooms {
+		width, _ := dc.MeasureString(room.text)
+		if width > maxWidth {
+			maxWidth = width
+		}
+	}
+
+	layout.rectWidth = maxWidth + 40
+	layout.rectX = float64(layout.width)/2 - layout.rectWidth/2
+
+	y := 40.0
+	for i := range rooms {
+		rooms[i].y = y
+		y += 40
+	}
+	y += 20
+	layout.rooms = rooms
+
+	layout.times = []seedTime{
+		{"Boost time: ", calc.FormatTime(res.BoostTime), 0},
+		{"Boostless time: ", calc.FormatTime(res.BoostlessTime), 0},
+	}
+
+	var maxTimeWidth float64
+	for i, tt := range layout.times {
+		prefixWidth, _ := dc.MeasureString(tt.prefix)
+		timeWidth, _ := dc.MeasureString(tt.time)
+		layout.timesPrefixW = max(layout.timesPrefixW, prefixWidth)
+		maxTimeWidth = max(maxTimeWidth, timeWidth)
+
+		layout.times[i].y = y
+		y += 30
+	}
+	layout.timesX = float64(layout.width)/2 - (layout.timesPrefixW+maxTimeWidth)/2
+
+	return layout, nil
+}
+
+// CalcResults draws the first of calcResults the way the bot shows seeds
+func CalcResults(roomList []string, calcResults []calc.CalcSeedResult) (bytes.Buffer, error) {
+	layout, err := layoutSeed(roomList, calcResults[0])
+	if err != nil {
+		return bytes.Buffer{}, err
+	}
+
+	dc := gg.NewContext(layout.width, layout.height)
+
+	if err := drawBackground(dc, layout.width, layout.height); err != nil {
+		log.Warn(err)
+		return bytes.Buffer{}, err
+	}
+
+	if err := loadFontFace(dc, seedFontSize); err != nil {
+		log.Warn(err)
+		return bytes.Buffer{}, err
+	}
+
+	centerX := float64(layout.width) / 2
+	for _, room := range layout.rooms {
+		rectY := room.y - seedRectHeight/2
+
+		dc.Push()
+		if room.highlight {
+			setMoveQualityColor(dc, room.moveQuality)
+		} else {
+			dc.SetRGBA(0, 0, 0, 0.5)
+		}
+		dc.DrawRoundedRectangle(layout.rectX, rectY, layout.rectWidth, seedRectHeight, 10)
+		dc.Fill()
+		dc.Pop()
+
+		if room.highlight {
+			drawMoveQualityIcon(dc, room.moveQuality, float64(int(layout.rectX-25)), room.y, seedRectHeight)
+		}
+
+		dc.SetColor(color.White)
+		drawStringAnchored(dc, room.text, centerX, room.y, 0.5, 0.5, seedFontSize)
+
+		if room.pacelock != "" {
+			dc.SetColor(pacelockColor)
+			drawStringAnchored(dc, room.pacelock, layout.rectX+layout.rectWidth+20, room.y, 0, 0.5, seedFontSize)
+		}
+	}
+
+	dc.SetColor(color.White)
+	for _, tt := range layout.times {
+		dc.DrawString(tt.prefix, layout.timesX, tt.y)
+		dc.DrawString(tt.time, layout.timesX+layout.timesPrefixW, tt.y)
+	}
+
+	var buf bytes.Buffer
+	dc.EncodePNG(&buf)
+	return buf, nil
+}
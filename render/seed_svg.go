@@ -0,0 +1,140 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	"pkd-bot/calc"
+
+	"github.com/fogleman/gg"
+	log "github.com/sirupsen/logrus"
+)
+
+// CalcResultsSVG draws the same image as CalcResults as an svg. The font, background and icons are embedded,
+// the background as a jpeg scaled down to the image size to keep the svg small
+func CalcResultsSVG(roomList []string, calcResults []calc.CalcSeedResult) ([]byte, error) {
+	layout, err := layoutSeed(roomList, calcResults[0])
+	if err != nil {
+		return nil, err
+	}
+
+	bg := gg.NewContext(layout.width, layout.height)
+	if err := drawBackground(bg, layout.width, layout.height); err != nil {
+		log.Warn(err)
+		return nil, err
+	}
+
+	bgURI, err := jpegDataURI(bg.Image())
+	if err != nil {
+		log.Warn(err)
+		return nil, err
+	}
+
+	fontBytes, err := assets.ReadFile("font/minecraft_font.ttf")
+	if err != nil {
+		log.Warn(err)
+		return nil, err
+	}
+
+	// the text widths are measured with the real font, so the layout matches the png
+	dc := gg.NewContext(1, 1)
+	if err := loadFontFace(dc, seedFontSize); err != nil {
+		log.Warn(err)
+		return nil, err
+	}
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, layout.width, layout.height, layout.width, layout.height)
+	fmt.Fprintf(&svg, `<defs><style>@font-face{font-family:"Minecraft";src:url(data:font/ttf;base64,%s) format("truetype");}`, base64.StdEncoding.EncodeToString(fontBytes))
+	fmt.Fprintf(&svg, `text{font-family:"Minecraft",monospace;font-size:%dpx;white-space:pre;}</style></defs>`, seedFontSize)
+	fmt.Fprintf(&svg, `<image href="%s" x="0" y="0" width="%d" height="%d"/>`, bgURI, layout.width, layout.height)
+
+	icons := make(map[calc.MoveQuality]string)
+	for _, room := range layout.rooms {
+		rectY := room.y - seedRectHeight/2
+
+		fill := color.RGBA{0, 0, 0, 128}
+		if room.highlight {
+			fill = moveQualityColor(room.moveQuality)
+		}
+		fmt.Fprintf(&svg, `<rect x="%.2f" y="%.2f" width="%.2f" height="%d" rx="10" fill="%s" fill-opacity="%.3f"/>`,
+			layout.rectX, rectY, layout.rectWidth, seedRectHeight, svgColor(fill), float64(fill.A)/255)
+
+		if room.highlight {
+			if _, exists := icons[room.moveQuality]; !exists {
+				if icons[room.moveQuality], err = iconDataURI(room.moveQuality, seedRectHeight); err != nil {
+					log.Warn(err)
+					return nil, err
+				}
+			}
+
+			img, _ := loadImage(moveQualityIconPath(room.moveQuality))
+			size := img.Bounds().Size()
+			iconW := float64(size.X) * seedRectHeight / float64(size.Y)
+			iconX := float64(int(layout.rectX - 25))
+			fmt.Fprintf(&svg, `<image href="%s" x="%.2f" y="%.2f" width="%.2f" height="%d"/>`,
+				icons[room.moveQuality], iconX-iconW/2, room.y-seedRectHeight/2, iconW, seedRectHeight)
+		}
+
+		writeSVGText(&svg, dc, room.text, float64(layout.width)/2, room.y, 0.5, 0.5, color.White)
+		if room.pacelock != "" {
+			writeSVGText(&svg, dc, room.pacelock, layout.rectX+layout.rectWidth+20, room.y, 0, 0.5, pacelockColor)
+		}
+	}
+
+	for _, tt := range layout.times {
+		writeSVGText(&svg, dc, tt.prefix, layout.timesX, tt.y, 0, 0, color.White)
+		writeSVGText(&svg, dc, tt.time, layout.timesX+layout.timesPrefixW, tt.y, 0, 0, color.White)
+	}
+
+	svg.WriteString(`</svg>`)
+	return svg.Bytes(), nil
+}
+
+// writeSVGText anchors text the same way drawStringAnchored does
+func writeSVGText(svg *bytes.Buffer, dc *gg.Context, s string, x, y, ax, ay float64, c color.Color) {
+	w, _ := dc.MeasureString(s)
+	fmt.Fprintf(svg, `<text x="%.2f" y="%.2f" fill="%s">%s</text>`,
+		x-ax*w, y+ay*seedFontSize*72/96, svgColor(c), html.EscapeString(s))
+}
+
+func svgColor(c color.Color) string {
+	r, g, b, _ := color.RGBAModel.Convert(c).RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+func jpegDataURI(img image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return "", err
+	}
+
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// iconDataURI scales the quality icon down to height, the originals are a lot bigger than they're drawn
+func iconDataURI(quality calc.MoveQuality, height int) (string, error) {
+	img, err := loadImage(moveQualityIconPath(quality))
+	if err != nil {
+		return "", err
+	}
+
+	// twice the size it's shown at, so it stays sharp on high dpi screens
+	scale := float64(2*height) / float64(img.Bounds().Dy())
+	dc := gg.NewContext(int(float64(img.Bounds().Dx())*scale), 2*height)
+	dc.Scale(scale, scale)
+	dc.DrawImage(img, 0, 0)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dc.Image()); err != nil {
+		return "", err
+	}
+
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
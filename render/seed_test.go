@@ -0,0 +1,70 @@
+package render_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"pkd-bot/calc"
+	"pkd-bot/render"
+)
+
+var testRooms = []string{"around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"}
+
+func TestCalcResults(t *testing.T) {
+	results, err := calc.CalcSeed(append([]string{}, testRooms...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := render.CalcResults(append([]string{}, testRooms...), results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := png.Decode(&img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bounds().Dx() < 775 || decoded.Bounds().Dy() != 490 {
+		t.Errorf("unexpected image size %v", decoded.Bounds())
+	}
+}
+
+func TestCalcResultsSVG(t *testing.T) {
+	results, err := calc.CalcSeed(append([]string{}, testRooms...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg, err := render.CalcResultsSVG(append([]string{}, testRooms...), results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every room and the times are text, not pixels
+	var texts []string
+	dec := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid svg: %v", err)
+		}
+		if cd, ok := tok.(xml.CharData); ok && strings.TrimSpace(string(cd)) != "" {
+			texts = append(texts, string(cd))
+		}
+	}
+
+	joined := strings.Join(texts, "\n")
+	for _, want := range []string{"Around Pillars", "Early 3+1", "Boost time: ", calc.FormatTime(results[0].BoostTime)} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("svg is missing %q", want)
+		}
+	}
+}
@@ -1,16 +1,25 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"net"
 	"net/http"
-	"os"
 	"runtime/debug"
+	"strconv"
+	"time"
 
 	"pkd-bot/calc"
-	"pkd-bot/discord"
+	"pkd-bot/events"
+	"pkd-bot/storage"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -21,14 +30,29 @@ type CalcRequest struct {
 	Lobby    string   `json:"lobby"`
 }
 
+type BoostRoomsResponse struct {
+	Name     string  `json:"name"`
+	Pacelock float64 `json:"pacelock"`
+	Index    int     `json:"index"`
+}
+
 type CalcResponse struct {
-	BoostTime     string                       `json:"boost_time,omitempty"`
-	BoostRooms    []discord.BoostRoomsResponse `json:"boost_rooms,omitempty"`
-	BoostlessTime string                       `json:"boostless_time,omitempty"`
-	Error         string                       `json:"error,omitempty"`
+	BoostTime     string               `json:"boost_time,omitempty"`
+	BoostRooms    []BoostRoomsResponse `json:"boost_rooms,omitempty"`
+	BoostlessTime string               `json:"boostless_time,omitempty"`
+	Advice        *AdviceResponse      `json:"advice,omitempty"`
+	Error         string               `json:"error,omitempty"`
 }
 
-func calcHandler(w http.ResponseWriter, r *http.Request) {
+type AdviceResponse struct {
+	Recommendation      calc.Recommendation `json:"recommendation"`
+	Justification       string              `json:"justification"`
+	FasterThan          float64             `json:"faster_than"`
+	ExpectedImprovement float64             `json:"expected_improvement"`
+	QueueTime           float64             `json:"queue_time"`
+}
+
+func (srv *Server) calcHandler(w http.ResponseWriter, r *http.Request) {
 	var req CalcRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		err = fmt.Errorf("Invalid request body: %v", err)
@@ -49,7 +73,16 @@ func calcHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, resBoostRooms, err := discord.ChattriggersHandle(req.Rooms, req.TimeLeft, req.Lobby, req.Ign, debug)
+	keys, err := parseRooms(req.Rooms)
+	if err != nil {
+		apiErr := toAPIError(err)
+		resp.Error = apiErr.Message
+		w.WriteHeader(apiErr.Status)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	results, err := rankedResults(keys, calc.RoomMap)
 	if err != nil {
 		log.Errorf("Error handling ChatTriggers request: %v", err)
 		resp.Error = "Failed to process the request"
@@ -57,9 +90,25 @@ func calcHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(resp)
 		return
 	}
-	resp.BoostTime = discord.FormatTime(res.BoostTime)
-	resp.BoostlessTime = discord.FormatTime(res.BoostlessTime)
-	resp.BoostRooms = resBoostRooms
+	res := results[0]
+
+	advice := srv.adviseSeed(res.BoostTime, req.TimeLeft)
+
+	events.SeedSubmissions.Publish(events.SeedSubmitted{
+		Ign:      req.Ign,
+		Lobby:    req.Lobby,
+		TimeLeft: req.TimeLeft,
+		Rooms:    keys,
+		Result:   res,
+		Advice:   advice,
+		Debug:    debug,
+		At:       time.Now(),
+	})
+
+	resp.BoostTime = calc.FormatTime(res.BoostTime)
+	resp.BoostlessTime = calc.FormatTime(res.BoostlessTime)
+	resp.BoostRooms = boostRoomsResponse(keys, res)
+	resp.Advice = adviceResponse(advice)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -69,26 +118,84 @@ func calcHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-type PkdutilsBoostStrat struct {
-	Name      string  `json:"name"`
-	Time      float64 `json:"time"`
-	BoostTime float64 `json:"boost_time"`
+func adviceResponse(advice *calc.Advice) *AdviceResponse {
+	if advice == nil {
+		return nil
+	}
+
+	return &AdviceResponse{
+		Recommendation:      advice.Recommendation,
+		Justification:       advice.Justification,
+		FasterThan:          advice.FasterThan,
+		ExpectedImprovement: advice.ExpectedImprovement,
+		QueueTime:           advice.QueueTime.Seconds(),
+	}
+}
+
+// adviseSeed returns nil when there's no seed distribution to compare against. A missing player count or
+// time left only makes the advice less precise
+func (srv *Server) adviseSeed(seedTime float64, timeLeft string) *calc.Advice {
+	dist, err := calc.DefaultDistribution()
+	if err != nil {
+		log.Warn(err)
+		return nil
+	}
+
+	left, err := calc.ParseTimeLeft(timeLeft)
+	if err != nil {
+		log.Debug(err)
+		left = 0
+	}
+
+	count, err := srv.playerCount()
+	if err != nil {
+		log.Debug(err)
+		count = 0
+	}
+
+	advice := calc.Advise(seedTime, left, count, dist)
+	return &advice
 }
 
-type PkdutilsSplit struct {
-	BoostlessTime float64              `json:"boostless_time"`
-	BoostStrats   []PkdutilsBoostStrat `json:"boost_strats"`
+func boostRoomsResponse(keys []string, res calc.CalcSeedResult) []BoostRoomsResponse {
+	rooms := append(append(make([]string, 0, len(keys)+1), keys...), "finish room")
+
+	boostRooms := make([]BoostRoomsResponse, 0)
+	for _, room := range res.BoostRooms {
+		boostRooms = append(boostRooms, BoostRoomsResponse{
+			Name:     fmt.Sprintf("%s (%s)", calc.RoomMap[rooms[room.Ind]].Name, calc.RoomMap[rooms[room.Ind]].BoostStrats[room.StratInd].Name),
+			Pacelock: room.Pacelock,
+			Index:    room.Ind,
+		})
+	}
+
+	return boostRooms
 }
 
+type (
+	PkdutilsBoostStrat = calc.PkdutilsBoostStrat
+	PkdutilsSplit      = calc.PkdutilsSplit
+)
+
 type PkdutilsRequest struct {
 	Rooms  []string                 `json:"rooms"`
 	Splits map[string]PkdutilsSplit `json:"splits"`
 }
 
+// SplitsRequest is the body of a signed upload of a player's pkdutils splits
+type SplitsRequest struct {
+	Ign    string                   `json:"ign"`
+	Splits map[string]PkdutilsSplit `json:"splits"`
+}
+
+type SplitsResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
 type PkdutilsBody = struct {
-	BoostTime     string                       `json:"boost_time"`
-	BoostlessTime string                       `json:"boostless_time"`
-	BoostRooms    []discord.BoostRoomsResponse `json:"boost_rooms,omitempty"`
+	BoostTime     string               `json:"boost_time"`
+	BoostlessTime string               `json:"boostless_time"`
+	BoostRooms    []BoostRoomsResponse `json:"boost_rooms,omitempty"`
 }
 
 type PkdutilsResponse struct {
@@ -116,43 +223,49 @@ func pkdutilsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	splits := make(map[string]calc.Room)
-	for key, room := range req.Splits {
-		boostStrats := make([]calc.BoostRoom, len(room.BoostStrats))
-		for i, strat := range room.BoostStrats {
-			boostStrats[i] = calc.BoostRoom{
-				Name:      strat.Name,
-				Time:      strat.Time / 1000,
-				BoostTime: strat.BoostTime / 1000,
-			}
-		}
+	splits := calc.FromPkdutils(req.Splits)
 
-		splits[key] = calc.Room{
-			Name:          key,
-			BoostlessTime: room.BoostlessTime / 1000,
-			BoostStrats:   boostStrats,
-		}
+	keys, err := parseRooms(req.Rooms)
+	if err != nil {
+		apiErr := toAPIError(err)
+		resp.Error = apiErr.Message
+		w.WriteHeader(apiErr.Status)
+		json.NewEncoder(w).Encode(resp)
+		return
 	}
 
-	res, err := discord.PkdutilsHandle(req.Rooms, splits)
+	// calc with calc splits first, then with personal splits
+	bestResults, err := rankedResults(keys, calc.RoomMap)
 	if err != nil {
-		log.Errorf("Error handling ChatTriggers request: %v", err)
+		log.Errorf("Error handling pkdutils request: %v", err)
 		resp.Error = "Failed to process the request"
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(resp)
 		return
 	}
+	best := bestResults[0]
 
-	resp.Best.BoostTime = discord.FormatTime(res.Best.Result.BoostTime)
-	resp.Best.BoostlessTime = discord.FormatTime(res.Best.Result.BoostlessTime)
-	resp.Best.BoostRooms = res.Best.BoostRooms
+	personalResults, err := rankedResults(keys, splits)
+	if err != nil {
+		log.Errorf("Error handling pkdutils request: %v", err)
+		resp.Error = "Failed to process the request"
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	personal := personalResults[0]
+	log.Debugf("%+v", personal)
 
-	resp.Personal.BoostTime = discord.FormatTime(res.Personal.Result.BoostTime)
-	if res.Personal.Result.BoostTime >= res.Personal.Result.BoostlessTime {
+	resp.Best.BoostTime = calc.FormatTime(best.BoostTime)
+	resp.Best.BoostlessTime = calc.FormatTime(best.BoostlessTime)
+	resp.Best.BoostRooms = boostRoomsResponse(keys, best)
+
+	resp.Personal.BoostTime = calc.FormatTime(personal.BoostTime)
+	if personal.BoostTime >= personal.BoostlessTime {
 		resp.Personal.BoostTime = ""
 	}
-	resp.Personal.BoostlessTime = discord.FormatTime(res.Personal.Result.BoostlessTime)
-	resp.Personal.BoostRooms = res.Personal.BoostRooms
+	resp.Personal.BoostlessTime = calc.FormatTime(personal.BoostlessTime)
+	resp.Personal.BoostRooms = boostRoomsResponse(keys, personal)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -162,6 +275,128 @@ func pkdutilsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// splitsHandler keeps the splits of the ign of a signed request, the signature is what ties them to the player.
+// /duel uses them for players that don't attach theirs
+func (srv *Server) splitsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req SplitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SplitsResponse{Error: fmt.Sprintf("Invalid request body: %v", err)})
+		return
+	}
+	if req.Ign == "" || len(req.Splits) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SplitsResponse{Error: "ign and splits are required"})
+		return
+	}
+
+	// only splits a seed could be calced with are kept
+	if err := calc.CheckSplits(calc.MergeSplits(calc.FromPkdutils(req.Splits))); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SplitsResponse{Error: err.Error()})
+		return
+	}
+
+	if err := srv.store.PutSplits(r.Context(), req.Ign, req.Splits); err != nil {
+		log.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SplitsResponse{Error: "Failed to keep the splits"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type SplitImpactRequest struct {
+	Splits  json.RawMessage `json:"splits"`
+	Samples int             `json:"samples"`
+}
+
+type SplitImpactResponse struct {
+	Report *calc.ImpactReport `json:"report,omitempty"`
+	Error  string             `json:"error,omitempty"`
+}
+
+func (srv *Server) splitImpactHandler(w http.ResponseWriter, r *http.Request) {
+	var req SplitImpactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		err = fmt.Errorf("Invalid request body: %v", err)
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp SplitImpactResponse
+	w.Header().Set("Content-Type", "application/json")
+
+	if req.Samples == 0 {
+		req.Samples = calc.DefaultImpactSamples
+	}
+	if req.Samples < 0 || req.Samples > calc.MaxImpactSamples {
+		resp.Error = fmt.Sprintf("samples has to be between 0 and %d, 0 is %d", calc.MaxImpactSamples, calc.DefaultImpactSamples)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	candidate, err := calc.LoadSplits(bytes.NewReader(req.Splits))
+	if err != nil {
+		resp.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	report, err := calc.SplitImpact(r.Context(), candidate, req.Samples, srv.threshold, rand.New(rand.NewSource(time.Now().UnixNano())))
+	if r.Context().Err() != nil {
+		// the client is gone, there's no one to answer
+		log.Debug(err)
+		return
+	}
+	if err != nil {
+		log.Errorf("Error building split impact report: %v", err)
+		resp.Error = "Failed to process the request"
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	if r.FormValue("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="split_impact.csv"`)
+		if err := report.WriteCSV(w); err != nil {
+			log.Errorf("Error writing split impact CSV: %v", err)
+		}
+		return
+	}
+
+	resp.Report = &report
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// AdminMiddleware only lets requests through that carry the admin token as a bearer token
+func (srv *Server) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := srv.adminToken
+		if token == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
 func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -182,25 +417,140 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func StartServer() error {
+// newRouter sets up all the api routes, it doesn't need discord
+func (srv *Server) newRouter() *mux.Router {
 	r := mux.NewRouter()
 
+	// outermost, so the 500s RecoveryMiddleware writes are counted too
+	r.Use(MetricsMiddleware)
 	r.Use(RecoveryMiddleware)
 	r.Use(LoggingMiddleware)
 
-	r.HandleFunc("/api/chattriggers/calc", calcHandler).Methods("POST")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.HandleFunc("/healthz", healthzHandler).Methods("GET")
+	r.HandleFunc("/readyz", readyzHandler).Methods("GET")
+
+	r.HandleFunc("/api/chattriggers/calc", srv.auth.Middleware(srv.calcHandler)).Methods("POST")
 	r.HandleFunc("/api/pkdutils/calc", pkdutilsHandler).Methods("POST")
+	r.HandleFunc("/api/pkdutils/splits", srv.auth.Middleware(srv.splitsHandler)).Methods("POST")
+	r.HandleFunc("/api/splits/impact", srv.AdminMiddleware(srv.splitImpactHandler)).Methods("POST")
 
-	port := os.Getenv("HTTP_PORT")
-	if port == "" {
-		port = "8080"
+	srv.registerV2(r)
+
+	return r
+}
+
+// Server is the http server of the api, see newRouter for its routes
+type Server struct {
+	http   *http.Server
+	router *mux.Router
+	addr   net.Addr
+	failed chan error
+	// closed when shutting down, so the feed streams end instead of holding up the shutdown
+	shutdown chan struct{}
+
+	store       storage.Store
+	auth        *SubmissionAuth
+	adminToken  string
+	threshold   float64
+	playerCount func() (int, error)
+}
+
+// Config is what NewServer needs, main fills it from the app's config
+type Config struct {
+	// Port 0 picks a free port
+	Port int
+	// APIKeysFile has the keys ChatTriggers submissions are signed with
+	APIKeysFile string
+	// AdminToken enables the admin endpoints, they're disabled without it
+	AdminToken string
+	// AnnouncementThreshold is the boost time in seconds under which seeds are in the feed and the lobbies,
+	// the same the bot announces them under
+	AnnouncementThreshold float64
+	// PlayerCount is how many play PKD, the requeue advice is less precise without it
+	PlayerCount func() (int, error)
+}
+
+// NewServer makes the server of the api, the submissions and splits it gets are kept in store
+func NewServer(cfg Config, store storage.Store) *Server {
+	keysFile := cfg.APIKeysFile
+	if keysFile == "" {
+		keysFile = defaultAPIKeysFile
+	}
+	threshold := cfg.AnnouncementThreshold
+	if threshold == 0 {
+		threshold = calc.DefaultAnnouncementThreshold
+	}
+	playerCount := cfg.PlayerCount
+	if playerCount == nil {
+		playerCount = func() (int, error) { return 0, fmt.Errorf("the player count isn't known") }
 	}
 
-	log.Infof("Server starting on port %s...\n", port)
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Error(err)
+	srv := &Server{
+		failed:      make(chan error, 1),
+		shutdown:    make(chan struct{}),
+		store:       store,
+		auth:        NewSubmissionAuth(keysFile),
+		adminToken:  cfg.AdminToken,
+		threshold:   threshold,
+		playerCount: playerCount,
+	}
+	srv.router = srv.newRouter()
+	srv.http = &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Port),
+		Handler:           srv.router,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), shutdownKey{}, (<-chan struct{})(srv.shutdown))
+		},
+	}
+	srv.http.RegisterOnShutdown(func() { close(srv.shutdown) })
+
+	return srv
+}
+
+// Start listens before returning, so a port that's taken fails here
+func (srv *Server) Start() error {
+	ln, err := net.Listen("tcp", srv.http.Addr)
+	if err != nil {
 		return err
 	}
 
+	srv.addr = ln.Addr()
+	log.Infof("Server listening on %s", srv.addr)
+	go func() {
+		if err := srv.http.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			srv.failed <- err
+		}
+	}()
+
 	return nil
 }
+
+// Router has the api routes, to serve them without listening
+func (srv *Server) Router() *mux.Router {
+	return srv.router
+}
+
+// Addr is the address the server listens on once it started
+func (srv *Server) Addr() net.Addr {
+	return srv.addr
+}
+
+// Stop stops accepting requests and waits for the ones in flight until ctx is done
+func (srv *Server) Stop(ctx context.Context) error {
+	return srv.http.Shutdown(ctx)
+}
+
+// Failed delivers the error when the server stops on its own
+func (srv *Server) Failed() <-chan error {
+	return srv.failed
+}
+
+type shutdownKey struct{}
+
+// shuttingDown is closed when the server that got r starts shutting down. It's nil, so never closed, outside of a Server
+func shuttingDown(r *http.Request) <-chan struct{} {
+	shutdown, _ := r.Context().Value(shutdownKey{}).(<-chan struct{})
+	return shutdown
+}
@@ -0,0 +1,205 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/events"
+	"pkd-bot/server"
+	"pkd-bot/storage"
+)
+
+// testServer is the server the requests of the tests go to, useServer swaps it for one test
+var testServer = newServer(server.Config{}, storage.NewMemoryStore())
+
+// newServer is a server that doesn't ask hypixel
+func newServer(cfg server.Config, store storage.Store) *server.Server {
+	if cfg.PlayerCount == nil {
+		cfg.PlayerCount = func() (int, error) { return 300, nil }
+	}
+	return server.NewServer(cfg, store)
+}
+
+// useServer sends the requests of the test to a server made from cfg and store
+func useServer(t *testing.T, cfg server.Config, store storage.Store) *server.Server {
+	t.Helper()
+
+	old := testServer
+	testServer = newServer(cfg, store)
+	t.Cleanup(func() { testServer = old })
+	return testServer
+}
+
+const (
+	testKeyID     = "test-key"
+	testKeySecret = "test-secret"
+)
+
+// useTestKeys gives every test its own keys file and limits, so submissions from one don't rate limit another
+func useTestKeys(t *testing.T, keys ...server.APIKey) string {
+	t.Helper()
+
+	if len(keys) == 0 {
+		keys = []server.APIKey{{ID: testKeyID, Secret: testKeySecret, Owner: "tests"}}
+	}
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+	writeKeys(t, path, keys...)
+
+	useServer(t, server.Config{APIKeysFile: path}, storage.NewMemoryStore())
+	return path
+}
+
+func writeKeys(t *testing.T, path string, keys ...server.APIKey) {
+	t.Helper()
+
+	b, err := json.Marshal(map[string][]server.APIKey{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var nonceCounter int
+
+func signedRequest(t *testing.T, url string, body any, keyID, secret string) *http.Request {
+	t.Helper()
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonceCounter++
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := fmt.Sprintf("nonce-%d", nonceCounter)
+
+	req := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	req.Header.Set(server.HeaderKey, keyID)
+	req.Header.Set(server.HeaderTimestamp, timestamp)
+	req.Header.Set(server.HeaderNonce, nonce)
+	req.Header.Set(server.HeaderSignature, server.Sign(secret, http.MethodPost, req.URL.Path, timestamp, nonce, b))
+	return req
+}
+
+func serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	testServer.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+func postJSON(t *testing.T, url string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	testServer.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(b)))
+	return rec
+}
+
+func TestChattriggersCalc(t *testing.T) {
+	submitted := make(chan events.SeedSubmitted, 1)
+	unsubscribe := events.SeedSubmissions.Subscribe(func(e events.SeedSubmitted) { submitted <- e })
+	defer unsubscribe()
+
+	useTestKeys(t)
+	rec := serve(signedRequest(t, "/api/chattriggers/calc", server.CalcRequest{
+		Ign:      "player",
+		Rooms:    []string{"Around Pillars", "Blocks", "Fences", "Fortress", "Ice", "Early 3-1", "Underbridge", "Sandpit"},
+		TimeLeft: "2:30",
+		Lobby:    "m123A",
+	}, testKeyID, testKeySecret))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp server.CalcResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.BoostTime == "" || len(resp.BoostRooms) == 0 {
+		t.Errorf("expected a boost time and boost rooms, got %+v", resp)
+	}
+	if resp.Advice == nil {
+		t.Error("expected advice")
+	}
+
+	select {
+	case e := <-submitted:
+		if e.Ign != "player" || len(e.Rooms) != 8 || e.Rooms[5] != "early 3+1" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the seed wasn't published")
+	}
+}
+
+func TestChattriggersCalcRoomCount(t *testing.T) {
+	useTestKeys(t)
+	rec := serve(signedRequest(t, "/api/chattriggers/calc", server.CalcRequest{Rooms: []string{"blocks"}}, testKeyID, testKeySecret))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("7 rooms short: got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSplitsKeepsSignedSplits(t *testing.T) {
+	store := storage.NewMemoryStore()
+	keysFile := useTestKeys(t)
+	useServer(t, server.Config{APIKeysFile: keysFile}, store)
+
+	splits := make(map[string]server.PkdutilsSplit)
+	for key, room := range calc.RoomMap {
+		split := server.PkdutilsSplit{BoostlessTime: room.BoostlessTime * 1000}
+		for _, strat := range room.BoostStrats {
+			split.BoostStrats = append(split.BoostStrats, server.PkdutilsBoostStrat{Name: strat.Name, Time: strat.Time * 1000, BoostTime: strat.BoostTime * 1000})
+		}
+		splits[key] = split
+	}
+
+	// anyone can calc with their splits, they're only kept from signed requests
+	rec := postJSON(t, "/api/pkdutils/splits", server.SplitsRequest{Ign: "Player", Splits: splits})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want an unsigned upload rejected", rec.Code)
+	}
+	if _, _, err := store.GetSplits(context.Background(), "player"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("got %v, want no splits kept from an unsigned request", err)
+	}
+
+	rec = serve(signedRequest(t, "/api/pkdutils/splits", server.SplitsRequest{Ign: "Player", Splits: splits}, testKeyID, testKeySecret))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+
+	stored, _, err := store.GetSplits(context.Background(), "player")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != len(splits) || stored["blocks"].BoostlessTime != splits["blocks"].BoostlessTime {
+		t.Errorf("got %d stored splits, want the %d that were sent", len(stored), len(splits))
+	}
+
+	broken := map[string]server.PkdutilsSplit{"blocks": {BoostlessTime: -1000}}
+	rec = serve(signedRequest(t, "/api/pkdutils/splits", server.SplitsRequest{Ign: "Other", Splits: broken}, testKeyID, testKeySecret))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want the broken splits rejected", rec.Code)
+	}
+	if _, _, err := store.GetSplits(context.Background(), "other"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("got %v, want no splits kept from a rejected request", err)
+	}
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"pkd-bot/events"
+	"pkd-bot/ratelimit"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Headers a signed submission has to carry. The signature is the hex HMAC-SHA256, keyed with the key's secret, of
+//
+//	METHOD + "\n" + PATH + "\n" + TIMESTAMP + "\n" + NONCE + "\n" + hex(SHA256(BODY))
+const (
+	HeaderKey       = "X-PKD-Key"
+	HeaderTimestamp = "X-PKD-Timestamp"
+	HeaderNonce     = "X-PKD-Nonce"
+	HeaderSignature = "X-PKD-Signature"
+)
+
+const (
+	defaultAPIKeysFile = "api_keys.json"
+
+	// how far a submission's timestamp can be from ours, nonces are remembered for twice as long
+	maxClockSkew = 5 * time.Minute
+	maxBodySize  = 64 << 10
+
+	keyRatePerMinute = 60
+	keyBurst         = 20
+	ignRatePerMinute = 10
+	ignBurst         = 5
+
+	// rejections past this per address are only logged, not reported to the moderators
+	rejectionRatePerMinute = 2
+	rejectionBurst         = 3
+)
+
+// APIKey is an entry of the api keys file, which looks like {"keys": [{"id": ..., "secret": ..., "owner": ..., "revoked": false}]}.
+// Revoking a key is setting revoked, the file is reloaded whenever it changes
+type APIKey struct {
+	ID      string `json:"id"`
+	Secret  string `json:"secret"`
+	Owner   string `json:"owner"`
+	Revoked bool   `json:"revoked"`
+}
+
+type keyStore struct {
+	path string
+
+	mu      sync.Mutex
+	keys    map[string]APIKey
+	modTime time.Time
+}
+
+// get reloads the keys file first if it changed, a broken file keeps the keys that were loaded last
+func (ks *keyStore) get(id string) (APIKey, bool) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if info, err := os.Stat(ks.path); err != nil {
+		if ks.keys == nil {
+			log.Errorf("Can't read the api keys file, every submission will be rejected: %v", err)
+			ks.keys = make(map[string]APIKey)
+		}
+	} else if !info.ModTime().Equal(ks.modTime) {
+		if err := ks.load(); err != nil {
+			log.Errorf("Failed to load the api keys file: %v", err)
+		}
+		ks.modTime = info.ModTime()
+	}
+
+	key, exists := ks.keys[id]
+	return key, exists
+}
+
+func (ks *keyStore) load() error {
+	f, err := os.Open(ks.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var file struct {
+		Keys []APIKey `json:"keys"`
+	}
+	if err := json.NewDecoder(f).Decode(&file); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", ks.path, err)
+	}
+
+	keys := make(map[string]APIKey, len(file.Keys))
+	for _, key := range file.Keys {
+		keys[key.ID] = key
+	}
+	ks.keys = keys
+
+	log.Infof("Loaded %d api keys", len(keys))
+	return nil
+}
+
+// nonceCache remembers nonces until they're too old to pass the timestamp check anyway
+type nonceCache struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// add returns false if the nonce was already used
+func (nc *nonceCache) add(nonce string, now time.Time) bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	for n, expiry := range nc.nonces {
+		if now.After(expiry) {
+			delete(nc.nonces, n)
+		}
+	}
+
+	if _, seen := nc.nonces[nonce]; seen {
+		return false
+	}
+
+	nc.nonces[nonce] = now.Add(2 * maxClockSkew)
+	return true
+}
+
+// SubmissionAuth checks that ChatTriggers submissions are signed with a valid api key, aren't replayed
+// and stay under the per key and per ign rate limits
+type SubmissionAuth struct {
+	keys           *keyStore
+	nonces         *nonceCache
+	keyLimit       *ratelimit.Limiter
+	ignLimit       *ratelimit.Limiter
+	rejectionLimit *ratelimit.Limiter
+	now            func() time.Time
+}
+
+func NewSubmissionAuth(keysFile string) *SubmissionAuth {
+	return &SubmissionAuth{
+		keys:           &keyStore{path: keysFile},
+		nonces:         &nonceCache{nonces: make(map[string]time.Time)},
+		keyLimit:       ratelimit.New(keyRatePerMinute, keyBurst),
+		ignLimit:       ratelimit.New(ignRatePerMinute, ignBurst),
+		rejectionLimit: ratelimit.New(rejectionRatePerMinute, rejectionBurst),
+		now:            time.Now,
+	}
+}
+
+// Sign computes the signature a submission has to carry in HeaderSignature
+func Sign(secret, method, path, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", method, path, timestamp, nonce, hex.EncodeToString(bodyHash[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type rejection struct {
+	status     int
+	reason     string
+	retryAfter time.Duration
+}
+
+// check returns the ign of the submission once its signature checks out, before that anyone could have written it
+func (a *SubmissionAuth) check(r *http.Request, body []byte) (APIKey, string, *rejection) {
+	keyID := r.Header.Get(HeaderKey)
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	signature := r.Header.Get(HeaderSignature)
+
+	if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return APIKey{}, "", &rejection{status: http.StatusUnauthorized, reason: "unsigned request"}
+	}
+
+	key, exists := a.keys.get(keyID)
+	if !exists {
+		return APIKey{}, "", &rejection{status: http.StatusUnauthorized, reason: "unknown api key"}
+	}
+	if key.Revoked {
+		return key, "", &rejection{status: http.StatusForbidden, reason: "revoked api key"}
+	}
+
+	expected := Sign(key.Secret, r.Method, r.URL.Path, timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return key, "", &rejection{status: http.StatusUnauthorized, reason: "bad signature"}
+	}
+
+	var submission struct {
+		Ign string `json:"ign"`
+	}
+	json.Unmarshal(body, &submission)
+
+	now := a.now()
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || now.Sub(time.Unix(unix, 0)).Abs() > maxClockSkew {
+		return key, submission.Ign, &rejection{status: http.StatusUnauthorized, reason: "timestamp out of range"}
+	}
+
+	// the nonce is only remembered once the signature checks out, so nobody can burn other clients' nonces
+	if !a.nonces.add(keyID+"|"+nonce, now) {
+		return key, submission.Ign, &rejection{status: http.StatusUnauthorized, reason: "replayed request"}
+	}
+
+	if ok, retry := a.keyLimit.Allow(keyID, now); !ok {
+		return key, submission.Ign, &rejection{status: http.StatusTooManyRequests, reason: "api key rate limited", retryAfter: retry}
+	}
+
+	if ok, retry := a.ignLimit.Allow(submission.Ign, now); !ok {
+		return key, submission.Ign, &rejection{status: http.StatusTooManyRequests, reason: "ign rate limited", retryAfter: retry}
+	}
+
+	return key, submission.Ign, nil
+}
+
+// Middleware rejects submissions that don't pass check. Rejections are logged and, a few per address at a time,
+// published for the moderators
+func (a *SubmissionAuth) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key, ign, rej := a.check(r, body)
+		if rej == nil {
+			next(w, r)
+			return
+		}
+
+		// the port changes with every connection
+		addr, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			addr = r.RemoteAddr
+		}
+
+		log.Warnf("Rejected submission from %s (key \"%s\", owner \"%s\", ign \"%s\"): %s",
+			addr, r.Header.Get(HeaderKey), key.Owner, ign, rej.reason)
+
+		if ok, _ := a.rejectionLimit.Allow(addr, a.now()); ok {
+			events.SubmissionRejections.Publish(events.SubmissionRejected{
+				KeyID:      r.Header.Get(HeaderKey),
+				Owner:      key.Owner,
+				Ign:        ign,
+				Reason:     rej.reason,
+				RemoteAddr: addr,
+				At:         a.now(),
+			})
+		}
+
+		if rej.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rej.retryAfter.Seconds()))))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(rej.status)
+		json.NewEncoder(w).Encode(CalcResponse{Error: rej.reason})
+	}
+}
@@ -0,0 +1,163 @@
+package server_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"pkd-bot/events"
+	"pkd-bot/server"
+)
+
+var shortSeed = server.CalcRequest{Ign: "player", Rooms: []string{"blocks"}}
+
+func TestSubmissionAuthRejects(t *testing.T) {
+	useTestKeys(t)
+
+	unsigned := signedRequest(t, "/api/chattriggers/calc", shortSeed, testKeyID, testKeySecret)
+	unsigned.Header.Del(server.HeaderSignature)
+
+	tampered := signedRequest(t, "/api/chattriggers/calc", shortSeed, testKeyID, testKeySecret)
+	tampered.Header.Set(server.HeaderNonce, "other nonce")
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"unsigned", unsigned, http.StatusUnauthorized},
+		{"unknown key", signedRequest(t, "/api/chattriggers/calc", shortSeed, "nope", testKeySecret), http.StatusUnauthorized},
+		{"wrong secret", signedRequest(t, "/api/chattriggers/calc", shortSeed, testKeyID, "wrong"), http.StatusUnauthorized},
+		{"tampered", tampered, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(tt.req); rec.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestSubmissionAuthLimitsReportedRejections(t *testing.T) {
+	useTestKeys(t)
+
+	rejected := make(chan events.SubmissionRejected, 20)
+	unsubscribe := events.SubmissionRejections.Subscribe(func(e events.SubmissionRejected) { rejected <- e })
+	defer unsubscribe()
+
+	// every unsigned request makes up another ign
+	for i := range 10 {
+		req := signedRequest(t, "/api/chattriggers/calc", server.CalcRequest{Ign: fmt.Sprintf("player%d", i), Rooms: shortSeed.Rooms}, testKeyID, testKeySecret)
+		req.Header.Del(server.HeaderSignature)
+		if rec := serve(req); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d: got status %d, want %d", i, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if len(rejected) != 3 {
+		t.Errorf("got %d rejections reported, want the 3 of the burst", len(rejected))
+	}
+	for len(rejected) > 0 {
+		if e := <-rejected; e.Ign != "" || strings.Contains(e.RemoteAddr, ":") {
+			t.Errorf("got %+v, want no ign from an unsigned body and the address without the port", e)
+		}
+	}
+}
+
+func TestSubmissionAuthStaleTimestamp(t *testing.T) {
+	useTestKeys(t)
+	testServer.SetClock(func() time.Time { return time.Now().Add(time.Hour) })
+
+	rec := serve(signedRequest(t, "/api/chattriggers/calc", shortSeed, testKeyID, testKeySecret))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestSubmissionAuthReplay(t *testing.T) {
+	useTestKeys(t)
+
+	req := signedRequest(t, "/api/chattriggers/calc", shortSeed, testKeyID, testKeySecret)
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	replay := req.Clone(req.Context())
+	replay.Body = io.NopCloser(bytes.NewReader(body))
+
+	if rec := serve(req); rec.Code != http.StatusBadRequest {
+		t.Fatalf("first submission: got status %d, want it to reach the handler", rec.Code)
+	}
+	if rec := serve(replay); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replay: got status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestSubmissionAuthRevoked(t *testing.T) {
+	path := useTestKeys(t)
+
+	if rec := serve(signedRequest(t, "/api/chattriggers/calc", shortSeed, testKeyID, testKeySecret)); rec.Code != http.StatusBadRequest {
+		t.Fatalf("before revoking: got status %d, want it to reach the handler", rec.Code)
+	}
+
+	writeKeys(t, path, server.APIKey{ID: testKeyID, Secret: testKeySecret, Owner: "tests", Revoked: true})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := serve(signedRequest(t, "/api/chattriggers/calc", shortSeed, testKeyID, testKeySecret)); rec.Code != http.StatusForbidden {
+		t.Errorf("after revoking: got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestSubmissionAuthIgnRateLimit(t *testing.T) {
+	useTestKeys(t,
+		server.APIKey{ID: "a", Secret: "a-secret"},
+		server.APIKey{ID: "b", Secret: "b-secret"},
+	)
+
+	rejected := make(chan events.SubmissionRejected, 1)
+	unsubscribe := events.SubmissionRejections.Subscribe(func(e events.SubmissionRejected) { rejected <- e })
+	defer unsubscribe()
+
+	// the ign limit holds across keys
+	for i := 0; i < 5; i++ {
+		key := []string{"a", "b"}[i%2]
+		if rec := serve(signedRequest(t, "/api/chattriggers/calc", shortSeed, key, key+"-secret")); rec.Code != http.StatusBadRequest {
+			t.Fatalf("submission %d: got status %d, want it to reach the handler", i, rec.Code)
+		}
+	}
+
+	rec := serve(signedRequest(t, "/api/chattriggers/calc", shortSeed, "a", "a-secret"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+
+	select {
+	case e := <-rejected:
+		if e.Ign != "player" || e.KeyID != "a" || e.Reason != "ign rate limited" {
+			t.Errorf("unexpected rejection event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rejection wasn't published")
+	}
+
+	// other players aren't affected
+	other := server.CalcRequest{Ign: "someone else", Rooms: shortSeed.Rooms}
+	if rec := serve(signedRequest(t, "/api/chattriggers/calc", other, "b", "b-secret")); rec.Code != http.StatusBadRequest {
+		t.Errorf("other ign: got status %d, want it to reach the handler", rec.Code)
+	}
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"pkd-bot/calc"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+
+	maxBatchBody = 8 << 20
+	maxBatchLine = 64 << 10
+)
+
+// maxBatchSeeds is a var so tests don't need to send this many
+var maxBatchSeeds = 10000
+
+// batchSlots is shared by all batches, so they can't take every cpu away from the bot and the rest of the api
+var batchSlots = make(chan struct{}, runtime.NumCPU())
+
+// BatchSeedRequest is a line of an ndjson batch, ID is optional and sent back with the result
+type BatchSeedRequest struct {
+	ID    string   `json:"id,omitempty"`
+	Rooms []string `json:"rooms"`
+}
+
+// BatchResult is a line of an ndjson batch response, it has either Seed or Error
+type BatchResult struct {
+	// Line counts the seeds in the request from 1, csv headers and blank lines don't count
+	Line  int           `json:"line"`
+	ID    string        `json:"id,omitempty"`
+	Seed  *SeedResource `json:"seed,omitempty"`
+	Error *apiError     `json:"error,omitempty"`
+}
+
+type batchJob struct {
+	index int
+	id    string
+	keys  []string
+	err   error
+}
+
+type batchOutput struct {
+	index  int
+	result BatchResult
+	// boosts is only used for csv
+	boosts string
+}
+
+func batchFormat(contentType string) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		return formatNDJSON, nil
+	case "text/csv":
+		return formatCSV, nil
+	default:
+		return "", &apiError{Status: http.StatusUnsupportedMediaType, Code: codeInvalidBody, Message: "send the seeds as application/x-ndjson or text/csv"}
+	}
+}
+
+// readBatch sends a job for every seed in body until it runs out, hits the seed limit or ctx is done
+func readBatch(ctx context.Context, format string, body io.Reader, jobs chan<- batchJob) {
+	defer close(jobs)
+
+	send := func(job batchJob) bool {
+		select {
+		case jobs <- job:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	index := 0
+	next := func(id string, rooms []string, err error) bool {
+		if index == maxBatchSeeds {
+			send(batchJob{index: index, err: &apiError{Status: http.StatusRequestEntityTooLarge, Code: codeInvalidBody, Message: fmt.Sprintf("a batch can have at most %d seeds, the rest were ignored", maxBatchSeeds)}})
+			return false
+		}
+
+		job := batchJob{index: index, id: id, err: err}
+		if err == nil {
+			job.keys, job.err = parseRooms(rooms)
+		}
+		index++
+		return send(job)
+	}
+
+	if format == formatCSV {
+		r := csv.NewReader(body)
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+
+		for first := true; ; first = false {
+			record, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				next("", nil, &apiError{Status: http.StatusBadRequest, Code: codeInvalidBody, Message: err.Error()})
+				// a broken row is skipped, unless the reader can't go on
+				var parseErr *csv.ParseError
+				if !errors.As(err, &parseErr) {
+					return
+				}
+				continue
+			}
+
+			if first && isCSVHeader(record) {
+				continue
+			}
+
+			// an optional 9th column is the seed's id
+			id := ""
+			if len(record) == 9 {
+				id, record = record[8], record[:8]
+			}
+			if !next(id, record, nil) {
+				return
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), maxBatchLine)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var req BatchSeedRequest
+		var err error
+		if jsonErr := json.Unmarshal([]byte(line), &req); jsonErr != nil {
+			err = &apiError{Status: http.StatusBadRequest, Code: codeInvalidBody, Message: fmt.Sprintf("invalid seed: %v", jsonErr)}
+		}
+		if !next(req.ID, req.Rooms, err) {
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		next("", nil, &apiError{Status: http.StatusBadRequest, Code: codeInvalidBody, Message: fmt.Sprintf("failed to read the batch: %v", err)})
+	}
+}
+
+// isCSVHeader takes a first row without a single known room as a header
+func isCSVHeader(record []string) bool {
+	for _, field := range record {
+		if _, ok := resolveRoom(field); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// calcBatchJob skips the result cache, a batch of random seeds would push out the seeds people are looking at
+func calcBatchJob(job batchJob) batchOutput {
+	out := batchOutput{index: job.index, result: BatchResult{Line: job.index + 1, ID: job.id}}
+	if job.err != nil {
+		out.result.Error = toAPIError(job.err)
+		return out
+	}
+
+	rooms := append(append(make([]string, 0, len(job.keys)+1), job.keys...), "finish room")
+	results, err := calc.CalcSeedCustom(rooms, calc.RoomMap)
+	if err == nil && len(results) == 0 {
+		err = fmt.Errorf("no results found for the given rooms")
+	}
+	if err != nil {
+		out.result.Error = toAPIError(err)
+		return out
+	}
+
+	seed := newSeedResource(job.keys, results[0])
+	out.result.Seed = &seed
+	out.boosts = calc.FormatBoosts(rooms, results[0].BoostRooms, calc.RoomMap)
+	return out
+}
+
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	log.Error(err)
+	return &apiError{Status: http.StatusInternalServerError, Code: codeInternal, Message: "Failed to calc the seed"}
+}
+
+type batchWriter interface {
+	write(out batchOutput) error
+}
+
+type ndjsonBatchWriter struct {
+	enc *json.Encoder
+}
+
+func (bw ndjsonBatchWriter) write(out batchOutput) error {
+	return bw.enc.Encode(out.result)
+}
+
+type csvBatchWriter struct {
+	w *csv.Writer
+}
+
+var batchCSVHeader = []string{"line", "id", "seed_id", "boost_time", "boostless_time", "boosts", "error"}
+
+func (bw csvBatchWriter) write(out batchOutput) error {
+	record := []string{strconv.Itoa(out.result.Line), out.result.ID, "", "", "", "", ""}
+	if seed := out.result.Seed; seed != nil {
+		record[2] = seed.ID
+		record[3] = strconv.FormatFloat(seed.Best.BoostTime.Seconds, 'f', 3, 64)
+		record[4] = strconv.FormatFloat(seed.Best.BoostlessTime.Seconds, 'f', 3, 64)
+		record[5] = out.boosts
+	}
+	if out.result.Error != nil {
+		record[6] = out.result.Error.Message
+	}
+
+	bw.w.Write(record)
+	bw.w.Flush()
+	return bw.w.Error()
+}
+
+// batchV2Handler calcs every seed of an ndjson or csv body, streaming the results back in the same format and order.
+// Seeds are calced while the body is still being read, and it all stops when the client goes away
+func batchV2Handler(w http.ResponseWriter, r *http.Request) {
+	format, err := batchFormat(r.Header.Get("Content-Type"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// http/1 otherwise stops reading the body once the response is written to
+	if err := rc.EnableFullDuplex(); err != nil {
+		log.Debugf("Batch can't be full duplex: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-shuttingDown(r):
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	jobs := make(chan batchJob)
+	go readBatch(ctx, format, http.MaxBytesReader(w, r.Body, maxBatchBody), jobs)
+
+	workers := cap(batchSlots)
+	outputs := make(chan batchOutput, workers)
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for job := range jobs {
+				select {
+				case batchSlots <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				out := calcBatchJob(job)
+				<-batchSlots
+
+				select {
+				case outputs <- out:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < workers; i++ {
+			<-done
+		}
+		close(outputs)
+	}()
+
+	var bw batchWriter
+	if format == formatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		cw.Write(batchCSVHeader)
+		bw = csvBatchWriter{w: cw}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		bw = ndjsonBatchWriter{enc: json.NewEncoder(w)}
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// the workers finish out of order, results wait here until the ones before them are written
+	pending := make(map[int]batchOutput)
+	nextIndex := 0
+	for out := range outputs {
+		pending[out.index] = out
+		for {
+			out, ready := pending[nextIndex]
+			if !ready {
+				break
+			}
+			delete(pending, nextIndex)
+			nextIndex++
+
+			if err := bw.write(out); err != nil {
+				log.Warnf("Batch client went away: %v", err)
+				cancel()
+				return
+			}
+		}
+		rc.Flush()
+	}
+}
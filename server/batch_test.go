@@ -0,0 +1,125 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pkd-bot/calc"
+	"pkd-bot/server"
+)
+
+func postBatch(t *testing.T, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/seeds/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	testServer.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeBatch(t *testing.T, body *bytes.Buffer) []server.BatchResult {
+	t.Helper()
+
+	var results []server.BatchResult
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		var res server.BatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func TestBatchNDJSON(t *testing.T) {
+	// over a real connection, the results stream back while the body is still being sent
+	srv := httptest.NewServer(testServer.Router())
+	defer srv.Close()
+
+	r := rand.New(rand.NewSource(1))
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for i := 0; i < 100; i++ {
+		enc.Encode(server.BatchSeedRequest{ID: fmt.Sprint(i), Rooms: calc.RandomSeed(r)})
+	}
+	body.WriteString("\n")
+	enc.Encode(server.BatchSeedRequest{ID: "bad", Rooms: []string{"nope"}})
+	body.WriteString("{not json\n")
+
+	resp, err := http.Post(srv.URL+"/api/v2/seeds/batch", "application/x-ndjson", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var out bytes.Buffer
+	out.ReadFrom(resp.Body)
+	results := decodeBatch(t, &out)
+
+	if len(results) != 102 {
+		t.Fatalf("got %d results, want 102", len(results))
+	}
+	for i, res := range results[:100] {
+		if res.Line != i+1 || res.ID != fmt.Sprint(i) || res.Seed == nil {
+			t.Fatalf("result %d is out of order or failed: %+v", i, res)
+		}
+	}
+	if res := results[100]; res.ID != "bad" || res.Error == nil || res.Error.Code != "invalid_rooms" {
+		t.Errorf("unexpected result for too few rooms: %+v", res)
+	}
+	if res := results[101]; res.Error == nil || res.Error.Code != "invalid_body" {
+		t.Errorf("unexpected result for invalid json: %+v", res)
+	}
+}
+
+func TestBatchCSV(t *testing.T) {
+	body := "room 1,room 2,room 3,room 4,room 5,room 6,room 7,room 8,id\n" +
+		"Around Pillars,Blocks,Fences,Fortress,Ice,Early 3-1,Underbridge,Sandpit,first\n" +
+		"Blocks,Fences\n"
+
+	rec := postBatch(t, "text/csv", body)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("got status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want a header and 2 results: %v", len(records), records)
+	}
+
+	if first := records[1]; first[0] != "1" || first[1] != "first" || first[2] != testSeedID || first[3] == "" || first[5] == "" || first[6] != "" {
+		t.Errorf("unexpected first result %v", first)
+	}
+	if second := records[2]; second[0] != "2" || second[2] != "" || second[6] == "" {
+		t.Errorf("unexpected second result %v", second)
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	defer server.SetMaxBatchSeeds(2)()
+
+	seed := `{"rooms": ["around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"]}` + "\n"
+	results := decodeBatch(t, postBatch(t, "application/x-ndjson", strings.Repeat(seed, 5)).Body)
+
+	if len(results) != 3 || results[2].Error == nil || results[0].Seed == nil || results[1].Seed == nil {
+		t.Errorf("expected 2 seeds and the limit error, got %+v", results)
+	}
+
+	rec := postBatch(t, "application/xml", "<seeds/>")
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"time"
+
+	"pkd-bot/lobbies"
+)
+
+// SetClock makes the auth in front of the signed endpoints take the time from now
+func (srv *Server) SetClock(now func() time.Time) {
+	srv.auth.now = now
+}
+
+func RemoveReadinessCheck(name string) {
+	readinessMu.Lock()
+	defer readinessMu.Unlock()
+
+	delete(readinessChecks, name)
+}
+
+func RemoveStatusCheck(name string) {
+	readinessMu.Lock()
+	defer readinessMu.Unlock()
+
+	delete(statusChecks, name)
+}
+
+func SetMaxBatchSeeds(max int) (restore func()) {
+	old := maxBatchSeeds
+	maxBatchSeeds = max
+	return func() { maxBatchSeeds = old }
+}
+
+// UseLobbies makes /lobbies list the lobbies of registry
+func UseLobbies(registry *lobbies.Registry) (restore func()) {
+	old := lobbyRegistry
+	lobbyRegistry = registry
+	return func() { lobbyRegistry = old }
+}
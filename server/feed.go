@@ -0,0 +1,247 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/events"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// feedBuffer is how many seeds a slow client can fall behind before it starts missing seeds
+	feedBuffer = 16
+	// the same seed is only sent to a client once in this long, every player in the lobby submits it
+	feedDedupeTTL     = time.Hour
+	feedKeepAlive     = 30 * time.Second
+	feedWriteDeadline = 10 * time.Second
+)
+
+// FeedSeedResource is a seed the bot announced, as the live feed sends it
+type FeedSeedResource struct {
+	Ign      string       `json:"ign"`
+	Lobby    string       `json:"lobby"`
+	TimeLeft string       `json:"time_left"`
+	Seed     SeedResource `json:"seed"`
+	// Advice is left out when the advisor couldn't be consulted
+	Advice *AdviceResponse `json:"advice,omitempty"`
+	At     time.Time       `json:"at"`
+}
+
+// feedFilter picks the announced seeds a client wants, the zero value lets everything through
+type feedFilter struct {
+	maxTime float64
+	rooms   []string
+	ign     string
+}
+
+func parseFeedFilter(r *http.Request) (feedFilter, error) {
+	var filter feedFilter
+
+	if v := r.FormValue("max_time"); v != "" {
+		d, err := calc.ParseTimeLeft(v)
+		if err != nil || d <= 0 {
+			return feedFilter{}, &apiError{Status: http.StatusBadRequest, Code: codeInvalidFilter, Message: fmt.Sprintf("max_time \"%s\" has to be a time like 2:05 or 125", v)}
+		}
+		filter.maxTime = d.Seconds()
+	}
+
+	for _, v := range r.Form["rooms"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+
+			key, ok := resolveRoom(name)
+			if !ok {
+				return feedFilter{}, &apiError{Status: http.StatusBadRequest, Code: codeUnknownRoom, Message: fmt.Sprintf("room \"%s\" doesn't exist", name)}
+			}
+			filter.rooms = append(filter.rooms, key)
+		}
+	}
+
+	filter.ign = strings.TrimSpace(r.FormValue("ign"))
+
+	return filter, nil
+}
+
+func (f feedFilter) matches(e events.SeedSubmitted) bool {
+	if f.maxTime > 0 && e.Result.BoostTime > f.maxTime {
+		return false
+	}
+
+	if f.ign != "" && !strings.EqualFold(f.ign, e.Ign) {
+		return false
+	}
+
+	for _, room := range f.rooms {
+		if !slices.Contains(e.Rooms, room) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// subscribeFeed sends the announced seeds passing filter on the returned channel until unsubscribe is called
+func (srv *Server) subscribeFeed(filter feedFilter) (<-chan FeedSeedResource, func()) {
+	seeds := make(chan FeedSeedResource, feedBuffer)
+	// the bus calls the handler concurrently
+	var mu sync.Mutex
+	seen := make(map[string]time.Time)
+
+	unsubscribe := events.SeedSubmissions.Subscribe(func(e events.SeedSubmitted) {
+		if !e.Announceable(srv.threshold) || !filter.matches(e) {
+			return
+		}
+
+		id := seedID(e.Rooms)
+		mu.Lock()
+		if at, exists := seen[id]; exists && e.At.Sub(at) < feedDedupeTTL {
+			mu.Unlock()
+			return
+		}
+		for seed, at := range seen {
+			if e.At.Sub(at) >= feedDedupeTTL {
+				delete(seen, seed)
+			}
+		}
+		seen[id] = e.At
+		mu.Unlock()
+
+		select {
+		case seeds <- FeedSeedResource{
+			Ign:      e.Ign,
+			Lobby:    e.Lobby,
+			TimeLeft: e.TimeLeft,
+			Seed:     newSeedResource(e.Rooms, e.Result),
+			Advice:   adviceResponse(e.Advice),
+			At:       e.At,
+		}:
+		default:
+			log.Warnf("Feed client fell behind, dropped seed %s", id)
+		}
+	})
+
+	return seeds, unsubscribe
+}
+
+// feedSSEHandler streams announced seeds as server-sent events, each one a "seed" event with a FeedSeedResource
+func (srv *Server) feedSSEHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFeedFilter(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, fmt.Errorf("response writer doesn't support flushing"))
+		return
+	}
+
+	seeds, unsubscribe := srv.subscribeFeed(filter)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	// the comment gets the headers to the client before the first seed
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(feedKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-shuttingDown(r):
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case seed := <-seeds:
+			b, err := json.Marshal(seed)
+			if err != nil {
+				log.Errorf("Error encoding feed seed: %v", err)
+				continue
+			}
+
+			fmt.Fprintf(w, "event: seed\nid: %s\ndata: %s\n\n", seed.Seed.ID, b)
+			flusher.Flush()
+		}
+	}
+}
+
+// overlays are loaded from anywhere, e.g. OBS browser sources, so every origin is allowed
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// feedWSHandler streams announced seeds over a websocket, each message is a FeedSeedResource. Messages from the client are ignored
+func (srv *Server) feedWSHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFeedFilter(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// subscribing first means no seed is missed between the handshake and the first read from seeds
+	seeds, unsubscribe := srv.subscribeFeed(filter)
+	defer unsubscribe()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already answered the request
+		log.Warnf("Failed to upgrade feed connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// reading is what notices the client going away, and it answers pings
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(feedKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-shuttingDown(r):
+			// hijacked connections aren't waited for by the shutdown, so they're closed properly here
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(feedWriteDeadline))
+			return
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(feedWriteDeadline)); err != nil {
+				return
+			}
+		case seed := <-seeds:
+			conn.SetWriteDeadline(time.Now().Add(feedWriteDeadline))
+			if err := conn.WriteJSON(seed); err != nil {
+				log.Warnf("Failed to send seed to feed client: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package server_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/events"
+	"pkd-bot/server"
+
+	"github.com/gorilla/websocket"
+)
+
+var feedRooms = []string{"around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"}
+
+func feedSeed(ign string, boostTime float64) events.SeedSubmitted {
+	return events.SeedSubmitted{
+		Ign:      ign,
+		Lobby:    "m123A",
+		TimeLeft: "2:30",
+		Rooms:    feedRooms,
+		Result:   calc.CalcSeedResult{BoostTime: boostTime, BoostlessTime: boostTime + 5},
+		At:       time.Now(),
+	}
+}
+
+func TestFeedSSE(t *testing.T) {
+	srv := httptest.NewServer(testServer.Router())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v2/feed?max_time=2:00&rooms=blocks,early-3-plus-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	// the connected comment means the handler has subscribed
+	if !lines.Scan() || !strings.HasPrefix(lines.Text(), ":") {
+		t.Fatalf("expected the connected comment, got %q", lines.Text())
+	}
+
+	// too slow for the filter, then too slow to be announced at all, then debug
+	events.SeedSubmissions.Publish(feedSeed("slow", 125))
+	events.SeedSubmissions.Publish(feedSeed("not announced", calc.DefaultAnnouncementThreshold+1))
+	debug := feedSeed("debug", 100)
+	debug.Debug = true
+	events.SeedSubmissions.Publish(debug)
+	time.Sleep(50 * time.Millisecond)
+	events.SeedSubmissions.Publish(feedSeed("fast", 110))
+
+	var data string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for lines.Scan() {
+			if d, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+				data = d
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no seed was streamed")
+	}
+
+	var seed server.FeedSeedResource
+	if err := json.Unmarshal([]byte(data), &seed); err != nil {
+		t.Fatal(err)
+	}
+	if seed.Ign != "fast" || seed.Seed.Best.BoostTime.Seconds != 110 || len(seed.Seed.Rooms) != 8 {
+		t.Errorf("unexpected seed %+v", seed)
+	}
+}
+
+func TestFeedWebSocket(t *testing.T) {
+	srv := httptest.NewServer(testServer.Router())
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/v2/feed/ws?ign=Player", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	events.SeedSubmissions.Publish(feedSeed("someone else", 100))
+	time.Sleep(50 * time.Millisecond)
+	events.SeedSubmissions.Publish(feedSeed("player", 100))
+	time.Sleep(50 * time.Millisecond)
+	// the same seed again from another player in the lobby isn't sent twice
+	events.SeedSubmissions.Publish(feedSeed("player", 100))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var seed server.FeedSeedResource
+	if err := conn.ReadJSON(&seed); err != nil {
+		t.Fatal(err)
+	}
+	if seed.Ign != "player" {
+		t.Errorf("got a seed from %q, want player", seed.Ign)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if err := conn.ReadJSON(&seed); err == nil {
+		t.Errorf("the same seed was sent twice")
+	}
+}
+
+func TestFeedInvalidFilter(t *testing.T) {
+	tests := []struct {
+		name, url, code string
+	}{
+		{"max time", "/api/v2/feed?max_time=soon", "invalid_filter"},
+		{"room", "/api/v2/feed/ws?rooms=blocks,nope", "unknown_room"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := decode[server.ErrorResponse](t, get(t, tt.url), http.StatusBadRequest)
+			if resp.Error.Code != tt.code {
+				t.Errorf("got code %s, want %s", resp.Error.Code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	readinessMu     sync.RWMutex
+	readinessChecks = map[string]func() error{
+		"splits": func() error { return calc.CheckSplits(calc.RoomMap) },
+	}
+
+	// statusChecks are only reported by /healthz, the api works without what they check
+	statusChecks = map[string]func() error{}
+)
+
+// RegisterReadinessCheck adds a check /readyz runs, the server isn't ready while any of them returns an error
+func RegisterReadinessCheck(name string, check func() error) {
+	readinessMu.Lock()
+	defer readinessMu.Unlock()
+
+	readinessChecks[name] = check
+}
+
+// RegisterStatusCheck adds a check /healthz reports without it affecting /readyz, e.g. discord being disconnected
+func RegisterStatusCheck(name string, check func() error) {
+	readinessMu.Lock()
+	defer readinessMu.Unlock()
+
+	statusChecks[name] = check
+}
+
+// HealthResponse lists every check as "ok" or its error
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// runChecks runs the readiness checks, and the status checks too with withStatus. Only readiness checks failing
+// make it not ready
+func runChecks(withStatus bool) (HealthResponse, bool) {
+	readinessMu.RLock()
+	defer readinessMu.RUnlock()
+
+	resp := HealthResponse{Status: "ok", Checks: make(map[string]string, len(readinessChecks)+len(statusChecks))}
+	ready := true
+	for _, name := range sortedNames(readinessChecks) {
+		if err := readinessChecks[name](); err != nil {
+			resp.Checks[name] = err.Error()
+			ready = false
+			continue
+		}
+		resp.Checks[name] = "ok"
+	}
+	if withStatus {
+		for _, name := range sortedNames(statusChecks) {
+			if err := statusChecks[name](); err != nil {
+				resp.Checks[name] = err.Error()
+				continue
+			}
+			resp.Checks[name] = "ok"
+		}
+	}
+
+	if !ready {
+		resp.Status = "unavailable"
+	}
+	return resp, ready
+}
+
+func sortedNames(checks map[string]func() error) []string {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// healthzHandler is the liveness check, it only fails when the server can't answer at all.
+// Every check is included so people looking at it see why /readyz fails, or that discord is down
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	resp, _ := runChecks(true)
+	resp.Status = "ok"
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// readyzHandler answers 503 while any readiness check fails, e.g. the database being unreachable
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	resp, ready := runChecks(false)
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// statusRecorder remembers the status code for the metrics. It passes Flush and Hijack through for the feed streams
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer doesn't support hijacking")
+	}
+
+	// a hijacked connection is a websocket upgrade
+	sr.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// MetricsMiddleware counts requests and their latency by route template, so seed ids don't make a series each
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,71 @@
+package server_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"pkd-bot/server"
+)
+
+func TestReadiness(t *testing.T) {
+	resp := decode[server.HealthResponse](t, get(t, "/readyz"), http.StatusOK)
+	if resp.Checks["splits"] != "ok" {
+		t.Errorf("the splits check failed: %+v", resp)
+	}
+
+	server.RegisterReadinessCheck("storage", func() error { return errors.New("connection refused") })
+	defer server.RemoveReadinessCheck("storage")
+
+	resp = decode[server.HealthResponse](t, get(t, "/readyz"), http.StatusServiceUnavailable)
+	if resp.Status != "unavailable" || resp.Checks["storage"] != "connection refused" {
+		t.Errorf("unexpected readiness %+v", resp)
+	}
+
+	// liveness doesn't depend on the readiness checks
+	resp = decode[server.HealthResponse](t, get(t, "/healthz"), http.StatusOK)
+	if resp.Status != "ok" || resp.Checks["storage"] != "connection refused" {
+		t.Errorf("unexpected health %+v", resp)
+	}
+}
+
+func TestStatusChecksDontAffectReadiness(t *testing.T) {
+	server.RegisterStatusCheck("discord", func() error { return errors.New("not connected to the gateway yet") })
+	defer server.RemoveStatusCheck("discord")
+
+	// the api works without discord
+	resp := decode[server.HealthResponse](t, get(t, "/readyz"), http.StatusOK)
+	if resp.Status != "ok" {
+		t.Errorf("unexpected readiness %+v", resp)
+	}
+	if _, ok := resp.Checks["discord"]; ok {
+		t.Errorf("/readyz reports discord: %+v", resp)
+	}
+
+	resp = decode[server.HealthResponse](t, get(t, "/healthz"), http.StatusOK)
+	if resp.Status != "ok" || resp.Checks["discord"] != "not connected to the gateway yet" {
+		t.Errorf("unexpected health %+v", resp)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	get(t, "/api/v2/seeds/"+testSeedID)
+
+	rec := get(t, "/metrics")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`pkd_http_requests_total{code="200",method="GET",route="/api/v2/seeds/{seed}"}`,
+		`pkd_http_request_duration_seconds_bucket{method="GET",route="/api/v2/seeds/{seed}"`,
+		`pkd_calc_duration_seconds_count`,
+		`pkd_calc_cache_requests_total{result="miss"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics doesn't have %s", want)
+		}
+	}
+}
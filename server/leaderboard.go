@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"pkd-bot/leaderboard"
+)
+
+type LeaderboardEntryResource struct {
+	Rank        int    `json:"rank"`
+	Ign         string `json:"ign"`
+	Seeds       int    `json:"seeds"`
+	Announced   int    `json:"announced"`
+	BestTime    Time   `json:"best_time"`
+	AverageTime Time   `json:"average_time"`
+}
+
+type LeaderboardResource struct {
+	Window  leaderboard.Window         `json:"window"`
+	By      leaderboard.Metric         `json:"by"`
+	Title   string                     `json:"title"`
+	Since   time.Time                  `json:"since"`
+	Until   time.Time                  `json:"until"`
+	Page    int                        `json:"page"`
+	PerPage int                        `json:"per_page"`
+	Entries []LeaderboardEntryResource `json:"entries"`
+}
+
+// leaderboardV2Handler ranks the finders of the seeds of this week, month or season
+func (srv *Server) leaderboardV2Handler(w http.ResponseWriter, r *http.Request) {
+	window, err := leaderboard.ParseWindow(r.FormValue("window"))
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidFilter, Message: err.Error()})
+		return
+	}
+	metric, err := leaderboard.ParseMetric(r.FormValue("by"))
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidFilter, Message: err.Error()})
+		return
+	}
+	page, perPage, err := pageParams(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	board, err := leaderboard.Build(r.Context(), srv.store, window, metric, time.Now(), page*perPage)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resource := LeaderboardResource{
+		Window:  board.Window,
+		By:      board.Metric,
+		Title:   board.Title(),
+		Since:   board.Since,
+		Until:   board.Until,
+		Page:    page,
+		PerPage: perPage,
+		Entries: make([]LeaderboardEntryResource, 0, perPage),
+	}
+	for _, e := range board.Entries[min((page-1)*perPage, len(board.Entries)):] {
+		resource.Entries = append(resource.Entries, LeaderboardEntryResource{
+			Rank:        e.Rank,
+			Ign:         e.Ign,
+			Seeds:       e.Seeds,
+			Announced:   e.Announced,
+			BestTime:    newTime(e.BestTime),
+			AverageTime: newTime(e.AverageTime),
+		})
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	writeJSON(w, http.StatusOK, resource)
+}
@@ -0,0 +1,54 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/server"
+	"pkd-bot/storage"
+)
+
+func TestLeaderboard(t *testing.T) {
+	store := storage.NewMemoryStore()
+	useServer(t, server.Config{}, store)
+
+	now := time.Now()
+	for i, sub := range []storage.Submission{
+		{Ign: "Fast", Lobby: "m1A", BoostTime: calc.DefaultAnnouncementThreshold - 10},
+		{Ign: "Fast", Lobby: "m2A", BoostTime: calc.DefaultAnnouncementThreshold - 5},
+		{Ign: "Slow", Lobby: "m3A", BoostTime: calc.DefaultAnnouncementThreshold - 1},
+		{Ign: "Debug", Lobby: "m4A", BoostTime: 1, Debug: true},
+	} {
+		sub.Rooms, sub.At = feedRooms, now.Add(time.Duration(i)*time.Millisecond)
+		if err := store.AddSubmission(context.Background(), &sub); err != nil {
+			t.Fatal(err)
+		}
+		if !sub.Debug {
+			a := &storage.Announcement{GuildID: "guild", Lobby: sub.Lobby, Rooms: feedRooms, At: sub.At}
+			if err := store.AddAnnouncement(context.Background(), a); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	got := decode[server.LeaderboardResource](t, get(t, "/api/v2/leaderboard"), http.StatusOK)
+	if got.Window != "week" || got.By != "announced" || !got.Until.After(now) {
+		t.Errorf("got %+v, want this week's leaderboard of the seeds announced", got)
+	}
+	if len(got.Entries) != 2 || got.Entries[0].Ign != "Fast" || got.Entries[0].Announced != 2 || got.Entries[1].Rank != 2 {
+		t.Fatalf("got %+v, want the players ranked without the debug seed", got.Entries)
+	}
+	if got.Entries[0].BestTime.Seconds != calc.DefaultAnnouncementThreshold-10 {
+		t.Errorf("got %+v, want the best time of the player", got.Entries[0])
+	}
+
+	got = decode[server.LeaderboardResource](t, get(t, "/api/v2/leaderboard?window=season&by=best&page=2&per_page=1"), http.StatusOK)
+	if len(got.Entries) != 1 || got.Entries[0].Ign != "Slow" || got.Entries[0].Rank != 2 {
+		t.Errorf("got %+v, want the second best seed", got.Entries)
+	}
+
+	decode[map[string]any](t, get(t, "/api/v2/leaderboard?window=decade"), http.StatusBadRequest)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"pkd-bot/lobbies"
+)
+
+// lobbyRegistry is swapped out in tests, so they don't see the lobbies of each other's submissions
+var lobbyRegistry = lobbies.Current
+
+// LobbyResource is a lobby that hasn't requeued yet, with the seed its players submitted
+type LobbyResource struct {
+	Lobby   string       `json:"lobby"`
+	Seed    SeedResource `json:"seed"`
+	Finders []string     `json:"finders"`
+	// RequeuesAt and TimeLeft are left out when none of the finders sent the time left
+	RequeuesAt *time.Time `json:"requeues_at,omitempty"`
+	TimeLeft   *Time      `json:"time_left,omitempty"`
+	FirstSeen  time.Time  `json:"first_seen"`
+	LastSeen   time.Time  `json:"last_seen"`
+}
+
+func lobbyResource(l lobbies.Lobby, now time.Time) LobbyResource {
+	lobby := LobbyResource{
+		Lobby:     l.Name,
+		Seed:      newSeedResource(l.Rooms, l.Result),
+		Finders:   l.Finders,
+		FirstSeen: l.FirstSeen,
+		LastSeen:  l.LastSeen,
+	}
+	if !l.Deadline.IsZero() {
+		deadline := l.Deadline
+		left := newTime(l.TimeLeft(now).Round(time.Second).Seconds())
+		lobby.RequeuesAt, lobby.TimeLeft = &deadline, &left
+	}
+	return lobby
+}
+
+// matchesLobby is matches for the seed of a lobby, the ign can be any of its finders. Like for /lobbies in
+// discord, the seed has to be under max_time
+func (f feedFilter) matchesLobby(l lobbies.Lobby) bool {
+	if f.maxTime > 0 && l.Result.BoostTime >= f.maxTime {
+		return false
+	}
+
+	if f.ign != "" && !slices.ContainsFunc(l.Finders, func(finder string) bool { return strings.EqualFold(finder, f.ign) }) {
+		return false
+	}
+
+	for _, room := range f.rooms {
+		if !slices.Contains(l.Rooms, room) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lobbiesV2Handler lists the lobbies with a good seed that can still be joined, the best seeds first.
+// Without max_time, good is what the bot announces
+func (srv *Server) lobbiesV2Handler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFeedFilter(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	now := time.Now()
+	resources := make([]LobbyResource, 0)
+	for _, l := range lobbyRegistry.Active(now) {
+		if filter.maxTime == 0 && l.Result.BoostTime >= srv.threshold {
+			continue
+		}
+		if filter.matchesLobby(l) {
+			resources = append(resources, lobbyResource(l, now))
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resources)
+}
@@ -0,0 +1,53 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"pkd-bot/calc"
+	"pkd-bot/lobbies"
+	"pkd-bot/server"
+)
+
+func TestLobbies(t *testing.T) {
+	registry := lobbies.NewRegistry()
+	defer server.UseLobbies(registry)()
+
+	registry.Add(feedSeed("fast", 110))
+	slow := feedSeed("slow", 125)
+	slow.Lobby = "m2B"
+	registry.Add(slow)
+	unknown := feedSeed("unknown", 120)
+	unknown.Lobby, unknown.TimeLeft = "m3C", ""
+	registry.Add(unknown)
+	bad := feedSeed("bad", calc.DefaultAnnouncementThreshold+1)
+	bad.Lobby = "m4D"
+	registry.Add(bad)
+
+	got := decode[[]server.LobbyResource](t, get(t, "/api/v2/lobbies"), http.StatusOK)
+	if len(got) != 3 || got[0].Lobby != "m123A" || got[1].Lobby != "m3C" || got[2].Lobby != "m2B" {
+		t.Fatalf("got %+v, want the good seeds, the fastest first", got)
+	}
+	if got[0].TimeLeft == nil || got[0].TimeLeft.Seconds > 150 || got[0].TimeLeft.Seconds < 140 || got[0].Finders[0] != "fast" {
+		t.Errorf("got %+v, want the time left and the finder", got[0])
+	}
+	if got[1].TimeLeft != nil || got[1].RequeuesAt != nil {
+		t.Errorf("got %+v, want no time left for a lobby nobody sent it for", got[1])
+	}
+	if got[0].Seed.ID != calc.SeedID(feedRooms) || got[0].Seed.Best.BoostTime.Seconds != 110 {
+		t.Errorf("got seed %+v, want the submitted one", got[0].Seed)
+	}
+
+	got = decode[[]server.LobbyResource](t, get(t, "/api/v2/lobbies?max_time=2:00&ign=FAST"), http.StatusOK)
+	if len(got) != 1 || got[0].Lobby != "m123A" {
+		t.Errorf("got %+v, want the lobby the filters match", got)
+	}
+
+	// like the lobbies the bot lists, a seed at max_time is too slow
+	got = decode[[]server.LobbyResource](t, get(t, "/api/v2/lobbies?max_time=2:05"), http.StatusOK)
+	if len(got) != 2 || got[1].Lobby != "m3C" {
+		t.Errorf("got %+v, want the seeds under max_time", got)
+	}
+
+	decode[map[string]any](t, get(t, "/api/v2/lobbies?max_time=soon"), http.StatusBadRequest)
+}
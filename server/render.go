@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"pkd-bot/calc"
+	"pkd-bot/render"
+
+	"github.com/gorilla/mux"
+)
+
+// seedImageV2Handler renders a seed like the bot does. index and boosts pick the result the same way
+// the bot's arrow and filter buttons do, index counts from 0 within the filtered results
+func seedImageV2Handler(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := parseSeedID(mux.Vars(r)["seed"])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		boosts, err := boostsFilter(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		index := 0
+		if v := r.FormValue("index"); v != "" {
+			if index, err = strconv.Atoi(v); err != nil || index < 0 {
+				writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidIndex, Message: "index has to be 0 or more"})
+				return
+			}
+		}
+
+		results, err := rankedResults(keys, calc.RoomMap)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		filtered := calc.FilterByBoosts(results, boosts)
+		if index >= len(filtered) {
+			writeError(w, &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: fmt.Sprintf("there are %d results, index %d doesn't exist", len(filtered), index)})
+			return
+		}
+
+		rooms := append(make([]string, 0, len(keys)+1), keys...)
+		if format == "svg" {
+			svg, err := render.CalcResultsSVG(rooms, filtered[index:])
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+
+			writeCached(w, r, "image/svg+xml", svg)
+			return
+		}
+
+		img, err := render.CalcResults(rooms, filtered[index:])
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeCached(w, r, "image/png", img.Bytes())
+	}
+}
@@ -0,0 +1,41 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"pkd-bot/server"
+	"pkd-bot/storage"
+)
+
+func TestServerShutdownEndsFeeds(t *testing.T) {
+	srv := newServer(server.Config{Port: 0}, storage.NewMemoryStore())
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get("http://" + srv.Addr().String() + "/api/v2/feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// wait for the stream to be open
+	if !bufio.NewScanner(resp.Body).Scan() {
+		t.Fatal("the feed didn't start")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := srv.Stop(ctx); err != nil {
+		t.Fatalf("the open feed held up the shutdown: %v", err)
+	}
+
+	if _, err := http.Get("http://" + srv.Addr().String() + "/healthz"); err == nil {
+		t.Error("the server still answers after stopping")
+	}
+}
@@ -0,0 +1,699 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"pkd-bot/calc"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// v2 error codes
+const (
+	codeInvalidBody       = "invalid_body"
+	codeInvalidRooms      = "invalid_rooms"
+	codeUnknownRoom       = "unknown_room"
+	codeInvalidSeed       = "invalid_seed"
+	codeInvalidSplits     = "invalid_splits"
+	codeInvalidPagination = "invalid_pagination"
+	codeInvalidFilter     = "invalid_filter"
+	codeInvalidIndex      = "invalid_index"
+	codeNotFound          = "not_found"
+	codeMethodNotAllowed  = "method_not_allowed"
+	codeInternal          = "internal_error"
+)
+
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+type ErrorResponse struct {
+	Error *apiError `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("Error encoding response: %v", err)
+	}
+}
+
+// writeCachedJSON is writeJSON with an ETag, clients revalidate with If-None-Match instead of downloading the same data again.
+// The data can change between restarts since strat qualities are derived on startup
+func writeCachedJSON(w http.ResponseWriter, r *http.Request, body any) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeCached(w, r, "application/json", append(b, '\n'))
+}
+
+func writeCached(w http.ResponseWriter, r *http.Request, contentType string, b []byte) {
+	sum := sha256.Sum256(b)
+	etag := fmt.Sprintf(`"%x"`, sum[:16])
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(b)
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		log.Error(err)
+		apiErr = &apiError{Status: http.StatusInternalServerError, Code: codeInternal, Message: "Failed to process the request"}
+	}
+
+	writeJSON(w, apiErr.Status, ErrorResponse{Error: apiErr})
+}
+
+// Time is sent both as seconds, for programs, and formatted like the bot does, for people
+type Time struct {
+	Seconds   float64 `json:"seconds"`
+	Formatted string  `json:"formatted"`
+}
+
+func newTime(seconds float64) Time {
+	return Time{Seconds: seconds, Formatted: calc.FormatTime(seconds)}
+}
+
+type RoomRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type StratResource struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Time  Time   `json:"time"`
+	// BoostAt is how far into the room the boost is used
+	BoostAt Time   `json:"boost_at"`
+	Quality string `json:"quality"`
+}
+
+type TimesaveResource struct {
+	Name string `json:"name"`
+	// After is left out for the rule that applies to the first room
+	After    *RoomRef `json:"after,omitempty"`
+	Strat    string   `json:"strat,omitempty"`
+	Timesave Time     `json:"timesave"`
+}
+
+type RoomResource struct {
+	ID            string          `json:"id"`
+	Name          string          `json:"name"`
+	Aliases       []string        `json:"aliases"`
+	BoostlessTime Time            `json:"boostless_time"`
+	BoostStrats   []StratResource `json:"boost_strats"`
+	// Timesaves are taken off the room after this one
+	Timesaves []TimesaveResource `json:"timesaves"`
+}
+
+type VariantResource struct {
+	Name        string  `json:"name"`
+	BoostedTime Time    `json:"boosted_time"`
+	BoostAt     float64 `json:"boost_at"`
+}
+
+type SegmentResource struct {
+	Name string `json:"name"`
+	Time Time   `json:"time"`
+	// BoostedTime and BoostAt are left out for segments that aren't boosted
+	BoostedTime *Time             `json:"boosted_time,omitempty"`
+	BoostAt     *float64          `json:"boost_at,omitempty"`
+	Variants    []VariantResource `json:"variants,omitempty"`
+}
+
+type SplitsResource struct {
+	Room     RoomRef           `json:"room"`
+	Segments []SegmentResource `json:"segments"`
+}
+
+type BoostResource struct {
+	Index      int     `json:"index"`
+	Room       RoomRef `json:"room"`
+	StratIndex int     `json:"strat_index"`
+	Strat      string  `json:"strat"`
+	Pacelock   Time    `json:"pacelock"`
+}
+
+type ResultResource struct {
+	Rank          int             `json:"rank"`
+	BoostTime     Time            `json:"boost_time"`
+	BoostlessTime Time            `json:"boostless_time"`
+	Boosts        []BoostResource `json:"boosts"`
+}
+
+type SeedResource struct {
+	ID    string         `json:"id"`
+	Rooms []RoomRef      `json:"rooms"`
+	Best  ResultResource `json:"best"`
+}
+
+type ResultPage struct {
+	SeedID  string           `json:"seed_id"`
+	Results []ResultResource `json:"results"`
+	Page    int              `json:"page"`
+	PerPage int              `json:"per_page"`
+	Total   int              `json:"total"`
+}
+
+type ExplainedRoom struct {
+	Index             int     `json:"index"`
+	Room              RoomRef `json:"room"`
+	BoostlessTime     Time    `json:"boostless_time"`
+	Boosted           bool    `json:"boosted"`
+	Strat             string  `json:"strat,omitempty"`
+	BeforeBoost       *Time   `json:"before_boost,omitempty"`
+	AfterBoost        *Time   `json:"after_boost,omitempty"`
+	Pacelock          Time    `json:"pacelock"`
+	Timesave          Time    `json:"timesave"`
+	BoostlessTimesave Time    `json:"boostless_timesave"`
+	Time              Time    `json:"time"`
+	BoostlessRunTime  Time    `json:"boostless_run_time"`
+}
+
+type ExplanationResource struct {
+	SeedID        string          `json:"seed_id"`
+	Rank          int             `json:"rank"`
+	Rooms         []ExplainedRoom `json:"rooms"`
+	BoostTime     Time            `json:"boost_time"`
+	BoostlessTime Time            `json:"boostless_time"`
+}
+
+type SeedRequest struct {
+	Rooms []string `json:"rooms"`
+}
+
+type CustomResultsRequest struct {
+	// Splits are in seconds and have the shape the splits resource is calced from, rooms that are left out use the calc's splits
+	Splits json.RawMessage `json:"splits"`
+}
+
+// room ids are calc's room slugs, e.g. "early-3-plus-1"
+func roomSlug(key string) string {
+	return calc.RoomSlug(key)
+}
+
+func roomRef(key string) RoomRef {
+	return RoomRef{ID: roomSlug(key), Name: calc.RoomMap[key].Name}
+}
+
+// resolveRoom finds the RoomMap key for a room key, room id, room name or alias
+func resolveRoom(name string) (string, bool) {
+	if key, exists := calc.ResolveRoom(name); exists {
+		return key, true
+	}
+
+	return calc.RoomBySlug(name)
+}
+
+// parseRooms resolves the 8 rooms of a seed, the finish room isn't part of it
+func parseRooms(names []string) ([]string, error) {
+	if len(names) != 8 {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRooms, Message: fmt.Sprintf("a seed has 8 rooms, got %d", len(names))}
+	}
+
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		key, exists := resolveRoom(name)
+		if !exists || key == "finish room" {
+			return nil, &apiError{Status: http.StatusBadRequest, Code: codeUnknownRoom, Message: fmt.Sprintf("unknown room \"%s\"", name)}
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// seedID is stateless, the seed can always be rebuilt from it
+func seedID(keys []string) string {
+	return calc.SeedID(keys)
+}
+
+func parseSeedID(id string) ([]string, error) {
+	keys, err := parseRooms(strings.Split(id, calc.SeedIDSeparator))
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return nil, &apiError{Status: http.StatusNotFound, Code: codeInvalidSeed, Message: fmt.Sprintf("\"%s\" isn't a seed id: %s", id, apiErr.Message)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// rankedResults calcs a seed through the result cache, the results are sorted from fastest to slowest and must not be modified
+func rankedResults(keys []string, splits map[string]calc.Room) ([]calc.CalcSeedResult, error) {
+	rooms := append(append(make([]string, 0, len(keys)+1), keys...), "finish room")
+
+	results, err := calc.Results.CalcSeedCustom(rooms, splits)
+	if err != nil {
+		return nil, fmt.Errorf("error calculating seed: %w", err)
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no results found for the given rooms")
+	}
+
+	return results, nil
+}
+
+func resultResource(keys []string, rank int, res calc.CalcSeedResult, splits map[string]calc.Room) ResultResource {
+	rooms := append(append(make([]string, 0, len(keys)+1), keys...), "finish room")
+
+	boosts := make([]BoostResource, 0, len(res.BoostRooms))
+	for _, br := range res.BoostRooms {
+		key := rooms[br.Ind]
+		boosts = append(boosts, BoostResource{
+			Index:      br.Ind,
+			Room:       roomRef(key),
+			StratIndex: br.StratInd,
+			Strat:      splits[key].BoostStrats[br.StratInd].Name,
+			Pacelock:   newTime(br.Pacelock),
+		})
+	}
+
+	return ResultResource{
+		Rank:          rank,
+		BoostTime:     newTime(res.BoostTime),
+		BoostlessTime: newTime(res.BoostlessTime),
+		Boosts:        boosts,
+	}
+}
+
+func seedResource(keys []string) (SeedResource, error) {
+	results, err := rankedResults(keys, calc.RoomMap)
+	if err != nil {
+		return SeedResource{}, err
+	}
+
+	return newSeedResource(keys, results[0]), nil
+}
+
+// newSeedResource is seedResource for seeds that were already calced with the default splits
+func newSeedResource(keys []string, best calc.CalcSeedResult) SeedResource {
+	seed := SeedResource{
+		ID:    seedID(keys),
+		Rooms: make([]RoomRef, 0, len(keys)),
+		Best:  resultResource(keys, 1, best, calc.RoomMap),
+	}
+	for _, key := range keys {
+		seed.Rooms = append(seed.Rooms, roomRef(key))
+	}
+
+	return seed
+}
+
+func roomResource(key string) RoomResource {
+	room := calc.RoomMap[key]
+
+	res := RoomResource{
+		ID:            roomSlug(key),
+		Name:          room.Name,
+		Aliases:       calc.AliasesOf(key),
+		BoostlessTime: newTime(room.BoostlessTime),
+		BoostStrats:   make([]StratResource, 0, len(room.BoostStrats)),
+		Timesaves:     make([]TimesaveResource, 0),
+	}
+	for i, strat := range room.BoostStrats {
+		res.BoostStrats = append(res.BoostStrats, StratResource{
+			Index:   i,
+			Name:    strat.Name,
+			Time:    newTime(strat.Time),
+			BoostAt: newTime(strat.BoostTime),
+			Quality: strat.Quality.String(),
+		})
+	}
+
+	for _, rule := range calc.TimesaveRules {
+		if rule.After == key {
+			res.Timesaves = append(res.Timesaves, timesaveResource(rule))
+		}
+	}
+
+	return res
+}
+
+func timesaveResource(rule calc.TimesaveRule) TimesaveResource {
+	res := TimesaveResource{Name: rule.Name, Timesave: newTime(rule.Timesave)}
+	if rule.After != "" {
+		after := roomRef(rule.After)
+		res.After = &after
+	}
+	if rule.Boosted {
+		res.Strat = calc.RoomMap[rule.After].BoostStrats[rule.StratInd].Name
+	}
+
+	return res
+}
+
+func splitsResource(key string) SplitsResource {
+	res := SplitsResource{
+		Room:     roomRef(key),
+		Segments: make([]SegmentResource, 0, len(calc.RoomMap[key].Segments)),
+	}
+
+	for _, seg := range calc.RoomMap[key].Segments {
+		sr := SegmentResource{Name: seg.Name, Time: newTime(seg.Time)}
+		if seg.BoostedTime != 0 {
+			boosted := newTime(seg.BoostedTime)
+			boostAt := seg.BoostAt
+			sr.BoostedTime = &boosted
+			sr.BoostAt = &boostAt
+		}
+		for _, v := range seg.Variants {
+			sr.Variants = append(sr.Variants, VariantResource{Name: v.Name, BoostedTime: newTime(v.BoostedTime), BoostAt: v.BoostAt})
+		}
+		res.Segments = append(res.Segments, sr)
+	}
+
+	return res
+}
+
+// sortedRoomKeys lists every room including the finish room, like /allsplits
+func sortedRoomKeys() []string {
+	keys := make([]string, 0, len(calc.RoomMap))
+	for key := range calc.RoomMap {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return strings.Compare(calc.RoomMap[a].Name, calc.RoomMap[b].Name)
+	})
+	return keys
+}
+
+func pageParams(r *http.Request) (page, perPage int, err error) {
+	page, perPage = 1, defaultPerPage
+
+	if v := r.FormValue("page"); v != "" {
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			return 0, 0, &apiError{Status: http.StatusBadRequest, Code: codeInvalidPagination, Message: "page has to be a positive number"}
+		}
+	}
+
+	if v := r.FormValue("per_page"); v != "" {
+		if perPage, err = strconv.Atoi(v); err != nil || perPage < 1 || perPage > maxPerPage {
+			return 0, 0, &apiError{Status: http.StatusBadRequest, Code: codeInvalidPagination, Message: fmt.Sprintf("per_page has to be between 1 and %d", maxPerPage)}
+		}
+	}
+
+	return page, perPage, nil
+}
+
+// boostsFilter reads the boosts query param, 0 means results with any number of boosts
+func boostsFilter(r *http.Request) (int, error) {
+	switch v := r.FormValue("boosts"); v {
+	case "", "any":
+		return 0, nil
+	case "2", "3":
+		return int(v[0] - '0'), nil
+	default:
+		return 0, &apiError{Status: http.StatusBadRequest, Code: codeInvalidFilter, Message: "boosts has to be 2, 3 or any"}
+	}
+}
+
+func roomsV2Handler(w http.ResponseWriter, r *http.Request) {
+	keys := sortedRoomKeys()
+	rooms := make([]RoomResource, 0, len(keys))
+	for _, key := range keys {
+		rooms = append(rooms, roomResource(key))
+	}
+
+	writeCachedJSON(w, r, rooms)
+}
+
+func roomV2Handler(w http.ResponseWriter, r *http.Request) {
+	key, exists := resolveRoom(mux.Vars(r)["room"])
+	if !exists {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: codeUnknownRoom, Message: fmt.Sprintf("unknown room \"%s\"", mux.Vars(r)["room"])})
+		return
+	}
+
+	writeCachedJSON(w, r, roomResource(key))
+}
+
+func splitsV2Handler(w http.ResponseWriter, r *http.Request) {
+	keys := sortedRoomKeys()
+	splits := make([]SplitsResource, 0, len(keys))
+	for _, key := range keys {
+		splits = append(splits, splitsResource(key))
+	}
+
+	writeCachedJSON(w, r, splits)
+}
+
+func roomSplitsV2Handler(w http.ResponseWriter, r *http.Request) {
+	key, exists := resolveRoom(mux.Vars(r)["room"])
+	if !exists {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: codeUnknownRoom, Message: fmt.Sprintf("unknown room \"%s\"", mux.Vars(r)["room"])})
+		return
+	}
+
+	writeCachedJSON(w, r, splitsResource(key))
+}
+
+func createSeedV2Handler(w http.ResponseWriter, r *http.Request) {
+	var req SeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidBody, Message: fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	keys, err := parseRooms(req.Rooms)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	seed, err := seedResource(keys)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v2/seeds/"+seed.ID)
+	writeJSON(w, http.StatusCreated, seed)
+}
+
+func seedV2Handler(w http.ResponseWriter, r *http.Request) {
+	keys, err := parseSeedID(mux.Vars(r)["seed"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	seed, err := seedResource(keys)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, seed)
+}
+
+// resultsV2Handler serves the ranked results of a seed, POSTing custom splits calcs the seed with them instead
+func resultsV2Handler(w http.ResponseWriter, r *http.Request) {
+	keys, err := parseSeedID(mux.Vars(r)["seed"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	page, perPage, err := pageParams(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	boosts, err := boostsFilter(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	splits := calc.RoomMap
+	if r.Method == http.MethodPost {
+		var req CustomResultsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidBody, Message: fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+
+		custom, err := calc.LoadSplits(bytes.NewReader(req.Splits))
+		if err != nil {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidSplits, Message: err.Error()})
+			return
+		}
+		splits = calc.MergeSplits(custom)
+	}
+
+	results, err := rankedResults(keys, splits)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	ranked := make([]ResultResource, 0, len(results))
+	for i, res := range results {
+		if boosts != 0 && len(res.BoostRooms) != boosts {
+			continue
+		}
+		ranked = append(ranked, resultResource(keys, i+1, res, splits))
+	}
+
+	resp := ResultPage{
+		SeedID:  seedID(keys),
+		Results: []ResultResource{},
+		Page:    page,
+		PerPage: perPage,
+		Total:   len(ranked),
+	}
+	if start := (page - 1) * perPage; start < len(ranked) {
+		resp.Results = ranked[start:min(start+perPage, len(ranked))]
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func explanationV2Handler(w http.ResponseWriter, r *http.Request) {
+	keys, err := parseSeedID(mux.Vars(r)["seed"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	results, err := rankedResults(keys, calc.RoomMap)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	rank, err := strconv.Atoi(mux.Vars(r)["rank"])
+	if err != nil || rank < 1 || rank > len(results) {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: fmt.Sprintf("the seed has results ranked 1 to %d", len(results))})
+		return
+	}
+
+	rooms := append(append(make([]string, 0, len(keys)+1), keys...), "finish room")
+	exp, err := calc.Explain(rooms, results[rank-1], calc.RoomMap)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp := ExplanationResource{
+		SeedID:        seedID(keys),
+		Rank:          rank,
+		Rooms:         make([]ExplainedRoom, 0, len(exp.Rooms)),
+		BoostTime:     newTime(exp.BoostTime),
+		BoostlessTime: newTime(exp.BoostlessTime),
+	}
+	for _, re := range exp.Rooms {
+		er := ExplainedRoom{
+			Index:             re.Index,
+			Room:              roomRef(re.Room),
+			BoostlessTime:     newTime(re.BoostlessTime),
+			Boosted:           re.Boosted,
+			Strat:             re.Strat,
+			Pacelock:          newTime(re.Pacelock),
+			Timesave:          newTime(re.Timesave),
+			BoostlessTimesave: newTime(re.BoostlessTimesave),
+			Time:              newTime(re.Time),
+			BoostlessRunTime:  newTime(re.BoostlessRunTime),
+		}
+		if re.Boosted {
+			before, after := newTime(re.BeforeBoost), newTime(re.AfterBoost)
+			er.BeforeBoost, er.AfterBoost = &before, &after
+		}
+		resp.Rooms = append(resp.Rooms, er)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func timesavesV2Handler(w http.ResponseWriter, r *http.Request) {
+	timesaves := make([]TimesaveResource, 0, len(calc.TimesaveRules))
+	for _, rule := range calc.TimesaveRules {
+		timesaves = append(timesaves, timesaveResource(rule))
+	}
+
+	writeCachedJSON(w, r, timesaves)
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeCachedJSON(w, r, json.RawMessage(openAPISpec))
+}
+
+// registerV2 adds the /api/v2 routes, everything under it answers with ErrorResponse on errors
+func (srv *Server) registerV2(r *mux.Router) {
+	v2 := r.PathPrefix("/api/v2").Subrouter()
+
+	v2.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
+	v2.HandleFunc("/rooms", roomsV2Handler).Methods("GET")
+	v2.HandleFunc("/rooms/{room}", roomV2Handler).Methods("GET")
+	v2.HandleFunc("/splits", splitsV2Handler).Methods("GET")
+	v2.HandleFunc("/splits/{room}", roomSplitsV2Handler).Methods("GET")
+	v2.HandleFunc("/timesaves", timesavesV2Handler).Methods("GET")
+	v2.HandleFunc("/seeds", createSeedV2Handler).Methods("POST")
+	v2.HandleFunc("/seeds/batch", batchV2Handler).Methods("POST")
+	v2.HandleFunc("/seeds/{seed}", seedV2Handler).Methods("GET")
+	v2.HandleFunc("/seeds/{seed}/results", resultsV2Handler).Methods("GET", "POST")
+	v2.HandleFunc("/seeds/{seed}/results/{rank}/explanation", explanationV2Handler).Methods("GET")
+	v2.HandleFunc("/seeds/{seed}/image.png", seedImageV2Handler("png")).Methods("GET")
+	v2.HandleFunc("/seeds/{seed}/image.svg", seedImageV2Handler("svg")).Methods("GET")
+	v2.HandleFunc("/feed", srv.feedSSEHandler).Methods("GET")
+	v2.HandleFunc("/feed/ws", srv.feedWSHandler).Methods("GET")
+	v2.HandleFunc("/lobbies", srv.lobbiesV2Handler).Methods("GET")
+	v2.HandleFunc("/leaderboard", srv.leaderboardV2Handler).Methods("GET")
+
+	v2.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: fmt.Sprintf("%s doesn't exist", r.URL.Path)})
+	})
+	v2.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, &apiError{Status: http.StatusMethodNotAllowed, Code: codeMethodNotAllowed, Message: fmt.Sprintf("%s doesn't support %s", r.URL.Path, r.Method)})
+	})
+}
@@ -0,0 +1,226 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"pkd-bot/calc"
+	"pkd-bot/server"
+
+	"github.com/gorilla/mux"
+)
+
+const testSeedID = "around-pillars.blocks.fences.fortress.ice.early-3-plus-1.underbridge.sandpit"
+
+func get(t *testing.T, url string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	testServer.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder, wantStatus int) T {
+	t.Helper()
+
+	if rec.Code != wantStatus {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, wantStatus, rec.Body)
+	}
+
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestCreateSeed(t *testing.T) {
+	rec := postJSON(t, "/api/v2/seeds", server.SeedRequest{
+		Rooms: []string{"Around Pillars", "blocks", "fences", "Fortress", "ice", "Early 3-1", "underbridge", "sandpit"},
+	})
+	seed := decode[server.SeedResource](t, rec, http.StatusCreated)
+
+	if seed.ID != testSeedID {
+		t.Errorf("got seed id %q, want %q", seed.ID, testSeedID)
+	}
+	if rec.Header().Get("Location") != "/api/v2/seeds/"+testSeedID {
+		t.Errorf("unexpected location %q", rec.Header().Get("Location"))
+	}
+	if seed.Best.Rank != 1 || seed.Best.BoostTime.Seconds <= 0 || seed.Best.BoostTime.Formatted == "" {
+		t.Errorf("unexpected best result %+v", seed.Best)
+	}
+
+	again := decode[server.SeedResource](t, get(t, "/api/v2/seeds/"+seed.ID), http.StatusOK)
+	if again.Best.BoostTime != seed.Best.BoostTime {
+		t.Errorf("the seed id gave a different seed: %+v vs %+v", again.Best, seed.Best)
+	}
+}
+
+func TestResultsArePaginated(t *testing.T) {
+	all := decode[server.ResultPage](t, get(t, "/api/v2/seeds/"+testSeedID+"/results?per_page=100"), http.StatusOK)
+	if all.Total < 2 {
+		t.Fatalf("expected several results, got %d", all.Total)
+	}
+	for i := 1; i < len(all.Results); i++ {
+		if all.Results[i].BoostTime.Seconds < all.Results[i-1].BoostTime.Seconds {
+			t.Errorf("results aren't ranked: #%d is faster than #%d", all.Results[i].Rank, all.Results[i-1].Rank)
+		}
+	}
+
+	second := decode[server.ResultPage](t, get(t, "/api/v2/seeds/"+testSeedID+"/results?page=2&per_page=1"), http.StatusOK)
+	if len(second.Results) != 1 || second.Results[0].Rank != all.Results[1].Rank {
+		t.Errorf("page 2 should hold the second result, got %+v", second.Results)
+	}
+
+	three := decode[server.ResultPage](t, get(t, "/api/v2/seeds/"+testSeedID+"/results?boosts=3&per_page=100"), http.StatusOK)
+	for _, res := range three.Results {
+		if len(res.Boosts) != 3 {
+			t.Errorf("result #%d has %d boosts", res.Rank, len(res.Boosts))
+		}
+	}
+}
+
+func TestExplanation(t *testing.T) {
+	seed := decode[server.SeedResource](t, get(t, "/api/v2/seeds/"+testSeedID), http.StatusOK)
+	exp := decode[server.ExplanationResource](t, get(t, "/api/v2/seeds/"+testSeedID+"/results/1/explanation"), http.StatusOK)
+
+	if len(exp.Rooms) != 9 {
+		t.Errorf("expected 9 rooms, got %d", len(exp.Rooms))
+	}
+	if exp.BoostTime.Formatted != seed.Best.BoostTime.Formatted {
+		t.Errorf("explanation adds up to %s, the seed takes %s", exp.BoostTime.Formatted, seed.Best.BoostTime.Formatted)
+	}
+}
+
+func TestV2Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		rec    *httptest.ResponseRecorder
+		status int
+		code   string
+	}{
+		{"too few rooms", postJSON(t, "/api/v2/seeds", server.SeedRequest{Rooms: []string{"blocks"}}), http.StatusBadRequest, "invalid_rooms"},
+		{"unknown room", postJSON(t, "/api/v2/seeds", server.SeedRequest{Rooms: []string{"nope", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"}}), http.StatusBadRequest, "unknown_room"},
+		{"bad seed id", get(t, "/api/v2/seeds/blocks.fences"), http.StatusNotFound, "invalid_seed"},
+		{"bad page", get(t, "/api/v2/seeds/"+testSeedID+"/results?page=0"), http.StatusBadRequest, "invalid_pagination"},
+		{"bad filter", get(t, "/api/v2/seeds/"+testSeedID+"/results?boosts=4"), http.StatusBadRequest, "invalid_filter"},
+		{"bad rank", get(t, "/api/v2/seeds/"+testSeedID+"/results/0/explanation"), http.StatusNotFound, "not_found"},
+		{"unknown room resource", get(t, "/api/v2/rooms/nope"), http.StatusNotFound, "unknown_room"},
+		{"unknown route", get(t, "/api/v2/nope"), http.StatusNotFound, "not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := decode[server.ErrorResponse](t, tt.rec, tt.status)
+			if resp.Error == nil {
+				t.Fatal("expected an error")
+			}
+			if resp.Error.Code != tt.code {
+				t.Errorf("got code %s, want %s", resp.Error.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestRooms(t *testing.T) {
+	rooms := decode[[]server.RoomResource](t, get(t, "/api/v2/rooms"), http.StatusOK)
+	if len(rooms) != len(calc.RoomMap) {
+		t.Errorf("expected all %d rooms like /allsplits, got %d", len(calc.RoomMap), len(rooms))
+	}
+
+	room := decode[server.RoomResource](t, get(t, "/api/v2/rooms/early-3-plus-1"), http.StatusOK)
+	if room.Name != "Early 3+1" || len(room.BoostStrats) == 0 {
+		t.Errorf("unexpected room %+v", room)
+	}
+	if !slices.Contains(room.Aliases, "early 3-1") {
+		t.Errorf("expected the ChatTriggers name as an alias, got %v", room.Aliases)
+	}
+	if len(room.Timesaves) != 1 || room.Timesaves[0].Strat == "" {
+		t.Errorf("expected the boost dependent early 3+1 timesave, got %+v", room.Timesaves)
+	}
+
+	byAlias := decode[server.RoomResource](t, get(t, "/api/v2/rooms/Early%203-1"), http.StatusOK)
+	if byAlias.ID != room.ID {
+		t.Errorf("the alias resolved to %s", byAlias.ID)
+	}
+
+	splits := decode[server.SplitsResource](t, get(t, "/api/v2/splits/Early%203+1"), http.StatusOK)
+	if len(splits.Segments) == 0 {
+		t.Errorf("expected segments, got %+v", splits)
+	}
+
+	timesaves := decode[[]server.TimesaveResource](t, get(t, "/api/v2/timesaves"), http.StatusOK)
+	if len(timesaves) != len(calc.TimesaveRules) || timesaves[0].After != nil {
+		t.Errorf("unexpected timesaves %+v", timesaves)
+	}
+}
+
+func TestETag(t *testing.T) {
+	first := get(t, "/api/v2/rooms")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected an ETag, got status %d and %q", first.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/rooms", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec := httptest.NewRecorder()
+	testServer.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("got status %d with %d bytes, want an empty 304", rec.Code, rec.Body.Len())
+	}
+
+	if get(t, "/api/v2/splits").Header().Get("ETag") == etag {
+		t.Error("different resources share an ETag")
+	}
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	spec := decode[struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}](t, get(t, "/api/v2/openapi.json"), http.StatusOK)
+
+	testServer.Router().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, "/api/v2/") {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		for _, method := range methods {
+			if _, documented := spec.Paths[strings.TrimPrefix(path, "/api/v2")][strings.ToLower(method)]; !documented {
+				t.Errorf("%s %s isn't in the OpenAPI document", method, path)
+			}
+		}
+		return nil
+	})
+}
+
+func TestSeedImage(t *testing.T) {
+	rec := get(t, "/api/v2/seeds/"+testSeedID+"/image.png?boosts=3&index=1")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("got status %d, content type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	if !bytes.HasPrefix(rec.Body.Bytes(), []byte("\x89PNG")) {
+		t.Error("the body isn't a png")
+	}
+
+	rec = get(t, "/api/v2/seeds/"+testSeedID+"/image.svg")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("got status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	resp := decode[server.ErrorResponse](t, get(t, "/api/v2/seeds/"+testSeedID+"/image.png?index=100000"), http.StatusNotFound)
+	if resp.Error.Code != "not_found" {
+		t.Errorf("got code %s, want not_found", resp.Error.Code)
+	}
+}
@@ -0,0 +1,86 @@
+package state
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the states until the bot stops
+type MemoryStore struct {
+	mu       sync.RWMutex
+	messages map[string]Message
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{messages: make(map[string]Message)}
+}
+
+func (ms *MemoryStore) Get(messageID string) (Message, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	m, exists := ms.messages[messageID]
+	if !exists {
+		return Message{}, ErrNotFound
+	}
+	return m.clone(), nil
+}
+
+func (ms *MemoryStore) Put(m Message) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.messages[m.MessageID] = m.clone()
+	return nil
+}
+
+func (ms *MemoryStore) Delete(messageID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.messages, messageID)
+	return nil
+}
+
+func (ms *MemoryStore) Expired(now time.Time) ([]Message, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	expired := make([]Message, 0)
+	for _, m := range ms.messages {
+		if !m.Expires.After(now) {
+			expired = append(expired, m.clone())
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].Expires.Before(expired[j].Expires)
+	})
+	return expired, nil
+}
+
+func (ms *MemoryStore) All() ([]Message, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	all := make([]Message, 0, len(ms.messages))
+	for _, m := range ms.messages {
+		all = append(all, m.clone())
+	}
+	return all, nil
+}
+
+func (ms *MemoryStore) Len() (int, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return len(ms.messages), nil
+}
+
+func (ms *MemoryStore) Durable() bool {
+	return false
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,57 @@
+package state
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// Stage is how far a message's buttons are along in being taken away, it happens in steps
+type Stage int
+
+const (
+	// StageNavigation messages have all their buttons
+	StageNavigation Stage = iota
+	// StageShowCalc messages only have "How did you get this?" left
+	StageShowCalc
+)
+
+var ErrNotFound = errors.New("message state not found")
+
+// Message is the state behind the buttons of a seed message. It's written on every click, so it only keeps what
+// the results are calced again from
+type Message struct {
+	MessageID string
+	ChannelID string
+	Rooms     []string
+	Index     int
+	Filter    string
+	// ShowCalcMessageID is where "How did you get this?" sent the calc, it's edited instead of sending another one
+	ShowCalcMessageID string
+	Stage             Stage
+	// Expires is when the buttons of the current stage are taken away
+	Expires time.Time
+}
+
+// Store keeps the states of the messages with buttons. It's used from the button handlers, the announcements and
+// the cleanups at once, so implementations have to be safe for concurrent use
+type Store interface {
+	// Get returns ErrNotFound if the message has no state
+	Get(messageID string) (Message, error)
+	// Put adds or replaces the state of m.MessageID
+	Put(m Message) error
+	Delete(messageID string) error
+	// Expired lists the states that expire at or before now, the soonest first
+	Expired(now time.Time) ([]Message, error)
+	All() ([]Message, error)
+	Len() (int, error)
+	// Durable stores keep the states over restarts
+	Durable() bool
+	Close() error
+}
+
+// clone copies the rooms, callers could append to them
+func (m Message) clone() Message {
+	m.Rooms = slices.Clip(slices.Clone(m.Rooms))
+	return m
+}
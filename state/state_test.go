@@ -0,0 +1,31 @@
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	"pkd-bot/state"
+	"pkd-bot/state/statetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	statetest.TestStore(t, state.NewMemoryStore())
+}
+
+func TestMemoryStoreCopies(t *testing.T) {
+	store := state.NewMemoryStore()
+	m := statetest.Message("1", time.Now())
+	store.Put(m)
+
+	m.Rooms[0] = "changed"
+	got, _ := store.Get("1")
+	if got.Rooms[0] != "around pillars" {
+		t.Error("changing the message after putting it changed the stored state")
+	}
+
+	got.Rooms = append(got.Rooms, "finish room")
+	again, _ := store.Get("1")
+	if len(again.Rooms) != 8 {
+		t.Error("appending to a state's rooms changed the stored state")
+	}
+}
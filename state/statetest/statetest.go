@@ -0,0 +1,92 @@
+package statetest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"pkd-bot/state"
+)
+
+func Message(id string, expires time.Time) state.Message {
+	return state.Message{
+		MessageID: id,
+		ChannelID: "channel",
+		Rooms:     []string{"around pillars", "blocks", "fences", "fortress", "ice", "early 3+1", "underbridge", "sandpit"},
+		Filter:    "any",
+		Stage:     state.StageNavigation,
+		Expires:   expires,
+	}
+}
+
+// TestStore checks that a state.Store keeps, replaces, expires and deletes states, also when used concurrently.
+// The store has to be empty
+func TestStore(t *testing.T, store state.Store) {
+	t.Helper()
+
+	now := time.Now()
+	if _, err := store.Get("1"); !errors.Is(err, state.ErrNotFound) {
+		t.Fatalf("got %v for a missing state, want ErrNotFound", err)
+	}
+
+	for _, m := range []state.Message{Message("1", now.Add(-time.Minute)), Message("2", now.Add(-2*time.Minute)), Message("3", now.Add(time.Minute))} {
+		if err := store.Put(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	updated := Message("3", now.Add(time.Minute))
+	updated.Index = 2
+	updated.ShowCalcMessageID = "calc"
+	if err := store.Put(updated); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get("3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Index != 2 || got.ShowCalcMessageID != "calc" || len(got.Rooms) != 8 || !got.Expires.Equal(updated.Expires) {
+		t.Errorf("got %+v, want %+v", got, updated)
+	}
+
+	expired, err := store.Expired(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 2 || expired[0].MessageID != "2" || expired[1].MessageID != "1" {
+		t.Errorf("got %+v, want states 2 and 1 to be expired", expired)
+	}
+
+	if err := store.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := store.Len(); err != nil || count != 2 {
+		t.Errorf("got %d states (%v), want 2", count, err)
+	}
+	if all, err := store.All(); err != nil || len(all) != 2 {
+		t.Errorf("got %d states (%v), want 2", len(all), err)
+	}
+	store.Delete("2")
+	store.Delete("3")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				store.Put(Message(id, time.Now()))
+				store.Get(id)
+				store.Expired(time.Now())
+				store.Len()
+			}
+			store.Delete(id)
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+
+	if count, err := store.Len(); err != nil || count != 0 {
+		t.Errorf("got %d states (%v) after deleting all of them", count, err)
+	}
+}
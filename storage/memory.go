@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/state"
+)
+
+type storedSplits struct {
+	splits  map[string]calc.PkdutilsSplit
+	updated time.Time
+}
+
+// MemoryStore keeps everything until the process stops, it's meant for tests
+type MemoryStore struct {
+	mu            sync.Mutex
+	submissions   []Submission
+	announcements []Announcement
+	splits        map[string]storedSplits
+	tournaments   map[string]Tournament
+	guilds        map[string]GuildSettings
+	tierRoles     []TierRole
+	subscriptions map[string]Subscription
+	states        *state.MemoryStore
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		splits:        make(map[string]storedSplits),
+		tournaments:   make(map[string]Tournament),
+		guilds:        make(map[string]GuildSettings),
+		subscriptions: make(map[string]Subscription),
+		states:        state.NewMemoryStore(),
+	}
+}
+
+func (ms *MemoryStore) AddSubmission(ctx context.Context, sub *Submission) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	sub.ID = int64(len(ms.submissions) + 1)
+	ms.submissions = append(ms.submissions, cloneSubmission(*sub))
+	return nil
+}
+
+func cloneSubmission(sub Submission) Submission {
+	sub.Rooms = slices.Clone(sub.Rooms)
+	sub.Plan = slices.Clone(sub.Plan)
+	return sub
+}
+
+func (ms *MemoryStore) GetSubmission(ctx context.Context, id int64) (Submission, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if id < 1 || id > int64(len(ms.submissions)) {
+		return Submission{}, ErrNotFound
+	}
+	return cloneSubmission(ms.submissions[id-1]), nil
+}
+
+// filterSubmissions expects ms.mu to be held
+func (ms *MemoryStore) filterSubmissions(filter SubmissionFilter) []Submission {
+	// the first submission of every seed in a lobby, like the sql store they're compared with all submissions
+	first := make(map[string]Submission)
+	if filter.FirstPerLobby {
+		for _, sub := range ms.submissions {
+			key := calc.SeedID(sub.Rooms) + "|" + strings.ToLower(sub.Lobby)
+			if f, exists := first[key]; !exists || sub.At.Before(f.At) {
+				first[key] = sub
+			}
+		}
+	}
+
+	subs := make([]Submission, 0)
+	for i := len(ms.submissions) - 1; i >= 0; i-- {
+		sub := ms.submissions[i]
+		if filter.Ign != "" && !strings.EqualFold(sub.Ign, filter.Ign) {
+			continue
+		}
+		if !filter.Since.IsZero() && sub.At.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && !sub.At.Before(filter.Until) {
+			continue
+		}
+		if filter.MaxTime > 0 && sub.BoostTime > filter.MaxTime {
+			continue
+		}
+		if filter.Room != "" && !slices.Contains(sub.Rooms, filter.Room) {
+			continue
+		}
+		if filter.NoDebug && sub.Debug {
+			continue
+		}
+		if filter.FirstPerLobby && first[calc.SeedID(sub.Rooms)+"|"+strings.ToLower(sub.Lobby)].ID != sub.ID {
+			continue
+		}
+		subs = append(subs, cloneSubmission(sub))
+	}
+
+	// the newest first like the sql store, submissions aren't always added in the order they happened
+	sort.SliceStable(subs, func(i, j int) bool {
+		return subs[i].At.After(subs[j].At)
+	})
+	return subs
+}
+
+func (ms *MemoryStore) ListSubmissions(ctx context.Context, filter SubmissionFilter) ([]Submission, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	subs := ms.filterSubmissions(filter)
+	if filter.Limit > 0 {
+		subs = subs[min(filter.Offset, len(subs)):]
+		subs = subs[:min(filter.Limit, len(subs))]
+	}
+	return subs, nil
+}
+
+func (ms *MemoryStore) CountSubmissions(ctx context.Context, filter SubmissionFilter) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return len(ms.filterSubmissions(filter)), nil
+}
+
+func (ms *MemoryStore) FinderStats(ctx context.Context, filter SubmissionFilter) ([]FinderStats, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	byIgn := make(map[string]*FinderStats)
+	for _, sub := range ms.filterSubmissions(filter) {
+		key := strings.ToLower(sub.Ign)
+		st, exists := byIgn[key]
+		if !exists {
+			st = &FinderStats{Ign: sub.Ign, BestTime: sub.BoostTime}
+			byIgn[key] = st
+		}
+		// the sum until the average is taken below
+		st.Ign = min(st.Ign, sub.Ign)
+		st.Seeds++
+		st.AverageTime += sub.BoostTime
+		st.BestTime = min(st.BestTime, sub.BoostTime)
+		if slices.ContainsFunc(ms.announcements, func(a Announcement) bool {
+			return slices.Equal(a.Rooms, sub.Rooms) && strings.EqualFold(a.Lobby, sub.Lobby)
+		}) {
+			st.Announced++
+		}
+	}
+
+	stats := make([]FinderStats, 0, len(byIgn))
+	for _, st := range byIgn {
+		st.AverageTime /= float64(st.Seeds)
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return strings.ToLower(stats[i].Ign) < strings.ToLower(stats[j].Ign)
+	})
+	return stats, nil
+}
+
+func (ms *MemoryStore) AddAnnouncement(ctx context.Context, a *Announcement) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	a.ID = int64(len(ms.announcements) + 1)
+	stored := *a
+	stored.Rooms = slices.Clone(a.Rooms)
+	ms.announcements = append(ms.announcements, stored)
+	return nil
+}
+
+func (ms *MemoryStore) AnnouncementsSince(ctx context.Context, since time.Time) ([]Announcement, error) {
+	return ms.listAnnouncements(func(a Announcement) bool { return !a.At.Before(since) }), nil
+}
+
+func (ms *MemoryStore) SeedAnnouncements(ctx context.Context, rooms []string, lobby string) ([]Announcement, error) {
+	return ms.listAnnouncements(func(a Announcement) bool {
+		return slices.Equal(a.Rooms, rooms) && strings.EqualFold(a.Lobby, lobby)
+	}), nil
+}
+
+func (ms *MemoryStore) listAnnouncements(matches func(a Announcement) bool) []Announcement {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	announcements := make([]Announcement, 0)
+	for i := len(ms.announcements) - 1; i >= 0; i-- {
+		a := ms.announcements[i]
+		if !matches(a) {
+			continue
+		}
+		a.Rooms = slices.Clone(a.Rooms)
+		announcements = append(announcements, a)
+	}
+
+	sort.SliceStable(announcements, func(i, j int) bool {
+		return announcements[i].At.After(announcements[j].At)
+	})
+	return announcements
+}
+
+func (ms *MemoryStore) PutSplits(ctx context.Context, ign string, splits map[string]calc.PkdutilsSplit) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.splits[strings.ToLower(ign)] = storedSplits{splits: copySplits(splits), updated: time.Now()}
+	return nil
+}
+
+func (ms *MemoryStore) GetSplits(ctx context.Context, ign string) (map[string]calc.PkdutilsSplit, time.Time, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stored, exists := ms.splits[strings.ToLower(ign)]
+	if !exists {
+		return nil, time.Time{}, ErrNotFound
+	}
+	return copySplits(stored.splits), stored.updated, nil
+}
+
+func copySplits(splits map[string]calc.PkdutilsSplit) map[string]calc.PkdutilsSplit {
+	copied := make(map[string]calc.PkdutilsSplit, len(splits))
+	for key, split := range splits {
+		split.BoostStrats = slices.Clone(split.BoostStrats)
+		copied[key] = split
+	}
+	return copied
+}
+
+func (ms *MemoryStore) AddTournament(ctx context.Context, t Tournament) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, exists := ms.tournaments[t.ID]; exists {
+		return fmt.Errorf("failed to save tournament %s: it already exists", t.ID)
+	}
+	t.Participants = slices.Clone(t.Participants)
+	ms.tournaments[t.ID] = t
+	return nil
+}
+
+func (ms *MemoryStore) GetTournament(ctx context.Context, id string) (Tournament, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	t, exists := ms.tournaments[id]
+	if !exists {
+		return Tournament{}, ErrNotFound
+	}
+
+	participants := append(make([]Participant, 0, len(t.Participants)), t.Participants...)
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].InGameNick < participants[j].InGameNick
+	})
+	t.Participants = participants
+	return t, nil
+}
+
+func (ms *MemoryStore) PutGuildSettings(ctx context.Context, settings *GuildSettings) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	settings.UpdatedAt = time.Now()
+	ms.guilds[settings.GuildID] = *settings
+	return nil
+}
+
+func (ms *MemoryStore) GetGuildSettings(ctx context.Context, guildID string) (GuildSettings, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	settings, exists := ms.guilds[guildID]
+	if !exists {
+		return GuildSettings{}, ErrNotFound
+	}
+	return settings, nil
+}
+
+func (ms *MemoryStore) DeleteGuildSettings(ctx context.Context, guildID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.guilds, guildID)
+	return nil
+}
+
+func (ms *MemoryStore) PutTierRole(ctx context.Context, role TierRole) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.tierRoles = slices.DeleteFunc(ms.tierRoles, func(r TierRole) bool {
+		return r.GuildID == role.GuildID && r.MaxTime == role.MaxTime
+	})
+	ms.tierRoles = append(ms.tierRoles, role)
+	return nil
+}
+
+func (ms *MemoryStore) DeleteTierRole(ctx context.Context, guildID string, maxTime float64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.tierRoles = slices.DeleteFunc(ms.tierRoles, func(r TierRole) bool {
+		return r.GuildID == guildID && r.MaxTime == maxTime
+	})
+	return nil
+}
+
+func (ms *MemoryStore) TierRoles(ctx context.Context, guildID string) ([]TierRole, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	roles := make([]TierRole, 0)
+	for _, role := range ms.tierRoles {
+		if role.GuildID == guildID {
+			roles = append(roles, role)
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].MaxTime < roles[j].MaxTime
+	})
+	return roles, nil
+}
+
+func (ms *MemoryStore) PutSubscription(ctx context.Context, sub *Subscription) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	sub.UpdatedAt = time.Now()
+	ms.subscriptions[sub.UserID] = copySubscription(*sub)
+	return nil
+}
+
+func (ms *MemoryStore) GetSubscription(ctx context.Context, userID string) (Subscription, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	sub, exists := ms.subscriptions[userID]
+	if !exists {
+		return Subscription{}, ErrNotFound
+	}
+	return copySubscription(sub), nil
+}
+
+func (ms *MemoryStore) DeleteSubscription(ctx context.Context, userID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.subscriptions, userID)
+	return nil
+}
+
+func (ms *MemoryStore) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	subs := make([]Subscription, 0, len(ms.subscriptions))
+	for _, sub := range ms.subscriptions {
+		subs = append(subs, copySubscription(sub))
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].UserID < subs[j].UserID
+	})
+	return subs, nil
+}
+
+func copySubscription(sub Subscription) Subscription {
+	sub.Rooms = slices.Clone(sub.Rooms)
+	sub.ExcludedRooms = slices.Clone(sub.ExcludedRooms)
+	sub.Igns = slices.Clone(sub.Igns)
+	return sub
+}
+
+func (ms *MemoryStore) MessageStates() state.Store {
+	return ms.states
+}
+
+func (ms *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,6 @@
+ALTER TABLE submissions ADD COLUMN splits_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE submissions ADD COLUMN plan TEXT NOT NULL DEFAULT '[]';
+CREATE INDEX submissions_boost_time ON submissions (boost_time);
+
+ALTER TABLE announcements ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX announcements_seed_id ON announcements (seed_id);
@@ -0,0 +1,52 @@
+CREATE TABLE submissions (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	ign            TEXT NOT NULL,
+	lobby          TEXT NOT NULL,
+	time_left      TEXT NOT NULL,
+	seed_id        TEXT NOT NULL,
+	boost_time     DOUBLE PRECISION NOT NULL,
+	boostless_time DOUBLE PRECISION NOT NULL,
+	debug          BOOLEAN NOT NULL,
+	submitted_at   BIGINT NOT NULL
+);
+CREATE INDEX submissions_ign ON submissions (ign);
+CREATE INDEX submissions_submitted_at ON submissions (submitted_at);
+
+CREATE TABLE announcements (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	ign          TEXT NOT NULL,
+	lobby        TEXT NOT NULL,
+	seed_id      TEXT NOT NULL,
+	boost_time   DOUBLE PRECISION NOT NULL,
+	channel_id   TEXT NOT NULL,
+	message_id   TEXT NOT NULL,
+	announced_at BIGINT NOT NULL
+);
+CREATE INDEX announcements_announced_at ON announcements (announced_at);
+
+CREATE TABLE message_states (
+	message_id TEXT PRIMARY KEY,
+	expires    BIGINT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX message_states_expires ON message_states (expires);
+
+CREATE TABLE player_splits (
+	ign        TEXT PRIMARY KEY,
+	splits     TEXT NOT NULL,
+	updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE tournaments (
+	id         TEXT PRIMARY KEY,
+	start_time BIGINT NOT NULL,
+	longevity  BIGINT NOT NULL
+);
+
+CREATE TABLE tournament_participants (
+	tournament_id TEXT NOT NULL REFERENCES tournaments (id) ON DELETE CASCADE,
+	id            BIGINT NOT NULL,
+	in_game_nick  TEXT NOT NULL,
+	discord_nick  TEXT NOT NULL,
+	PRIMARY KEY (tournament_id, id)
+);
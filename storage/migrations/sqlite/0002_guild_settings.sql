@@ -0,0 +1,8 @@
+CREATE TABLE guild_settings (
+	guild_id                TEXT PRIMARY KEY,
+	announcement_channel_id TEXT NOT NULL,
+	threshold               DOUBLE PRECISION NOT NULL,
+	ping_role_id            TEXT NOT NULL,
+	hide_image              BOOLEAN NOT NULL,
+	updated_at              BIGINT NOT NULL
+);
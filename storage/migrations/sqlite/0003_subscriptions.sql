@@ -0,0 +1,19 @@
+CREATE TABLE guild_tier_roles (
+	guild_id TEXT NOT NULL,
+	max_time DOUBLE PRECISION NOT NULL,
+	role_id  TEXT NOT NULL,
+	PRIMARY KEY (guild_id, max_time)
+);
+
+CREATE TABLE subscriptions (
+	user_id        TEXT PRIMARY KEY,
+	max_time       DOUBLE PRECISION NOT NULL,
+	rooms          TEXT NOT NULL,
+	excluded_rooms TEXT NOT NULL,
+	lobby          TEXT NOT NULL,
+	igns           TEXT NOT NULL,
+	quiet_start    INTEGER NOT NULL,
+	quiet_end      INTEGER NOT NULL,
+	utc_offset     INTEGER NOT NULL,
+	updated_at     BIGINT NOT NULL
+);
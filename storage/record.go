@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+
+	"pkd-bot/calc"
+	"pkd-bot/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RecordSubmissions saves every seed ChatTriggers submits until the returned func is called
+func RecordSubmissions(repo SubmissionRepository) (unsubscribe func()) {
+	return events.SeedSubmissions.Subscribe(func(e events.SeedSubmitted) {
+		err := repo.AddSubmission(context.Background(), &Submission{
+			Ign:           e.Ign,
+			Lobby:         e.Lobby,
+			TimeLeft:      e.TimeLeft,
+			Rooms:         e.Rooms,
+			BoostTime:     e.Result.BoostTime,
+			BoostlessTime: e.Result.BoostlessTime,
+			Plan:          e.Result.BoostRooms,
+			SplitsHash:    calc.SplitsHash(calc.RoomMap),
+			Debug:         e.Debug,
+			At:            e.At,
+		})
+		if err != nil {
+			log.Warn(err)
+		}
+	})
+}
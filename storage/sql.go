@@ -0,0 +1,667 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/state"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// dialect is what differs between postgres and sqlite, the queries are written for both with ? placeholders
+type dialect struct {
+	name   string
+	driver string
+	// lock and unlock keep other instances from migrating at the same time
+	lock   string
+	unlock string
+	// numbered placeholders are $1, $2, ... instead of ?
+	numbered bool
+}
+
+var (
+	postgres = dialect{
+		name:     "postgres",
+		driver:   "pgx",
+		lock:     `SELECT pg_advisory_lock(7402261)`,
+		unlock:   `SELECT pg_advisory_unlock(7402261)`,
+		numbered: true,
+	}
+	// sqlite locks the whole file for writes anyway
+	sqlite = dialect{
+		name:   "sqlite",
+		driver: "sqlite",
+	}
+)
+
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// SQLStore is the Store of a postgres or sqlite database, times are kept as unix milliseconds and rooms as seed ids
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func openSQL(ctx context.Context, d dialect, dsn string) (*SQLStore, error) {
+	if d.name == "sqlite" {
+		dsn = fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", dsn)
+	}
+
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the %s database: %w", d.name, err)
+	}
+	if d.name == "sqlite" {
+		// sqlite only has one writer anyway, this way writes wait for each other instead of failing with SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to the %s database: %w", d.name, err)
+	}
+
+	if err := migrate(ctx, db, d); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLStore{db: db, dialect: d}, nil
+}
+
+func (ss *SQLStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return ss.db.ExecContext(ctx, ss.dialect.rebind(query), args...)
+}
+
+func (ss *SQLStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return ss.db.QueryContext(ctx, ss.dialect.rebind(query), args...)
+}
+
+func (ss *SQLStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return ss.db.QueryRowContext(ctx, ss.dialect.rebind(query), args...)
+}
+
+func (ss *SQLStore) Ping(ctx context.Context) error {
+	return ss.db.PingContext(ctx)
+}
+
+func (ss *SQLStore) Close() error {
+	return ss.db.Close()
+}
+
+func parseRooms(seedID string) []string {
+	rooms, err := calc.ParseSeedID(seedID)
+	if err != nil {
+		// rooms that were renamed since, the seed id is still better than nothing
+		return strings.Split(seedID, calc.SeedIDSeparator)
+	}
+	return rooms
+}
+
+func (ss *SQLStore) AddSubmission(ctx context.Context, sub *Submission) error {
+	plan, err := json.Marshal(sub.Plan)
+	if err != nil {
+		return fmt.Errorf("failed to encode the plan of the submission of %s: %w", sub.Ign, err)
+	}
+
+	err = ss.queryRow(ctx, `
+		INSERT INTO submissions (ign, lobby, time_left, seed_id, boost_time, boostless_time, plan, splits_hash, debug, submitted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		sub.Ign, sub.Lobby, sub.TimeLeft, calc.SeedID(sub.Rooms), sub.BoostTime, sub.BoostlessTime, string(plan), sub.SplitsHash, sub.Debug, sub.At.UnixMilli(),
+	).Scan(&sub.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save the submission of %s: %w", sub.Ign, err)
+	}
+	return nil
+}
+
+const submissionColumns = `s.id, s.ign, s.lobby, s.time_left, s.seed_id, s.boost_time, s.boostless_time, s.plan, s.splits_hash, s.debug, s.submitted_at`
+
+func scanSubmission(row interface{ Scan(...any) error }) (Submission, error) {
+	var sub Submission
+	var seedID, plan string
+	var at int64
+	if err := row.Scan(&sub.ID, &sub.Ign, &sub.Lobby, &sub.TimeLeft, &seedID, &sub.BoostTime, &sub.BoostlessTime, &plan, &sub.SplitsHash, &sub.Debug, &at); err != nil {
+		return Submission{}, err
+	}
+	if err := json.Unmarshal([]byte(plan), &sub.Plan); err != nil {
+		return Submission{}, fmt.Errorf("failed to decode the plan of submission %d: %w", sub.ID, err)
+	}
+	sub.Rooms = parseRooms(seedID)
+	sub.At = time.UnixMilli(at)
+	return sub, nil
+}
+
+func (ss *SQLStore) GetSubmission(ctx context.Context, id int64) (Submission, error) {
+	sub, err := scanSubmission(ss.queryRow(ctx, `SELECT `+submissionColumns+` FROM submissions s WHERE s.id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Submission{}, ErrNotFound
+	}
+	if err != nil {
+		return Submission{}, fmt.Errorf("failed to get submission %d: %w", id, err)
+	}
+	return sub, nil
+}
+
+// submissionConditions is the WHERE clause of filter, Limit and Offset aside
+func submissionConditions(filter SubmissionFilter) (string, []any) {
+	where := ` WHERE 1 = 1`
+	args := make([]any, 0)
+	if filter.Ign != "" {
+		where += ` AND LOWER(s.ign) = LOWER(?)`
+		args = append(args, filter.Ign)
+	}
+	if !filter.Since.IsZero() {
+		where += ` AND s.submitted_at >= ?`
+		args = append(args, filter.Since.UnixMilli())
+	}
+	if !filter.Until.IsZero() {
+		where += ` AND s.submitted_at < ?`
+		args = append(args, filter.Until.UnixMilli())
+	}
+	if filter.MaxTime > 0 {
+		where += ` AND s.boost_time <= ?`
+		args = append(args, filter.MaxTime)
+	}
+	if filter.Room != "" {
+		// room slugs have no LIKE wildcards in them
+		where += ` AND ('.' || s.seed_id || '.') LIKE ?`
+		args = append(args, "%"+calc.SeedIDSeparator+calc.RoomSlug(filter.Room)+calc.SeedIDSeparator+"%")
+	}
+	if filter.NoDebug {
+		where += ` AND NOT s.debug`
+	}
+	if filter.FirstPerLobby {
+		where += ` AND NOT EXISTS (
+			SELECT 1 FROM submissions o
+			WHERE o.seed_id = s.seed_id AND LOWER(o.lobby) = LOWER(s.lobby) AND (o.submitted_at < s.submitted_at OR (o.submitted_at = s.submitted_at AND o.id < s.id))
+		)`
+	}
+	return where, args
+}
+
+func (ss *SQLStore) ListSubmissions(ctx context.Context, filter SubmissionFilter) ([]Submission, error) {
+	where, args := submissionConditions(filter)
+	query := `SELECT ` + submissionColumns + ` FROM submissions s` + where + ` ORDER BY s.submitted_at DESC, s.id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := ss.query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list submissions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := make([]Submission, 0)
+	for rows.Next() {
+		sub, err := scanSubmission(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read a submission: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+func (ss *SQLStore) CountSubmissions(ctx context.Context, filter SubmissionFilter) (int, error) {
+	where, args := submissionConditions(filter)
+
+	var count int
+	if err := ss.queryRow(ctx, `SELECT COUNT(*) FROM submissions s`+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count submissions: %w", err)
+	}
+	return count, nil
+}
+
+func (ss *SQLStore) FinderStats(ctx context.Context, filter SubmissionFilter) ([]FinderStats, error) {
+	where, args := submissionConditions(filter)
+	rows, err := ss.query(ctx, `
+		SELECT MIN(s.ign), COUNT(*),
+			SUM(CASE WHEN EXISTS (
+				SELECT 1 FROM announcements a WHERE a.seed_id = s.seed_id AND LOWER(a.lobby) = LOWER(s.lobby)
+			) THEN 1 ELSE 0 END),
+			MIN(s.boost_time), AVG(s.boost_time)
+		FROM submissions s`+where+` GROUP BY LOWER(s.ign) ORDER BY LOWER(MIN(s.ign))`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum up the submissions by player: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]FinderStats, 0)
+	for rows.Next() {
+		var st FinderStats
+		if err := rows.Scan(&st.Ign, &st.Seeds, &st.Announced, &st.BestTime, &st.AverageTime); err != nil {
+			return nil, fmt.Errorf("failed to read the stats of a player: %w", err)
+		}
+		stats = append(stats, st)
+	}
+
+	return stats, rows.Err()
+}
+
+func (ss *SQLStore) AddAnnouncement(ctx context.Context, a *Announcement) error {
+	err := ss.queryRow(ctx, `
+		INSERT INTO announcements (guild_id, ign, lobby, seed_id, boost_time, channel_id, message_id, announced_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		a.GuildID, a.Ign, a.Lobby, calc.SeedID(a.Rooms), a.BoostTime, a.ChannelID, a.MessageID, a.At.UnixMilli(),
+	).Scan(&a.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save the announcement of message %s: %w", a.MessageID, err)
+	}
+	return nil
+}
+
+func (ss *SQLStore) AnnouncementsSince(ctx context.Context, since time.Time) ([]Announcement, error) {
+	return ss.listAnnouncements(ctx, `WHERE announced_at >= ?`, since.UnixMilli())
+}
+
+func (ss *SQLStore) SeedAnnouncements(ctx context.Context, rooms []string, lobby string) ([]Announcement, error) {
+	return ss.listAnnouncements(ctx, `WHERE seed_id = ? AND LOWER(lobby) = LOWER(?)`, calc.SeedID(rooms), lobby)
+}
+
+func (ss *SQLStore) listAnnouncements(ctx context.Context, where string, args ...any) ([]Announcement, error) {
+	rows, err := ss.query(ctx, `
+		SELECT id, guild_id, ign, lobby, seed_id, boost_time, channel_id, message_id, announced_at FROM announcements
+		`+where+` ORDER BY announced_at DESC, id DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list announcements: %w", err)
+	}
+	defer rows.Close()
+
+	announcements := make([]Announcement, 0)
+	for rows.Next() {
+		var a Announcement
+		var seedID string
+		var at int64
+		if err := rows.Scan(&a.ID, &a.GuildID, &a.Ign, &a.Lobby, &seedID, &a.BoostTime, &a.ChannelID, &a.MessageID, &at); err != nil {
+			return nil, fmt.Errorf("failed to read an announcement: %w", err)
+		}
+		a.Rooms = parseRooms(seedID)
+		a.At = time.UnixMilli(at)
+		announcements = append(announcements, a)
+	}
+
+	return announcements, rows.Err()
+}
+
+func (ss *SQLStore) PutSplits(ctx context.Context, ign string, splits map[string]calc.PkdutilsSplit) error {
+	data, err := json.Marshal(splits)
+	if err != nil {
+		return fmt.Errorf("failed to encode the splits of %s: %w", ign, err)
+	}
+
+	_, err = ss.exec(ctx, `
+		INSERT INTO player_splits (ign, splits, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (ign) DO UPDATE SET splits = excluded.splits, updated_at = excluded.updated_at`,
+		strings.ToLower(ign), string(data), time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to save the splits of %s: %w", ign, err)
+	}
+	return nil
+}
+
+func (ss *SQLStore) GetSplits(ctx context.Context, ign string) (map[string]calc.PkdutilsSplit, time.Time, error) {
+	var data string
+	var updated int64
+	err := ss.queryRow(ctx, `SELECT splits, updated_at FROM player_splits WHERE ign = ?`, strings.ToLower(ign)).Scan(&data, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to get the splits of %s: %w", ign, err)
+	}
+
+	var splits map[string]calc.PkdutilsSplit
+	if err := json.Unmarshal([]byte(data), &splits); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to decode the splits of %s: %w", ign, err)
+	}
+	return splits, time.UnixMilli(updated), nil
+}
+
+func (ss *SQLStore) AddTournament(ctx context.Context, t Tournament) error {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, ss.dialect.rebind(`INSERT INTO tournaments (id, start_time, longevity) VALUES (?, ?, ?)`),
+		t.ID, t.StartTime.UnixMilli(), t.Longevity.Milliseconds()); err != nil {
+		return fmt.Errorf("failed to save tournament %s: %w", t.ID, err)
+	}
+
+	insert := ss.dialect.rebind(`INSERT INTO tournament_participants (tournament_id, id, in_game_nick, discord_nick) VALUES (?, ?, ?, ?)`)
+	for _, p := range t.Participants {
+		if _, err := tx.ExecContext(ctx, insert, t.ID, int64(p.ID), p.InGameNick, p.DiscordNick); err != nil {
+			return fmt.Errorf("failed to save participant %s of tournament %s: %w", p.InGameNick, t.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ss *SQLStore) GetTournament(ctx context.Context, id string) (Tournament, error) {
+	t := Tournament{ID: id, Participants: make([]Participant, 0)}
+	var start, longevity int64
+	err := ss.queryRow(ctx, `SELECT start_time, longevity FROM tournaments WHERE id = ?`, id).Scan(&start, &longevity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tournament{}, ErrNotFound
+	}
+	if err != nil {
+		return Tournament{}, fmt.Errorf("failed to get tournament %s: %w", id, err)
+	}
+	t.StartTime = time.UnixMilli(start)
+	t.Longevity = time.Duration(longevity) * time.Millisecond
+
+	rows, err := ss.query(ctx, `SELECT id, in_game_nick, discord_nick FROM tournament_participants WHERE tournament_id = ? ORDER BY in_game_nick`, id)
+	if err != nil {
+		return Tournament{}, fmt.Errorf("failed to list the participants of tournament %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Participant
+		var participantID int64
+		if err := rows.Scan(&participantID, &p.InGameNick, &p.DiscordNick); err != nil {
+			return Tournament{}, fmt.Errorf("failed to read a participant: %w", err)
+		}
+		p.ID = uint64(participantID)
+		t.Participants = append(t.Participants, p)
+	}
+
+	return t, rows.Err()
+}
+
+func (ss *SQLStore) PutGuildSettings(ctx context.Context, settings *GuildSettings) error {
+	updated := time.Now()
+	_, err := ss.exec(ctx, `
+		INSERT INTO guild_settings (guild_id, announcement_channel_id, threshold, ping_role_id, hide_image, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (guild_id) DO UPDATE SET announcement_channel_id = excluded.announcement_channel_id,
+			threshold = excluded.threshold, ping_role_id = excluded.ping_role_id, hide_image = excluded.hide_image,
+			updated_at = excluded.updated_at`,
+		settings.GuildID, settings.AnnouncementChannelID, settings.Threshold, settings.PingRoleID, settings.HideImage, updated.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to save the settings of guild %s: %w", settings.GuildID, err)
+	}
+	settings.UpdatedAt = updated
+	return nil
+}
+
+func (ss *SQLStore) GetGuildSettings(ctx context.Context, guildID string) (GuildSettings, error) {
+	settings := GuildSettings{GuildID: guildID}
+	var updated int64
+	err := ss.queryRow(ctx, `
+		SELECT announcement_channel_id, threshold, ping_role_id, hide_image, updated_at FROM guild_settings WHERE guild_id = ?`,
+		guildID,
+	).Scan(&settings.AnnouncementChannelID, &settings.Threshold, &settings.PingRoleID, &settings.HideImage, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return GuildSettings{}, ErrNotFound
+	}
+	if err != nil {
+		return GuildSettings{}, fmt.Errorf("failed to get the settings of guild %s: %w", guildID, err)
+	}
+	settings.UpdatedAt = time.UnixMilli(updated)
+	return settings, nil
+}
+
+func (ss *SQLStore) DeleteGuildSettings(ctx context.Context, guildID string) error {
+	if _, err := ss.exec(ctx, `DELETE FROM guild_settings WHERE guild_id = ?`, guildID); err != nil {
+		return fmt.Errorf("failed to delete the settings of guild %s: %w", guildID, err)
+	}
+	return nil
+}
+
+func (ss *SQLStore) PutTierRole(ctx context.Context, role TierRole) error {
+	_, err := ss.exec(ctx, `
+		INSERT INTO guild_tier_roles (guild_id, max_time, role_id) VALUES (?, ?, ?)
+		ON CONFLICT (guild_id, max_time) DO UPDATE SET role_id = excluded.role_id`,
+		role.GuildID, role.MaxTime, role.RoleID)
+	if err != nil {
+		return fmt.Errorf("failed to save the tier role of guild %s: %w", role.GuildID, err)
+	}
+	return nil
+}
+
+func (ss *SQLStore) DeleteTierRole(ctx context.Context, guildID string, maxTime float64) error {
+	if _, err := ss.exec(ctx, `DELETE FROM guild_tier_roles WHERE guild_id = ? AND max_time = ?`, guildID, maxTime); err != nil {
+		return fmt.Errorf("failed to delete the tier role of guild %s: %w", guildID, err)
+	}
+	return nil
+}
+
+func (ss *SQLStore) TierRoles(ctx context.Context, guildID string) ([]TierRole, error) {
+	rows, err := ss.query(ctx, `SELECT max_time, role_id FROM guild_tier_roles WHERE guild_id = ? ORDER BY max_time`, guildID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the tier roles of guild %s: %w", guildID, err)
+	}
+	defer rows.Close()
+
+	roles := make([]TierRole, 0)
+	for rows.Next() {
+		role := TierRole{GuildID: guildID}
+		if err := rows.Scan(&role.MaxTime, &role.RoleID); err != nil {
+			return nil, fmt.Errorf("failed to read a tier role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// subscriptionColumns are what scanSubscription reads, the lists are json arrays
+const subscriptionColumns = `user_id, max_time, rooms, excluded_rooms, lobby, igns, quiet_start, quiet_end, utc_offset, updated_at`
+
+func (ss *SQLStore) PutSubscription(ctx context.Context, sub *Subscription) error {
+	lists := make([]any, 0, 3)
+	for _, list := range [][]string{sub.Rooms, sub.ExcludedRooms, sub.Igns} {
+		data, err := json.Marshal(append(make([]string, 0, len(list)), list...))
+		if err != nil {
+			return fmt.Errorf("failed to encode the subscription of %s: %w", sub.UserID, err)
+		}
+		lists = append(lists, string(data))
+	}
+
+	updated := time.Now()
+	_, err := ss.exec(ctx, `
+		INSERT INTO subscriptions (`+subscriptionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET max_time = excluded.max_time, rooms = excluded.rooms,
+			excluded_rooms = excluded.excluded_rooms, lobby = excluded.lobby, igns = excluded.igns,
+			quiet_start = excluded.quiet_start, quiet_end = excluded.quiet_end, utc_offset = excluded.utc_offset,
+			updated_at = excluded.updated_at`,
+		sub.UserID, sub.MaxTime, lists[0], lists[1], sub.Lobby, lists[2], sub.QuietStart, sub.QuietEnd, sub.UTCOffset, updated.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to save the subscription of %s: %w", sub.UserID, err)
+	}
+	sub.UpdatedAt = updated
+	return nil
+}
+
+func (ss *SQLStore) GetSubscription(ctx context.Context, userID string) (Subscription, error) {
+	sub, err := scanSubscription(ss.queryRow(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE user_id = ?`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Subscription{}, ErrNotFound
+	}
+	if err != nil {
+		return Subscription{}, fmt.Errorf("failed to get the subscription of %s: %w", userID, err)
+	}
+	return sub, nil
+}
+
+func (ss *SQLStore) DeleteSubscription(ctx context.Context, userID string) error {
+	if _, err := ss.exec(ctx, `DELETE FROM subscriptions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete the subscription of %s: %w", userID, err)
+	}
+	return nil
+}
+
+func (ss *SQLStore) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	rows, err := ss.query(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions ORDER BY user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := make([]Subscription, 0)
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read a subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+func scanSubscription(row interface{ Scan(dest ...any) error }) (Subscription, error) {
+	var sub Subscription
+	var rooms, excludedRooms, igns string
+	var updated int64
+	err := row.Scan(&sub.UserID, &sub.MaxTime, &rooms, &excludedRooms, &sub.Lobby, &igns, &sub.QuietStart, &sub.QuietEnd, &sub.UTCOffset, &updated)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	for _, list := range []struct {
+		data string
+		dst  *[]string
+	}{{rooms, &sub.Rooms}, {excludedRooms, &sub.ExcludedRooms}, {igns, &sub.Igns}} {
+		if err := json.Unmarshal([]byte(list.data), list.dst); err != nil {
+			return Subscription{}, fmt.Errorf("failed to decode the subscription of %s: %w", sub.UserID, err)
+		}
+	}
+	sub.UpdatedAt = time.UnixMilli(updated)
+	return sub, nil
+}
+
+func (ss *SQLStore) MessageStates() state.Store {
+	return sqlStates{ss}
+}
+
+// sqlStates keeps the message states in the message_states table. The state.Store methods don't take a context,
+// the queries are small enough to not need one
+type sqlStates struct {
+	ss *SQLStore
+}
+
+func (st sqlStates) Get(messageID string) (state.Message, error) {
+	var data string
+	err := st.ss.queryRow(context.Background(), `SELECT data FROM message_states WHERE message_id = ?`, messageID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return state.Message{}, state.ErrNotFound
+	}
+	if err != nil {
+		return state.Message{}, fmt.Errorf("failed to get the state of message %s: %w", messageID, err)
+	}
+
+	return decodeMessage(data)
+}
+
+func (st sqlStates) Put(m state.Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode the state of message %s: %w", m.MessageID, err)
+	}
+
+	_, err = st.ss.exec(context.Background(), `
+		INSERT INTO message_states (message_id, expires, data) VALUES (?, ?, ?)
+		ON CONFLICT (message_id) DO UPDATE SET expires = excluded.expires, data = excluded.data`,
+		m.MessageID, m.Expires.UnixMilli(), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to save the state of message %s: %w", m.MessageID, err)
+	}
+	return nil
+}
+
+func (st sqlStates) Delete(messageID string) error {
+	if _, err := st.ss.exec(context.Background(), `DELETE FROM message_states WHERE message_id = ?`, messageID); err != nil {
+		return fmt.Errorf("failed to delete the state of message %s: %w", messageID, err)
+	}
+	return nil
+}
+
+func (st sqlStates) Expired(now time.Time) ([]state.Message, error) {
+	return st.list(`SELECT data FROM message_states WHERE expires <= ? ORDER BY expires`, now.UnixMilli())
+}
+
+func (st sqlStates) All() ([]state.Message, error) {
+	return st.list(`SELECT data FROM message_states`)
+}
+
+func (st sqlStates) Len() (int, error) {
+	var count int
+	if err := st.ss.queryRow(context.Background(), `SELECT COUNT(*) FROM message_states`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count message states: %w", err)
+	}
+	return count, nil
+}
+
+func (st sqlStates) Durable() bool {
+	return true
+}
+
+// Close doesn't close anything, the database belongs to the SQLStore
+func (st sqlStates) Close() error {
+	return nil
+}
+
+func (st sqlStates) list(query string, args ...any) ([]state.Message, error) {
+	rows, err := st.ss.query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message states: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]state.Message, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read a message state: %w", err)
+		}
+
+		m, err := decodeMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+func decodeMessage(data string) (state.Message, error) {
+	var m state.Message
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		return state.Message{}, fmt.Errorf("failed to decode a message state: %w", err)
+	}
+	return m, nil
+}
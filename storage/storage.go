@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pkd-bot/calc"
+	"pkd-bot/state"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Submission is a seed ChatTriggers sent to the api
+type Submission struct {
+	ID       int64
+	Ign      string
+	Lobby    string
+	TimeLeft string
+	// Rooms are the 8 room keys, without the finish room
+	Rooms         []string
+	BoostTime     float64
+	BoostlessTime float64
+	// Plan is how the best result boosts, its room indexes count the finish room too
+	Plan []calc.CalcResultBoost
+	// SplitsHash is the calc.SplitsHash of the splits the seed was calced with, it's empty for older submissions
+	SplitsHash string
+	Debug      bool
+	At         time.Time
+}
+
+// SubmissionFilter leaves out what isn't set
+type SubmissionFilter struct {
+	Ign   string
+	Since time.Time
+	Until time.Time
+	// MaxTime is the slowest boost time in seconds
+	MaxTime float64
+	// Room is a room key the seed has to have
+	Room string
+	// NoDebug leaves out the debug submissions
+	NoDebug bool
+	// FirstPerLobby leaves out the submissions of a seed after the first one from its lobby,
+	// everyone in a lobby submits the same seed
+	FirstPerLobby bool
+	// Limit is the most submissions returned, the newest first
+	Limit int
+	// Offset is how many to skip before those, it's only used with a Limit
+	Offset int
+}
+
+type SubmissionRepository interface {
+	// AddSubmission sets the ID of sub
+	AddSubmission(ctx context.Context, sub *Submission) error
+	// GetSubmission returns ErrNotFound for unknown ids
+	GetSubmission(ctx context.Context, id int64) (Submission, error)
+	ListSubmissions(ctx context.Context, filter SubmissionFilter) ([]Submission, error)
+	// CountSubmissions counts what ListSubmissions would list without Limit and Offset
+	CountSubmissions(ctx context.Context, filter SubmissionFilter) (int, error)
+	// FinderStats sums up what ListSubmissions would list without Limit and Offset by player, ordered by ign.
+	// A seed counts as announced when the bot announced it from its lobby, in any guild
+	FinderStats(ctx context.Context, filter SubmissionFilter) ([]FinderStats, error)
+}
+
+// FinderStats is how a player did in the submissions of a filter
+type FinderStats struct {
+	// Ign is one way the player wrote it, the stats don't care about the case
+	Ign         string
+	Seeds       int
+	Announced   int
+	BestTime    float64
+	AverageTime float64
+}
+
+// Announcement is a seed the bot posted to discord
+type Announcement struct {
+	ID int64
+	// GuildID is empty for announcements from before guilds had their own
+	GuildID   string
+	Ign       string
+	Lobby     string
+	Rooms     []string
+	BoostTime float64
+	ChannelID string
+	MessageID string
+	At        time.Time
+}
+
+type AnnouncementRepository interface {
+	// AddAnnouncement sets the ID of a
+	AddAnnouncement(ctx context.Context, a *Announcement) error
+	// AnnouncementsSince lists the announcements from since on, the newest first
+	AnnouncementsSince(ctx context.Context, since time.Time) ([]Announcement, error)
+	// SeedAnnouncements lists the announcements of a seed in a lobby, the newest first
+	SeedAnnouncements(ctx context.Context, rooms []string, lobby string) ([]Announcement, error)
+}
+
+// SplitsRepository keeps the last pkdutils splits each player sent, by lowercased IGN
+type SplitsRepository interface {
+	PutSplits(ctx context.Context, ign string, splits map[string]calc.PkdutilsSplit) error
+	// GetSplits returns ErrNotFound for players that never sent their splits
+	GetSplits(ctx context.Context, ign string) (map[string]calc.PkdutilsSplit, time.Time, error)
+}
+
+type Participant struct {
+	ID          uint64
+	InGameNick  string
+	DiscordNick string
+}
+
+type Tournament struct {
+	ID           string
+	StartTime    time.Time
+	Longevity    time.Duration
+	Participants []Participant
+}
+
+type TournamentRepository interface {
+	// AddTournament stores the tournament with its participants
+	AddTournament(ctx context.Context, t Tournament) error
+	// GetTournament returns ErrNotFound for unknown ids
+	GetTournament(ctx context.Context, id string) (Tournament, error)
+}
+
+// GuildSettings are how a guild wants seeds announced, the zero values mean the bot's defaults
+type GuildSettings struct {
+	GuildID string
+	// AnnouncementChannelID is empty to announce in the channel with the configured name
+	AnnouncementChannelID string
+	// Threshold is the boost time in seconds under which seeds are announced, 0 for the configured one
+	Threshold float64
+	// PingRoleID is pinged with every announcement, nobody is if it's empty
+	PingRoleID string
+	// HideImage leaves the results image out of announcements
+	HideImage bool
+	UpdatedAt time.Time
+}
+
+// TierRole is a role pinged with announcements of seeds under MaxTime, members opt in to it
+type TierRole struct {
+	GuildID string
+	// MaxTime is the boost time in seconds the seeds have to be under
+	MaxTime float64
+	RoleID  string
+}
+
+type GuildSettingsRepository interface {
+	// PutGuildSettings sets UpdatedAt of settings
+	PutGuildSettings(ctx context.Context, settings *GuildSettings) error
+	// GetGuildSettings returns ErrNotFound for guilds that never changed their settings
+	GetGuildSettings(ctx context.Context, guildID string) (GuildSettings, error)
+	DeleteGuildSettings(ctx context.Context, guildID string) error
+
+	// PutTierRole replaces the role of the guild's tier with the same MaxTime
+	PutTierRole(ctx context.Context, role TierRole) error
+	DeleteTierRole(ctx context.Context, guildID string, maxTime float64) error
+	// TierRoles lists the tier roles of a guild, the fastest tier first
+	TierRoles(ctx context.Context, guildID string) ([]TierRole, error)
+}
+
+// Subscription is which seeds a discord user wants to be DMed about, every user has one at most
+type Subscription struct {
+	UserID string
+	// MaxTime is the slowest boost time in seconds that's sent, any is if it's 0
+	MaxTime float64
+	// Rooms all have to be in a seed and none of ExcludedRooms can be
+	Rooms         []string
+	ExcludedRooms []string
+	// Lobby is empty for seeds in every lobby
+	Lobby string
+	// Igns are the finders whose seeds are sent, everyone's are if it's empty
+	Igns []string
+	// QuietStart and QuietEnd are minutes of the user's day between which nothing is sent, there are no quiet hours if they're equal
+	QuietStart int
+	QuietEnd   int
+	// UTCOffset is the user's time zone in minutes east of UTC
+	UTCOffset int
+	UpdatedAt time.Time
+}
+
+type SubscriptionRepository interface {
+	// PutSubscription replaces the user's subscription and sets UpdatedAt of sub
+	PutSubscription(ctx context.Context, sub *Subscription) error
+	// GetSubscription returns ErrNotFound for users without one
+	GetSubscription(ctx context.Context, userID string) (Subscription, error)
+	DeleteSubscription(ctx context.Context, userID string) error
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+}
+
+// Store has every repository of a backend
+type Store interface {
+	SubmissionRepository
+	AnnouncementRepository
+	SplitsRepository
+	TournamentRepository
+	GuildSettingsRepository
+	SubscriptionRepository
+
+	// MessageStates are the states behind the buttons of seed messages
+	MessageStates() state.Store
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Open connects to the database of dsn and migrates it. Postgres dsns start with postgres:// or postgresql://,
+// sqlite ones with sqlite: followed by the file, e.g. sqlite:pkd-bot.db. "memory" keeps everything in memory
+func Open(ctx context.Context, dsn string) (Store, error) {
+	switch {
+	case dsn == "memory":
+		return NewMemoryStore(), nil
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return openSQL(ctx, postgres, dsn)
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return openSQL(ctx, sqlite, strings.TrimPrefix(dsn, "sqlite:"))
+	default:
+		// the dsn isn't in the error, it can have a password in it
+		return nil, fmt.Errorf("unknown database, the dsn should start with postgres://, postgresql:// or sqlite:")
+	}
+}
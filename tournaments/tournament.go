@@ -3,8 +3,12 @@ package tournaments
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/csv"
 	"fmt"
+	"time"
+
+	"pkd-bot/storage"
 
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
@@ -18,30 +22,45 @@ type participant struct {
 	discordNick string
 }
 
-type tournament struct {
-	id              uuid.UUID
-	startTime       uint64
-	longevity       uint64
-	participantList []participant
+// Tournaments registers tournaments in its store
+type Tournaments struct {
+	store storage.TournamentRepository
+}
+
+func New(store storage.TournamentRepository) *Tournaments {
+	return &Tournaments{store: store}
 }
 
-func registerTournament(participantList []participant) {
-	_, err := uuid.NewV7()
+func (ts *Tournaments) registerTournament(participantList []participant) error {
+	tournamentId, err := uuid.NewV7()
 	if err != nil {
 		log.Warnf("failed to generate uuid for a tournament: %v", err)
+		return err
 	}
 
-	// t := tournament{
-	// 	id:              tournamentId,
-	// 	startTime:       startTime,
-	// 	longevity:       0,
-	// 	participantList: participantList,
-	// }
+	// tournaments start when they're registered until they can be scheduled
+	t := storage.Tournament{
+		ID:           tournamentId.String(),
+		StartTime:    time.Now(),
+		Longevity:    0,
+		Participants: make([]storage.Participant, 0, len(participantList)),
+	}
+	for _, p := range participantList {
+		t.Participants = append(t.Participants, storage.Participant{
+			ID:          p.id,
+			InGameNick:  p.inGameNick,
+			DiscordNick: p.discordNick,
+		})
+	}
 
-	// TODO: some fancy code that inserts that into DB
+	if err := ts.store.AddTournament(context.Background(), t); err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
 }
 
-func RegisterTournamentFromCsv(fileContent []byte) error {
+func (ts *Tournaments) RegisterTournamentFromCsv(fileContent []byte) error {
 	buf := bytes.NewBuffer(fileContent)
 	reader := bufio.NewReader(buf)
 	csvReader := csv.NewReader(reader)
@@ -87,7 +106,9 @@ func RegisterTournamentFromCsv(fileContent []byte) error {
 		participantList = append(participantList, p)
 	}
 
-	registerTournament(participantList)
+	if err := ts.registerTournament(participantList); err != nil {
+		return fmt.Errorf("failed to save the tournament: %v", err)
+	}
 	log.Infof("Succesfully registered these players: %+v", participantList)
 	return nil
 }